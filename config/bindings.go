@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// ArrangeBindings groups configurations by the address they listen on,
+// which is their BindAddress if set, otherwise their Host. For example,
+// a site that should listen on localhost and another on 127.0.0.1 will
+// be grouped into the same address: 127.0.0.1. It will return an error
+// if the address lookup fails or if a TLS listener is configured on the
+// same address as a plaintext HTTP listener. Configs on a port that
+// is also listened to on all interfaces are grouped into that one.
+func ArrangeBindings(allConfigs []Config) (map[string][]Config, error) {
+	addresses := make(map[string][]Config)
+
+	// Group configs by bind address
+	for _, cfg := range allConfigs {
+		if cfg.Socket != "" {
+			addresses[cfg.ListenAddress()] = append(addresses[cfg.ListenAddress()], cfg)
+			continue
+		}
+		addr, err := net.ResolveTCPAddr(cfg.ListenNetwork(), cfg.ListenAddress())
+		if err != nil {
+			return addresses, err
+		}
+		addresses[addr.String()] = append(addresses[addr.String()], cfg)
+	}
+
+	// A listener on all interfaces of a port can't be bound
+	// along with a listener on one of them, so it takes
+	// the configs for all the other interfaces too
+	allInterfaces := make(map[string]string) // port to address
+	for addr := range addresses {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue // Unix socket
+		}
+		if existing, ok := allInterfaces[port]; IsCatchAllHost(host) && (!ok || addr < existing) {
+			allInterfaces[port] = addr
+		}
+	}
+	for addr, configs := range addresses {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if all, ok := allInterfaces[port]; ok && addr != all {
+			addresses[all] = append(addresses[all], configs...)
+			delete(addresses, addr)
+		}
+	}
+
+	// Don't allow HTTP and HTTPS to be served on the same address
+	for _, configs := range addresses {
+		isTLS := configs[0].TLS.Enabled
+		for _, cfg := range configs {
+			if cfg.TLS.Enabled != isTLS {
+				thisConfigProto, otherConfigProto := "HTTP", "HTTP"
+				if cfg.TLS.Enabled {
+					thisConfigProto = "HTTPS"
+				}
+				if configs[0].TLS.Enabled {
+					otherConfigProto = "HTTPS"
+				}
+				return addresses, fmt.Errorf("Configuration error: Cannot multiplex %s (%s) and %s (%s) on same address",
+					configs[0].Address(), otherConfigProto, cfg.Address(), thisConfigProto)
+			}
+		}
+	}
+
+	return addresses, nil
+}
+
+// ListenAddresses returns the addresses that the servers for
+// cfgs would listen on, as arranged by ArrangeBindings, in
+// sorted order. Nothing is bound; this is for checking a
+// configuration before starting it.
+func ListenAddresses(cfgs []Config) ([]string, error) {
+	addresses, err := ArrangeBindings(cfgs)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for addr := range addresses {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListenAddresses(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  []string
+		shouldErr bool
+	}{
+		{"localhost:8080", []string{"127.0.0.1:8080"}, false},
+		{"127.0.0.1:8080 localhost:8080", []string{"127.0.0.1:8080"}, false},
+		{"localhost:8080,8081", []string{"127.0.0.1:8080", "127.0.0.1:8081"}, false},
+		{"[::1]:8080", []string{"[::1]:8080"}, false},
+		{"example.com:8080\nbind 127.0.0.1", []string{"127.0.0.1:8080"}, false},
+		{"localhost:8080 0.0.0.0:8080", []string{":8080"}, false},
+		{"unix:/tmp/caddy_test.sock", []string{"unix:/tmp/caddy_test.sock"}, false},
+		{"localhost:8443 {\ntls cert.pem key.pem\n}\n127.0.0.1:8443", nil, true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+		confs, err := p.parse()
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors parsing, but got '%s'", i, err)
+		}
+
+		addrs, err := ListenAddresses(confs)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, but got '%s'", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, test.expected) {
+			t.Errorf("Test %d: Expected addresses %v, got %v", i, test.expected, addrs)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Builder builds a Config in code, for programs that
+// embed the server and don't need a Caddyfile. Its
+// methods can be chained:
+//
+//	cfg, err := config.New().Host("example.com").Port("8080").
+//		Root("/www").Use(gzipMiddleware).Build()
+//
+// Values are checked the same way as they are when
+// parsing a Caddyfile, and the error of the first
+// invalid one is returned by Build. The Config can be
+// served like those from Load, with server.New.
+type Builder struct {
+	cfg Config
+	err error
+}
+
+// New returns a Builder of a Config that serves the
+// current directory at the default host and port.
+func New() *Builder {
+	return &Builder{
+		cfg: Config{
+			Host:       defaultHost,
+			Port:       defaultPort,
+			Root:       defaultRoot,
+			Middleware: make(map[string][]middleware.Middleware),
+		},
+	}
+}
+
+// Host sets the host name or IP address of the site.
+func (b *Builder) Host(host string) *Builder {
+	b.cfg.Host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return b
+}
+
+// Port sets the port to listen on.
+func (b *Builder) Port(port string) *Builder {
+	if b.err == nil {
+		b.err = checkPort(port)
+	}
+	b.cfg.Port = port
+	return b
+}
+
+// Root sets the directory from which to serve files.
+func (b *Builder) Root(root string) *Builder {
+	b.cfg.Root = root
+	return b
+}
+
+// Bind sets the IP address to listen on, if different
+// from the host; see the bind directive.
+func (b *Builder) Bind(addr string) *Builder {
+	addr, err := checkBindAddress(addr)
+	if b.err == nil {
+		b.err = err
+	}
+	b.cfg.BindAddress = addr
+	return b
+}
+
+// Network sets the network to listen on: "tcp4", "tcp6",
+// or "tcp"; see the network directive.
+func (b *Builder) Network(network string) *Builder {
+	if err := checkNetwork(network); err != nil && b.err == nil {
+		b.err = err
+	}
+	b.cfg.Network = network
+	return b
+}
+
+// TLS enables TLS with a certificate and key file. Calling
+// it again adds another certificate and key, like another
+// tls directive.
+func (b *Builder) TLS(certificate, key string) *Builder {
+	if b.cfg.TLS.Enabled {
+		b.cfg.TLS.Certificates = append(b.cfg.TLS.Certificates, CertificatePair{certificate, key})
+	} else {
+		b.cfg.TLS.Enabled = true
+		b.cfg.TLS.Certificate = certificate
+		b.cfg.TLS.Key = key
+	}
+	return b
+}
+
+// TLSInline enables TLS with the PEM data of a certificate
+// and key instead of files, like the tls_inline directive.
+func (b *Builder) TLSInline(certificatePEM, keyPEM []byte) *Builder {
+	if b.cfg.TLS.Enabled {
+		b.cfg.TLS.Certificates = append([]CertificatePair{{b.cfg.TLS.Certificate, b.cfg.TLS.Key}}, b.cfg.TLS.Certificates...)
+		b.cfg.TLS.Certificate, b.cfg.TLS.Key = "", ""
+	}
+	b.cfg.TLS.Enabled = true
+	b.cfg.TLS.CertificatePEM = certificatePEM
+	b.cfg.TLS.KeyPEM = keyPEM
+	return b
+}
+
+// Protocols sets the range of TLS protocol versions to
+// support, like the protocols property of the tls directive.
+// If max is empty, the highest supported version is used.
+func (b *Builder) Protocols(min, max string) *Builder {
+	if max == "" {
+		max = highestProtocol
+	}
+	if b.err == nil {
+		b.err = checkProtocols(min, max)
+	}
+	b.cfg.TLS.ProtocolMinVersion = min
+	b.cfg.TLS.ProtocolMaxVersion = max
+	return b
+}
+
+// Ciphers sets the TLS cipher suites to offer, by the
+// same names as the ciphers property of the tls directive.
+func (b *Builder) Ciphers(names ...string) *Builder {
+	for _, name := range names {
+		cipher, err := cipherSuite(name)
+		if err != nil {
+			if b.err == nil {
+				b.err = err
+			}
+			continue
+		}
+		b.cfg.TLS.Ciphers = append(b.cfg.TLS.Ciphers, cipher)
+	}
+	return b
+}
+
+// Use adds middleware to the site; they are executed in
+// the order they are added, before any added later.
+func (b *Builder) Use(mids ...middleware.Middleware) *Builder {
+	return b.UsePath("/", mids...)
+}
+
+// UsePath adds middleware for requests in the path scope
+// path only; see Config.MiddlewareChain.
+func (b *Builder) UsePath(path string, mids ...middleware.Middleware) *Builder {
+	b.cfg.Middleware[path] = append(b.cfg.Middleware[path], mids...)
+	return b
+}
+
+// Startup adds a function to execute when the server starts.
+func (b *Builder) Startup(fn func() error) *Builder {
+	b.cfg.Startup = append(b.cfg.Startup, fn)
+	return b
+}
+
+// Shutdown adds a function to execute when the server quits.
+func (b *Builder) Shutdown(fn func() error) *Builder {
+	b.cfg.Shutdown = append(b.cfg.Shutdown, fn)
+	return b
+}
+
+// BeforeRequest adds a function to call for each request
+// before the middleware; see Config.BeforeRequest.
+func (b *Builder) BeforeRequest(fn func(r *http.Request) *http.Request) *Builder {
+	b.cfg.BeforeRequest = append(b.cfg.BeforeRequest, fn)
+	return b
+}
+
+// AfterRequest adds a function to call with the status of
+// each response; see Config.AfterRequest.
+func (b *Builder) AfterRequest(fn func(r *http.Request, status int)) *Builder {
+	b.cfg.AfterRequest = append(b.cfg.AfterRequest, fn)
+	return b
+}
+
+// Build returns the Config, or the first error found in
+// the values given to b. Like Load, it also checks that
+// the TLS certificate and key files can be read.
+func (b *Builder) Build() (Config, error) {
+	if b.err != nil {
+		return Config{}, b.err
+	}
+	err := checkTLSFiles(b.cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	return b.cfg, nil
+}
+
+// The functions below check values the same way whether
+// they come from a Caddyfile or a Builder.
+
+// checkPort returns an error if port can't be listened on.
+// Port 0 is allowed: the system chooses a free port when
+// the server starts listening (see server.Server.ListenAddr).
+func checkPort(port string) error {
+	if port == "" {
+		return errors.New("Invalid port '" + port + "'")
+	}
+	return nil
+}
+
+// checkBindAddress returns addr without any brackets,
+// or an error if it isn't an IP address.
+func checkBindAddress(addr string) (string, error) {
+	ip := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if net.ParseIP(ip) == nil {
+		return ip, errors.New("Invalid bind address '" + addr + "' - must be an IP address")
+	}
+	return ip, nil
+}
+
+// checkNetwork returns an error if network isn't one
+// that a site can listen on.
+func checkNetwork(network string) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return nil
+	}
+	return errors.New("Invalid network '" + network + "' - must be tcp, tcp4, or tcp6")
+}
+
+// checkProtocols returns an error if min or max isn't a
+// key of SupportedProtocols or if min is higher than max.
+func checkProtocols(min, max string) error {
+	minVersion, ok := SupportedProtocols[min]
+	if !ok {
+		return errors.New("Unknown TLS protocol '" + min + "'")
+	}
+	maxVersion, ok := SupportedProtocols[max]
+	if !ok {
+		return errors.New("Unknown TLS protocol '" + max + "'")
+	}
+	if minVersion > maxVersion {
+		return errors.New("Minimum TLS protocol " + min + " is higher than maximum " + max)
+	}
+	return nil
+}
+
+// cipherSuite returns the cipher suite with the given
+// name in SupportedCiphers, or an error if there is none.
+func cipherSuite(name string) (uint16, error) {
+	cipher, ok := SupportedCiphers[name]
+	if !ok {
+		return 0, errors.New("Unknown cipher suite '" + name + "'")
+	}
+	return cipher, nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestBuilder(t *testing.T) {
+	mid := func(next middleware.Handler) middleware.Handler {
+		return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return next.ServeHTTP(w, r)
+		})
+	}
+
+	cfg, err := New().Host("example.com").Port("8080").Root("/www").Bind("[::1]").
+		TLS("config_test.go", "config_test.go").Protocols("tls1.2", "").
+		Ciphers("ECDHE-RSA-AES128-GCM-SHA256").Use(mid, mid).UsePath("/api", mid).Build()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if cfg.Address() != "example.com:8080" || cfg.Root != "/www" || cfg.ListenAddress() != "[::1]:8080" {
+		t.Errorf("Expected example.com:8080 at [::1]:8080 with root '/www', got %s at %s with root '%s'",
+			cfg.Address(), cfg.ListenAddress(), cfg.Root)
+	}
+	if !cfg.TLS.Enabled || cfg.TLS.ProtocolMinVersion != "tls1.2" || cfg.TLS.ProtocolMaxVersion != highestProtocol ||
+		len(cfg.TLS.Ciphers) != 1 {
+		t.Errorf("Expected TLS to be configured, got %#v", cfg.TLS)
+	}
+	if len(cfg.Middleware["/"]) != 2 || len(cfg.MiddlewareChain("/api")) != 3 {
+		t.Errorf("Expected 2 middleware for '/' and 3 for '/api', got %d and %d",
+			len(cfg.Middleware["/"]), len(cfg.MiddlewareChain("/api")))
+	}
+
+	cfg, err = New().Build()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if cfg.Address() != defaultHost+":"+defaultPort || cfg.Root != defaultRoot {
+		t.Errorf("Expected defaults, got %s with root '%s'", cfg.Address(), cfg.Root)
+	}
+
+	for i, test := range []struct {
+		builder  *Builder
+		expected string
+	}{
+		{New().Port(""), "Invalid port"},
+		{New().Bind("localhost"), "Invalid bind address"},
+		{New().Protocols("tls1.3", "tls1.0"), "higher than maximum"},
+		{New().Ciphers("foobar").Port(""), "foobar"},
+		{New().TLS("config_test.go", "nonexistent_key.pem"), "nonexistent_key.pem"},
+	} {
+		_, err := test.builder.Build()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Test %d: Expected an error containing '%s', got '%v'", i, test.expected, err)
+		}
+	}
+}
+
+func TestBuilderRequestHooks(t *testing.T) {
+	var recorded []string
+	record := func(name string) func(*http.Request, int) {
+		return func(r *http.Request, status int) {
+			recorded = append(recorded, name+" "+r.URL.Path+" "+http.StatusText(status))
+		}
+	}
+
+	cfg, err := New().BeforeRequest(func(r *http.Request) *http.Request { return nil }).
+		AfterRequest(record("first")).AfterRequest(record("second")).Build()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(cfg.BeforeRequest) != 1 || len(cfg.AfterRequest) != 2 {
+		t.Fatalf("Expected 1 before and 2 after request hooks, got %d and %d", len(cfg.BeforeRequest), len(cfg.AfterRequest))
+	}
+
+	r, _ := http.NewRequest("GET", "/page", nil)
+	for _, fn := range cfg.AfterRequest {
+		fn(r, http.StatusOK)
+	}
+	expected := []string{"first /page OK", "second /page OK"}
+	if strings.Join(recorded, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected the hooks to record %v in order, got %v", expected, recorded)
+	}
+}
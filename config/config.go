@@ -3,11 +3,23 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/browse"
+	"github.com/mholt/caddy/middleware/redirect"
 )
 
 const (
@@ -16,9 +28,27 @@ const (
 	defaultRoot = "."
 
 	// The default configuration file to load if none is specified
+	// and the ConfigFileEnv environment variable isn't set
 	DefaultConfigFile = "Caddyfile"
+
+	// The environment variable that may name the configuration
+	// file to load if none is specified; see DefaultFile
+	ConfigFileEnv = "CADDYFILE"
 )
 
+// DefaultFile returns the configuration file to load when
+// none is specified: the one named by the CADDYFILE environment
+// variable if it is set and not empty, otherwise Caddyfile in
+// the working directory (DefaultConfigFile).
+func DefaultFile() string {
+	return envOr(ConfigFileEnv, DefaultConfigFile)
+}
+
+// StrictEnv makes it an error for a configuration to
+// reference an environment variable (as {$NAME}) that
+// is not set, rather than substituting empty string.
+var StrictEnv bool
+
 // config represents a server configuration. It
 // is populated by parsing a config file (via the
 // Load function).
@@ -29,15 +59,94 @@ type Config struct {
 	// The port to listen on
 	Port string
 
-	// The directory from which to serve files
+	// The IP address to listen on, if different from Host;
+	// Host is still used to match requests to this site
+	BindAddress string
+
+	// The network to listen on: "tcp4" for IPv4 only, "tcp6"
+	// for IPv6 only, or "tcp" (the default if empty) for both
+	Network string
+
+	// The path of a Unix domain socket to listen on instead
+	// of a TCP port, for a site with an address like
+	// "unix:/var/run/caddy.sock"; Host and Port are empty
+	Socket string
+
+	// The permissions to set on Socket once it is created;
+	// if zero, they are left as the umask makes them
+	SocketMode os.FileMode
+
+	// The user and group, by name or ID, to run the
+	// process as once it has bound the ports of its sites,
+	// such as to give up the root privileges needed for
+	// ports below 1024; empty keeps the current ones
+	User  string
+	Group string
+
+	// The directory from which to serve files; it may
+	// depend on the host of the request, see HostRoot, in
+	// which case directives that read files from the root,
+	// like try_files and markdown, can't be used. It may also be a .zip archive to serve files from
+	// without unpacking it, see middleware.OpenArchive
 	Root string
 
+	// Directories from which to serve files in certain
+	// path scopes instead of Root, keyed by path; see
+	// RootFor
+	PathRoots map[string]string
+
+	// The names of the files to serve for a directory, in
+	// order of preference; if empty, browse.IndexPages
+	IndexFiles []string
+
+	// Content types of files to serve, keyed by extension
+	// in lower case, such as ".wasm"; they take precedence
+	// over those from mime.TypeByExtension
+	MIMETypes map[string]string
+
+	// The file system from which to serve files; if nil,
+	// files are served from Root and PathRoots on disk.
+	// Middleware that looks up files, like try_files,
+	// languages and browse, uses it too. This can be replaced with an in-memory file system,
+	// for example http.FS(fstest.MapFS{...}) in tests.
+	FileSystem http.FileSystem
+
+	// Whether to refuse files in Root and PathRoots that
+	// are reached through a symbolic link, with 403
+	// Forbidden, rather than follow the link, which may
+	// lead outside of the root
+	DisableSymlinks bool
+
 	// HTTPS configuration
 	TLS TLSConfig
 
-	// Middleware stack
+	// Timeouts for reading a request, writing a response,
+	// and waiting for the next request on a keep-alive
+	// connection; zero means no timeout
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// Read and write timeouts for requests in certain
+	// path scopes, keyed by path, in place of ReadTimeout
+	// and WriteTimeout; see TimeoutsFor
+	PathTimeouts map[string]Timeouts
+
+	// The most connections to have open at once; once
+	// there are that many, the next is accepted when one
+	// closes. Zero means no limit. Sites that share a
+	// listener share the smallest limit among them
+	MaxConns int
+
+	// Middleware stack of each path scope, keyed by
+	// path; see MiddlewareChain for how they combine
 	Middleware map[string][]middleware.Middleware
 
+	// The directives that the middleware of each path
+	// scope came from, in the same order as Middleware;
+	// middleware added in code may not have one
+	MiddlewareNames map[string][]string
+
 	// Functions (or methods) to execute at server start; these
 	// are executed before any parts of the server are configured,
 	// and the functions are blocking
@@ -47,13 +156,396 @@ type Config struct {
 	// these are executed in response to SIGINT and are blocking
 	Shutdown []func() error
 
+	// Functions to call, in order, for each request to the
+	// site before its middleware handle it, and after with
+	// the status of the response, such as to trace requests.
+	// A BeforeRequest function may return the request with
+	// a new context (e.g. with a span) to pass on instead of
+	// r, or nil to keep r. Panics in them are logged
+	BeforeRequest []func(r *http.Request) *http.Request
+	AfterRequest  []func(r *http.Request, status int)
+
+	// The names of the Startup and Shutdown functions, in the
+	// same order, for logging; see AddStartup and AddShutdown.
+	// Functions added in code may not have one
+	StartupNames  []string
+	ShutdownNames []string
+
 	// The path to the configuration file from which this was loaded
 	ConfigFile string
 }
 
-// Address returns the host:port of c as a string.
+// AddStartup appends fn to c.Startup, and its name to
+// c.StartupNames. The slices are copied first, so configs
+// copied from the same one don't get each other's functions.
+func (c *Config) AddStartup(name string, fn func() error) {
+	c.Startup, c.StartupNames = appendHook(c.Startup, c.StartupNames, name, fn)
+}
+
+// AddShutdown appends fn to c.Shutdown, and its name to
+// c.ShutdownNames, like AddStartup.
+func (c *Config) AddShutdown(name string, fn func() error) {
+	c.Shutdown, c.ShutdownNames = appendHook(c.Shutdown, c.ShutdownNames, name, fn)
+}
+
+// appendHook appends fn to fns and name to names, which
+// are copied first, giving the functions in fns without a
+// name an empty one so that the names stay in order.
+func appendHook(fns []func() error, names []string, name string, fn func() error) ([]func() error, []string) {
+	names = names[:len(names):len(names)]
+	for len(names) < len(fns) {
+		names = append(names, "")
+	}
+	return append(fns[:len(fns):len(fns)], fn), append(names[:len(fns)], name)
+}
+
+// Clone returns a copy of c that is independent of it: its
+// maps and slices, including those of TLS and the middleware
+// and startup and shutdown functions, are copied, so changing
+// one config doesn't change the other. The functions and the
+// file system themselves are shared.
+func (c Config) Clone() Config {
+	clone := c
+	clone.PathRoots = copyStrings(c.PathRoots)
+	if c.PathTimeouts != nil {
+		clone.PathTimeouts = make(map[string]Timeouts, len(c.PathTimeouts))
+		for scope, timeouts := range c.PathTimeouts {
+			clone.PathTimeouts[scope] = timeouts
+		}
+	}
+	clone.MIMETypes = copyStrings(c.MIMETypes)
+	clone.IndexFiles = append([]string(nil), c.IndexFiles...)
+	clone.TLS = c.TLS.clone()
+
+	if c.Middleware != nil {
+		clone.Middleware = make(map[string][]middleware.Middleware, len(c.Middleware))
+		for scope, mids := range c.Middleware {
+			clone.Middleware[scope] = append([]middleware.Middleware(nil), mids...)
+		}
+	}
+	if c.MiddlewareNames != nil {
+		clone.MiddlewareNames = make(map[string][]string, len(c.MiddlewareNames))
+		for scope, names := range c.MiddlewareNames {
+			clone.MiddlewareNames[scope] = append([]string(nil), names...)
+		}
+	}
+
+	clone.Startup = append([]func() error(nil), c.Startup...)
+	clone.Shutdown = append([]func() error(nil), c.Shutdown...)
+	clone.BeforeRequest = append(([]func(*http.Request) *http.Request)(nil), c.BeforeRequest...)
+	clone.AfterRequest = append(([]func(*http.Request, int))(nil), c.AfterRequest...)
+	clone.StartupNames = append([]string(nil), c.StartupNames...)
+	clone.ShutdownNames = append([]string(nil), c.ShutdownNames...)
+
+	return clone
+}
+
+// copyStrings returns a copy of m, or nil if m is nil.
+func copyStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// Address returns the host:port of c as a string. An
+// IPv6 host is enclosed in brackets, whether or not
+// c.Host is. For a site on a Unix socket, it is "unix:"
+// followed by the path of the socket.
 func (c Config) Address() string {
-	return net.JoinHostPort(c.Host, c.Port)
+	if c.Socket != "" {
+		return "unix:" + c.Socket
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(c.Host, "["), "]")
+	return net.JoinHostPort(host, c.Port)
+}
+
+// String returns a readable summary of c, with its address
+// on the first line followed by an indented line for each
+// setting: root, TLS, and the middleware of each path scope,
+// among others. Certificates and keys are shown by file name.
+func (c Config) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", c.Address())
+
+	line := func(name, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "  %-12s "+format+"\n", append([]interface{}{name + ":"}, args...)...)
+	}
+
+	if c.ConfigFile != "" {
+		line("config file", "%s", c.ConfigFile)
+	}
+	line("root", "%s", c.Root)
+	var scopes []string
+	for scope := range c.PathRoots {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		line("root", "%s (for %s)", c.PathRoots[scope], scope)
+	}
+	if len(c.IndexFiles) > 0 {
+		line("index", "%s", strings.Join(c.IndexFiles, ", "))
+	}
+	var exts []string
+	for ext := range c.MIMETypes {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		line("mime", "%s %s", ext, c.MIMETypes[ext])
+	}
+	if c.User != "" || c.Group != "" {
+		line("run as", "user %q, group %q", c.User, c.Group)
+	}
+	if c.DisableSymlinks {
+		line("symlinks", "not followed")
+	}
+	if c.BindAddress != "" || c.Network != "" {
+		line("listen", "%s over %s", c.ListenAddress(), c.ListenNetwork())
+	}
+	if c.SocketMode != 0 {
+		line("socket mode", "%#o", c.SocketMode)
+	}
+	line("tls", "%s", c.TLS)
+	if c.ReadTimeout != 0 || c.WriteTimeout != 0 || c.IdleTimeout != 0 {
+		line("timeouts", "read %s, write %s, idle %s", c.ReadTimeout, c.WriteTimeout, c.IdleTimeout)
+	}
+	scopes = nil
+	for scope := range c.PathTimeouts {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		t := c.PathTimeouts[scope]
+		line("timeouts", "read %s, write %s (for %s)", t.Read, t.Write, scope)
+	}
+	if c.MaxConns != 0 {
+		line("max conns", "%d", c.MaxConns)
+	}
+	if len(c.Startup) > 0 || len(c.Shutdown) > 0 {
+		line("hooks", "%d startup, %d shutdown", len(c.Startup), len(c.Shutdown))
+	}
+	if len(c.BeforeRequest) > 0 || len(c.AfterRequest) > 0 {
+		line("request hooks", "%d before, %d after", len(c.BeforeRequest), len(c.AfterRequest))
+	}
+
+	scopes = nil
+	for scope := range c.Middleware {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		names := make([]string, len(c.Middleware[scope]))
+		for i := range names {
+			names[i] = "(unnamed)"
+			if i < len(c.MiddlewareNames[scope]) {
+				names[i] = c.MiddlewareNames[scope][i]
+			}
+		}
+		if len(names) > 0 {
+			line("middleware", "%s: %s", scope, strings.Join(names, ", "))
+		}
+	}
+
+	return b.String()
+}
+
+// MiddlewareChain returns the middleware that handle requests
+// for path, in the order they execute: those of each path scope
+// that path is in, from the most specific (longest) scope to the
+// least specific ("/"). Within a scope, middleware are in the
+// order their directives are registered (see middleware.go), no
+// matter where the directives appear in the configuration.
+func (c Config) MiddlewareChain(path string) []middleware.Middleware {
+	var scopes []string
+	for scope := range c.Middleware {
+		if middleware.Path(path).Matches(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Sort(byPrecedence(scopes))
+
+	var chain []middleware.Middleware
+	for _, scope := range scopes {
+		chain = append(chain, c.Middleware[scope]...)
+	}
+	return chain
+}
+
+// byPrecedence sorts path scopes from the most specific
+// to the least specific.
+type byPrecedence []string
+
+func (s byPrecedence) Len() int      { return len(s) }
+func (s byPrecedence) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPrecedence) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) > len(s[j])
+	}
+	return s[i] < s[j]
+}
+
+// RootFor returns the directory from which to serve
+// files for path: the root of the longest path scope in
+// c.PathRoots that path is in, or c.Root if there is
+// none. As with c.Root, the whole path is looked up
+// within that directory.
+func (c Config) RootFor(path string) string {
+	root, longest := c.Root, ""
+	for scope, scopeRoot := range c.PathRoots {
+		if middleware.Path(path).Matches(scope) && len(scope) > len(longest) {
+			root, longest = scopeRoot, scope
+		}
+	}
+	return root
+}
+
+// Timeouts are the read and write timeouts of requests in
+// a path scope, from a timeouts directive in its path block.
+// They are counted from when the request is handed to the
+// middleware, after its header is read, and replace the
+// deadlines that ReadTimeout and WriteTimeout set on the
+// connection for the rest of the request. Zero leaves that
+// timeout as it is. Since the deadlines are the connection's,
+// the server can only change them for HTTP/1 (which serves
+// one request at a time on a connection, and resets them
+// before the next one) and for HTTP/2 servers that support
+// deadlines for each stream; otherwise they are left as they
+// are.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// TimeoutsFor returns the timeouts of requests for path:
+// those of the longest path scope in c.PathTimeouts that
+// path is in, if there is one.
+func (c Config) TimeoutsFor(path string) (Timeouts, bool) {
+	var timeouts Timeouts
+	var longest string
+	var ok bool
+	for scope, scopeTimeouts := range c.PathTimeouts {
+		if middleware.Path(path).Matches(scope) && (!ok || len(scope) > len(longest)) {
+			timeouts, longest, ok = scopeTimeouts, scope, true
+		}
+	}
+	return timeouts, ok
+}
+
+// Indexes returns the names of the files to serve for a
+// directory, in order of preference: c.IndexFiles, or
+// browse.IndexPages if there are none.
+func (c Config) Indexes() []string {
+	if len(c.IndexFiles) > 0 {
+		return c.IndexFiles
+	}
+	return browse.IndexPages
+}
+
+// IsHostRoot returns whether root is a directory that
+// depends on the host of each request, because it has a
+// {host} or {label} placeholder in it; see HostRoot.
+func IsHostRoot(root string) bool {
+	return strings.Contains(root, "{host}") || strings.Contains(root, "{label}")
+}
+
+// HostRoot returns root with {host} replaced by host, without
+// its port, and {label} replaced by the first label of host
+// (e.g. "tenant" for "tenant.example.com"). Since host comes
+// from the request, it is only used if it is made of letters,
+// digits, hyphens, and dots between non-empty labels, so that
+// it can't name a directory outside of the rest of root; for
+// any other host, ok is false.
+func HostRoot(root, host string) (dir string, ok bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	labels := strings.Split(host, ".")
+	for _, label := range labels {
+		if label == "" {
+			return "", false
+		}
+		for _, ch := range label {
+			if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') && ch != '-' {
+				return "", false
+			}
+		}
+	}
+
+	dir = strings.Replace(root, "{host}", host, -1)
+	dir = strings.Replace(dir, "{label}", labels[0], -1)
+	return dir, true
+}
+
+// hostRootBase returns the directory that all the
+// directories root can be for any host are in.
+func hostRootBase(root string) string {
+	i := strings.Index(root, "{host}")
+	if j := strings.Index(root, "{label}"); i < 0 || (j >= 0 && j < i) {
+		i = j
+	}
+	return filepath.Dir(root[:i])
+}
+
+// ListenAddress returns the address to listen on
+// for c: its BindAddress and Port if BindAddress
+// is set, all interfaces if c.Host is a wildcard,
+// otherwise the same as Address (which is also the
+// case for a Unix socket).
+func (c Config) ListenAddress() string {
+	if c.Socket != "" {
+		return c.Address()
+	}
+	if c.BindAddress != "" {
+		return net.JoinHostPort(c.BindAddress, c.Port)
+	}
+	if IsWildcardHost(c.Host) {
+		return net.JoinHostPort("", c.Port)
+	}
+	return c.Address()
+}
+
+// ListenNetwork returns the network to listen on for c:
+// "unix" for a Unix socket, otherwise c.Network or "tcp"
+// if it is not set.
+func (c Config) ListenNetwork() string {
+	if c.Socket != "" {
+		return "unix"
+	}
+	if c.Network == "" {
+		return "tcp"
+	}
+	return c.Network
+}
+
+// IsCatchAllHost returns whether a site with the given
+// host serves requests for any host name: if host is
+// empty, "*", or an unspecified IP address ("0.0.0.0"
+// or "::").
+func IsCatchAllHost(host string) bool {
+	if host == "" || host == "*" {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	return ip != nil && ip.IsUnspecified()
+}
+
+// IsWildcardHost returns whether a site with the given
+// host serves requests for more than one host name: if
+// it is a catch-all (see IsCatchAllHost) or a pattern
+// like "*.example.com", which matches any subdomain of
+// example.com. When a request could go to more than one
+// site, an exact host beats a pattern, a longer pattern
+// beats a shorter one, and a catch-all comes last.
+func IsWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.") || IsCatchAllHost(host)
 }
 
 // TLSConfig describes how TLS should be configured and used,
@@ -62,43 +554,555 @@ type TLSConfig struct {
 	Enabled     bool
 	Certificate string
 	Key         string
+
+	// The PEM data of the certificate and key, in place of
+	// the Certificate and Key files, such as from environment
+	// variables; only one of the two ways may be used
+	CertificatePEM []byte
+	KeyPEM         []byte
+
+	// Additional certificate/key pairs, chosen from by
+	// the client's requested server name (SNI)
+	Certificates []CertificatePair
+
+	// The range of TLS protocol versions to support, as
+	// keys of SupportedProtocols (e.g. "tls1.2"). Empty
+	// values leave the Go defaults in place.
+	ProtocolMinVersion string
+	ProtocolMaxVersion string
+
+	// The cipher suites to offer; if empty, the Go
+	// defaults are used.
+	Ciphers []uint16
+
+	// Whether not to redirect plain HTTP requests on port 80
+	// to the site; see Load
+	DisableRedirect bool
+
+	// Whether not to offer HTTP/2, leaving clients to use
+	// HTTP/1.1; since it is negotiated before the site is
+	// known, it is off for all sites on the same address
+	// if any of them turns it off
+	DisableHTTP2 bool
+
+	// Whether to also serve the site over HTTP/3 (QUIC) on
+	// the same port over UDP, advertised to clients by the
+	// Alt-Svc header; experimental, and only available in
+	// builds with a QUIC implementation (see server.NewHTTP3Server)
+	HTTP3 bool
+
+	// Whether and how to authenticate clients by certificate:
+	// "request" verifies a certificate if the client sends one,
+	// "require" requires one but doesn't verify it, "verify"
+	// requires and verifies one, and empty doesn't ask for one.
+	// Like the protocol versions, the strictest mode of the
+	// sites on the same address applies to all of them.
+	ClientAuth string
+
+	// The files of the CA certificates which client
+	// certificates are verified against
+	ClientCAs []string
 }
 
+// clone returns a copy of t with its own slices.
+func (t TLSConfig) clone() TLSConfig {
+	clone := t
+	clone.CertificatePEM = append([]byte(nil), t.CertificatePEM...)
+	clone.KeyPEM = append([]byte(nil), t.KeyPEM...)
+	clone.Certificates = append([]CertificatePair(nil), t.Certificates...)
+	clone.Ciphers = append([]uint16(nil), t.Ciphers...)
+	clone.ClientCAs = append([]string(nil), t.ClientCAs...)
+	return clone
+}
+
+// ClientAuthModes are the values of TLSConfig.ClientAuth
+// accepted by the clients option of the tls directive.
+var ClientAuthModes = map[string]bool{
+	"request": true,
+	"require": true,
+	"verify":  true,
+}
+
+// LoadCertificates loads all the certificate/key pairs of t:
+// the inline one if there is one, then those in files (see
+// Pairs). It returns an error if both a Certificate or Key
+// file and PEM data are given.
+func (t TLSConfig) LoadCertificates() ([]tls.Certificate, error) {
+	var certs []tls.Certificate
+	if t.hasPEM() {
+		if t.Certificate != "" || t.Key != "" {
+			return nil, errors.New("TLS certificate and key are given both as files and as PEM data")
+		}
+		cert, err := tls.X509KeyPair(t.CertificatePEM, t.KeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	for _, pair := range t.Pairs() {
+		cert, err := tls.LoadX509KeyPair(pair.Certificate, pair.Key)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// hasPEM returns whether t has PEM data for
+// its certificate or key.
+func (t TLSConfig) hasPEM() bool {
+	return len(t.CertificatePEM) > 0 || len(t.KeyPEM) > 0
+}
+
+// ClientCAPool loads the certificates of t.ClientCAs into
+// a pool. It returns an error if a file can't be read or
+// has no certificates.
+func (t TLSConfig) ClientCAPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, filename := range t.ClientCAs {
+		pem, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in " + filename)
+		}
+	}
+	return pool, nil
+}
+
+// String returns a readable summary of t on one line,
+// or "off" if TLS is not enabled. Certificates and keys
+// are shown by file name.
+func (t TLSConfig) String() string {
+	if !t.Enabled {
+		return "off"
+	}
+
+	var parts []string
+	if t.hasPEM() {
+		parts = append(parts, "inline certificate and key")
+	}
+	for _, pair := range t.Pairs() {
+		parts = append(parts, pair.Certificate+" and "+pair.Key)
+	}
+	if t.ProtocolMinVersion != "" {
+		parts = append(parts, "protocols "+t.ProtocolMinVersion+" to "+t.ProtocolMaxVersion)
+	}
+	if len(t.Ciphers) > 0 {
+		var names []string
+		for _, cipher := range t.Ciphers {
+			for name, c := range SupportedCiphers {
+				if c == cipher {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		parts = append(parts, "ciphers "+strings.Join(names, " "))
+	}
+	if t.ClientAuth != "" {
+		clients := "client auth " + t.ClientAuth
+		if len(t.ClientCAs) > 0 {
+			clients += " against " + strings.Join(t.ClientCAs, " ")
+		}
+		parts = append(parts, clients)
+	}
+	if t.DisableRedirect {
+		parts = append(parts, "no HTTP redirect")
+	}
+	if t.DisableHTTP2 {
+		parts = append(parts, "no HTTP/2")
+	}
+	if t.HTTP3 {
+		parts = append(parts, "experimental HTTP/3")
+	}
+
+	return "on with " + strings.Join(parts, "; ")
+}
+
+// CertificatePair is the file path of a certificate
+// and the file path of its private key.
+type CertificatePair struct {
+	Certificate string
+	Key         string
+}
+
+// Pairs returns all the certificate/key files of t,
+// starting with its Certificate and Key, unless those
+// are given as PEM data instead.
+func (t TLSConfig) Pairs() []CertificatePair {
+	if t.hasPEM() && t.Certificate == "" && t.Key == "" {
+		return t.Certificates
+	}
+	pairs := []CertificatePair{{Certificate: t.Certificate, Key: t.Key}}
+	return append(pairs, t.Certificates...)
+}
+
+// SupportedProtocols maps the names of TLS protocol
+// versions accepted by the tls directive to their
+// crypto/tls version constants.
+var SupportedProtocols = map[string]uint16{
+	"tls1.0": tls.VersionTLS10,
+	"tls1.1": tls.VersionTLS11,
+	"tls1.2": tls.VersionTLS12,
+	"tls1.3": tls.VersionTLS13,
+}
+
+// SupportedCiphers maps the names of cipher suites
+// accepted by the tls directive to their crypto/tls
+// constants.
+var SupportedCiphers = map[string]uint16{
+	"ECDHE-RSA-AES128-GCM-SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-ECDSA-AES128-GCM-SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-RSA-AES256-GCM-SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-ECDSA-AES256-GCM-SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-RSA-CHACHA20-POLY1305":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"ECDHE-ECDSA-CHACHA20-POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"ECDHE-RSA-AES128-CBC-SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"ECDHE-RSA-AES256-CBC-SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"ECDHE-ECDSA-AES128-CBC-SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"ECDHE-ECDSA-AES256-CBC-SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"RSA-AES128-GCM-SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"RSA-AES256-GCM-SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"RSA-AES128-CBC-SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"RSA-AES256-CBC-SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"ECDHE-RSA-3DES-EDE-CBC-SHA":    tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"RSA-3DES-EDE-CBC-SHA":          tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+}
+
+// highestProtocol is the name of the highest TLS
+// protocol version in SupportedProtocols.
+const highestProtocol = "tls1.3"
+
 // Load loads a configuration file, parses it,
 // and returns a slice of Config structs which
 // can be used to create and configure server
-// instances.
+// instances. A file with the .json extension
+// is loaded as a JSON configuration (see
+// LoadJSON); any other file is a Caddyfile.
+//
+// Each HTTPS site on port 443 also gets a
+// Config that redirects HTTP requests on port
+// 80 to it, unless its TLS.DisableRedirect is
+// set (with "redirect off" in its tls block).
 func Load(filename string) ([]Config, error) {
+	cfgs, err := load(filename)
+	if err != nil {
+		return []Config{}, err
+	}
+	return appendRedirects(cfgs), nil
+}
+
+// LoadAll loads each of the configuration files, like Load,
+// as a configuration of its own (unlike import, which makes
+// a file part of another), and returns all of their Configs,
+// each with the ConfigFile it came from. It is an error for a
+// site to be defined in more than one of them, as it is for
+// one to be defined twice in the same file. The HTTP redirects
+// to HTTPS sites are added once all the files are loaded, so
+// that a site on port 80 in one file keeps an HTTPS site in
+// another from getting one.
+func LoadAll(filenames ...string) ([]Config, error) {
+	var all []Config
+	sites := make(map[string]Config) // by siteKey
+
+	for _, filename := range filenames {
+		cfgs, err := load(filename)
+		if err != nil {
+			return []Config{}, err
+		}
+		for _, cfg := range cfgs {
+			if other, ok := sites[siteKey(cfg)]; ok {
+				if strings.EqualFold(other.Address(), cfg.Address()) {
+					return []Config{}, fmt.Errorf("%s: Site %s is already defined in %s",
+						filename, cfg.Address(), other.ConfigFile)
+				}
+				return []Config{}, fmt.Errorf("%s: Site %s serves the same hosts on the same address as %s in %s",
+					filename, cfg.Address(), other.Address(), other.ConfigFile)
+			}
+		}
+		for _, cfg := range cfgs {
+			sites[siteKey(cfg)] = cfg
+		}
+		all = append(all, cfgs...)
+	}
+
+	return appendRedirects(all), nil
+}
+
+// load loads the configuration file filename like Load,
+// but without adding the redirects of appendRedirects.
+func load(filename string) ([]Config, error) {
+	// turn off timestamp for parsing
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer log.SetFlags(flags)
+
+	cfgs, err := parseFile(filename)
+	if err != nil {
+		return []Config{}, err
+	}
+	err = checkFiles(cfgs)
+	if err != nil {
+		return []Config{}, err
+	}
+	return cfgs, nil
+}
+
+// parseFile parses the configuration file filename, as
+// JSON if its extension is .json and as a Caddyfile if not.
+func parseFile(filename string) ([]Config, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
+	var input io.Reader = file
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		input, err = jsonCaddyfile(filename, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parse(filename, input)
+}
+
+// LoadReader parses the configuration from input and
+// returns a slice of Config structs which can be used
+// to create and configure server instances. The source
+// is a logical name for input (such as a file name) which
+// is used in error messages and set as each Config's
+// ConfigFile.
+func LoadReader(source string, input io.Reader) ([]Config, error) {
+	cfgs, err := loadReader(source, input)
+	if err != nil {
+		return []Config{}, err
+	}
+	return appendRedirects(cfgs), nil
+}
+
+// loadReader parses and checks the configuration from
+// input like LoadReader, but without adding the redirects
+// of appendRedirects.
+func loadReader(source string, input io.Reader) ([]Config, error) {
 	// turn off timestamp for parsing
 	flags := log.Flags()
 	log.SetFlags(0)
+	defer log.SetFlags(flags)
 
-	p, err := newParser(file)
+	cfgs, err := parse(source, input)
 	if err != nil {
-		return nil, err
+		return []Config{}, err
+	}
+	err = checkFiles(cfgs)
+	if err != nil {
+		return []Config{}, err
+	}
+	return cfgs, nil
+}
+
+// checkFiles returns the first error of checkTLSFiles
+// or checkPathRoots for any of cfgs.
+func checkFiles(cfgs []Config) error {
+	for _, cfg := range cfgs {
+		err := checkTLSFiles(cfg)
+		if err != nil {
+			return err
+		}
+
+		err = checkPathRoots(cfg)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// appendRedirects adds a config to cfgs for each HTTPS site on
+// the standard port, which redirects plain HTTP requests on port
+// 80 for the same host to it, keeping their path and query. Sites
+// with TLS.DisableRedirect set, or whose host is already served
+// on port 80 (such as by an http:// address in the same block),
+// don't get one.
+func appendRedirects(cfgs []Config) []Config {
+	plain := make(map[string]bool)
+	for _, cfg := range cfgs {
+		if !cfg.TLS.Enabled && (cfg.Port == "80" || cfg.Port == "http") {
+			plain[cfg.Host] = true
+		}
+	}
+
+	for _, cfg := range cfgs {
+		if !cfg.TLS.Enabled || cfg.TLS.DisableRedirect || plain[cfg.Host] ||
+			(cfg.Port != "443" && cfg.Port != "https") {
+			continue
+		}
+		plain[cfg.Host] = true
+
+		host := cfg.Host
+		if IsWildcardHost(host) {
+			host = "{hostname}"
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6
+		}
+		rules := []redirect.Rule{{From: "/", To: "https://" + host, Code: http.StatusMovedPermanently}}
+
+		cfgs = append(cfgs, Config{
+			Host:        cfg.Host,
+			Port:        "80",
+			BindAddress: cfg.BindAddress,
+			ConfigFile:  cfg.ConfigFile,
+			Middleware: map[string][]middleware.Middleware{
+				"/": {func(next middleware.Handler) middleware.Handler {
+					return redirect.Redirect{Next: next, Rules: rules}
+				}},
+			},
+			MiddlewareNames: map[string][]string{"/": {"redir"}},
+		})
+	}
+
+	return cfgs
+}
+
+// parse parses the configuration from input, setting
+// source as each Config's ConfigFile.
+func parse(source string, input io.Reader) ([]Config, error) {
+	p := &parser{filename: source, strict: StrictEnv}
+	p.lexer.load(input)
 
 	cfgs, err := p.parse()
 	if err != nil {
-		return []Config{}, err
+		return nil, err
 	}
 
 	for i := 0; i < len(cfgs); i++ {
-		cfgs[i].ConfigFile = filename
+		cfgs[i].ConfigFile = source
 	}
 
-	// restore logging settings
-	log.SetFlags(flags)
-
 	return cfgs, nil
 }
 
+// Validate checks that the configuration file is valid
+// without starting any servers or binding any sockets.
+// It is parsed as JSON if its extension is .json, like
+// Load does. Besides parsing it, Validate checks that each port is
+// in range, that each site root is a directory or a zip
+// archive that can be read, and that TLS certificate and
+// key files can be read. All problems found are returned
+// together; if the file can't be parsed, only the parse
+// error is returned.
+func Validate(filename string) error {
+	// turn off timestamp for parsing
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer log.SetFlags(flags)
+
+	cfgs, err := parseFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cfg := range cfgs {
+		if cfg.Socket == "" {
+			port, err := net.LookupPort("tcp", cfg.Port)
+			if err != nil || port < 0 || port > 65535 {
+				errs = append(errs, fmt.Errorf("Invalid port for %s: %s", cfg.Address(), cfg.Port))
+			}
+		}
+
+		if cfg.Root != "" {
+			root := cfg.Root
+			if IsHostRoot(root) {
+				root = hostRootBase(root)
+			}
+			info, err := os.Stat(root)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Invalid root for %s: %v", cfg.Address(), err))
+			} else if middleware.IsArchive(root) {
+				if _, err := middleware.OpenArchive(root); err != nil {
+					errs = append(errs, fmt.Errorf("Invalid root for %s: %s: %v", cfg.Address(), root, err))
+				}
+			} else if !info.IsDir() {
+				errs = append(errs, fmt.Errorf("Invalid root for %s: %s is not a directory", cfg.Address(), root))
+			}
+		}
+
+		err = checkTLSFiles(cfg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		err = checkPathRoots(cfg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkTLSFiles returns an error if any certificate or
+// key file that cfg will use can't be opened for reading,
+// if its inline certificate and key are invalid or given
+// along with files, or if a client CA file has no
+// certificates.
+func checkTLSFiles(cfg Config) error {
+	if !cfg.TLS.Enabled {
+		return nil
+	}
+	if cfg.TLS.hasPEM() {
+		if cfg.TLS.Certificate != "" || cfg.TLS.Key != "" {
+			return fmt.Errorf("Ambiguous TLS certificate for %s: given both as files and as PEM data", cfg.Address())
+		}
+		if _, err := tls.X509KeyPair(cfg.TLS.CertificatePEM, cfg.TLS.KeyPEM); err != nil {
+			return fmt.Errorf("Invalid inline TLS certificate for %s: %v", cfg.Address(), err)
+		}
+	}
+	for _, pair := range cfg.TLS.Pairs() {
+		for _, filename := range []string{pair.Certificate, pair.Key} {
+			file, err := os.Open(filename)
+			if err != nil {
+				return fmt.Errorf("Unable to read TLS file for %s: %v", cfg.Address(), err)
+			}
+			file.Close()
+		}
+	}
+	if _, err := cfg.TLS.ClientCAPool(); err != nil {
+		return fmt.Errorf("Unable to load client CA for %s: %v", cfg.Address(), err)
+	}
+	return nil
+}
+
+// checkPathRoots returns an error if the root of any
+// path scope of cfg is not a directory or an archive. For roots that
+// depend on the host, the directory they are in is
+// checked instead.
+func checkPathRoots(cfg Config) error {
+	for scope, root := range cfg.PathRoots {
+		if IsHostRoot(root) {
+			root = hostRootBase(root)
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("Invalid root for %s%s: %v", cfg.Address(), scope, err)
+		}
+		if middleware.IsArchive(root) {
+			if _, err := middleware.OpenArchive(root); err != nil {
+				return fmt.Errorf("Invalid root for %s%s: %s: %v", cfg.Address(), scope, root, err)
+			}
+			continue
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("Invalid root for %s%s: %s is not a directory", cfg.Address(), scope, root)
+		}
+	}
+	return nil
+}
+
 // IsNotFound returns whether or not the error is
 // one which indicates that the configuration file
 // was not found. (Useful for checking the error
@@ -107,16 +1111,47 @@ func IsNotFound(err error) bool {
 	return os.IsNotExist(err)
 }
 
+// LoadOrDefault is like Load, but if filename doesn't exist
+// or has no sites in it, it returns the Default configuration
+// instead, with ConfigFile set to filename so that it can be
+// reloaded from there once the file is created.
+func LoadOrDefault(filename string) ([]Config, error) {
+	cfgs, err := Load(filename)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	if len(cfgs) == 0 {
+		cfgs = Default()
+		for i := range cfgs {
+			cfgs[i].ConfigFile = filename
+		}
+	}
+	return cfgs, nil
+}
+
 // Default makes a default configuration
 // that's empty except for root, host, and port,
-// which are essential for serving the cwd.
+// which are essential for serving the cwd. Each
+// of these is taken from an environment variable
+// if it is set and not empty: HOST, PORT, and
+// SITE_ROOT respectively. Otherwise the defaults
+// (localhost, 2015, and the cwd) are used.
 func Default() []Config {
 	cfg := []Config{
 		Config{
-			Root: defaultRoot,
-			Host: defaultHost,
-			Port: defaultPort,
+			Root: envOr("SITE_ROOT", defaultRoot),
+			Host: envOr("HOST", defaultHost),
+			Port: envOr("PORT", defaultPort),
 		},
 	}
 	return cfg
 }
+
+// envOr returns the value of the environment
+// variable name, or def if it is unset or empty.
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,687 @@
+package config
+
+import (
+	"archive/zip"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestLoadReader(t *testing.T) {
+	flags := log.Flags()
+
+	input := `localhost:1234
+			  root /test/www`
+
+	confs, err := LoadReader("stdin", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 1 {
+		t.Fatalf("Expected 1 configuration, but got %d: %#v", len(confs), confs)
+	}
+	if confs[0].ConfigFile != "stdin" {
+		t.Errorf("Expected ConfigFile to be 'stdin', got '%s'", confs[0].ConfigFile)
+	}
+	if confs[0].Root != "/test/www" {
+		t.Errorf("Expected root to be '/test/www', got '%s'", confs[0].Root)
+	}
+	if log.Flags() != flags {
+		t.Errorf("Expected log flags to be restored to %d, got %d", flags, log.Flags())
+	}
+
+	_, err = LoadReader("stdin", strings.NewReader(`localhost:1234
+			  foobar`))
+	if err == nil {
+		t.Fatal("Expected an error for an invalid directive, but got none")
+	}
+	if !strings.Contains(err.Error(), "stdin:2") {
+		t.Errorf("Expected error message to contain source name and line 'stdin:2', got '%s'", err)
+	}
+	if log.Flags() != flags {
+		t.Errorf("Expected log flags to be restored to %d after error, got %d", flags, log.Flags())
+	}
+}
+
+func TestLoadReaderTLSFiles(t *testing.T) {
+	input := `localhost:443
+			  tls config_test.go config_test.go
+			  tls config_test.go nonexistent_key.pem`
+
+	_, err := LoadReader("test", strings.NewReader(input))
+	if err == nil {
+		t.Fatal("Expected an error for a missing key file, but got none")
+	}
+	if !strings.Contains(err.Error(), "nonexistent_key.pem") {
+		t.Errorf("Expected error to name the missing file, got '%s'", err)
+	}
+
+	input = `localhost:443
+			 tls config_test.go config_test.go`
+
+	_, err = LoadReader("test", strings.NewReader(input))
+	if err != nil {
+		t.Errorf("Expected no errors for readable files, but got '%s'", err)
+	}
+}
+
+func TestLoadReaderTLSInline(t *testing.T) {
+	certPEM, err := os.ReadFile("tls_cert_test.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile("tls_key_test.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CADDY_TEST_CERT", string(certPEM))
+	os.Setenv("CADDY_TEST_KEY", string(keyPEM))
+	defer os.Unsetenv("CADDY_TEST_CERT")
+	defer os.Unsetenv("CADDY_TEST_KEY")
+
+	input := `localhost:443
+			  tls tls_cert_test.pem tls_key_test.pem
+			  tls_inline {$CADDY_TEST_CERT} {$CADDY_TEST_KEY} {
+				  protocols tls1.2
+			  }`
+
+	confs, err := LoadReader("test", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	tlsConfig := confs[0].TLS
+	if string(tlsConfig.CertificatePEM) != string(certPEM) || string(tlsConfig.KeyPEM) != string(keyPEM) {
+		t.Error("Expected the PEM data to be that of the environment variables")
+	}
+	if tlsConfig.ProtocolMinVersion != "tls1.2" {
+		t.Errorf("Expected minimum protocol tls1.2, got '%s'", tlsConfig.ProtocolMinVersion)
+	}
+	if pairs := tlsConfig.Pairs(); len(pairs) != 1 || pairs[0].Certificate != "tls_cert_test.pem" {
+		t.Errorf("Expected the certificate file to be an additional pair, got %#v", pairs)
+	}
+	certs, err := tlsConfig.LoadCertificates()
+	if err != nil {
+		t.Fatalf("Expected no errors loading certificates, but got '%s'", err)
+	}
+	if len(certs) != 2 {
+		t.Errorf("Expected 2 certificates, got %d", len(certs))
+	}
+
+	input = `localhost:443
+			 tls_inline "not a certificate" {$CADDY_TEST_KEY}`
+	_, err = LoadReader("test", strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "Invalid inline TLS certificate") {
+		t.Errorf("Expected an error for invalid PEM data, got '%v'", err)
+	}
+
+	_, err = TLSConfig{Enabled: true, Certificate: "tls_cert_test.pem", Key: "tls_key_test.pem",
+		CertificatePEM: certPEM, KeyPEM: keyPEM}.LoadCertificates()
+	if err == nil {
+		t.Error("Expected an error for both files and PEM data, but got none")
+	}
+}
+
+func TestLoadReaderHTTPSRedirect(t *testing.T) {
+	confs, err := LoadReader("test", strings.NewReader(`localhost:443
+			  tls config_test.go config_test.go`))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 2 {
+		t.Fatalf("Expected 2 configurations, but got %d", len(confs))
+	}
+	if confs[1].Address() != "localhost:80" || confs[1].TLS.Enabled {
+		t.Fatalf("Expected plain HTTP redirect config for localhost:80, got %#v", confs[1])
+	}
+
+	var stack middleware.Handler = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		t.Error("Expected redirect not to serve content")
+		return 0, nil
+	})
+	for _, mid := range confs[1].Middleware["/"] {
+		stack = mid(stack)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost/docs/page.html?x=1", nil)
+	rec := httptest.NewRecorder()
+	stack.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected status %d, got %d", http.StatusMovedPermanently, rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "https://localhost/docs/page.html?x=1" {
+		t.Errorf("Expected redirect to 'https://localhost/docs/page.html?x=1', got '%s'", loc)
+	}
+
+	for i, input := range []string{
+		`localhost:443
+		 tls config_test.go config_test.go {
+			 redirect off
+		 }`,
+		`localhost:8443
+		 tls config_test.go config_test.go`,
+		`localhost:443 {
+			 tls config_test.go config_test.go
+		 }
+		 http://localhost {
+			 root .
+		 }`,
+	} {
+		confs, err := LoadReader("test", strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		for _, conf := range confs {
+			if conf.Port == "80" {
+				t.Errorf("Test %d: Expected no redirect config, got %#v", i, conf)
+			}
+		}
+	}
+}
+
+func TestLoadReaderPathRoots(t *testing.T) {
+	input := `localhost:1234
+			  /downloads {
+				  root /nonexistent/downloads
+			  }`
+
+	_, err := LoadReader("test", strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "/nonexistent/downloads") {
+		t.Errorf("Expected an error naming the missing root, got '%v'", err)
+	}
+
+	input = `localhost:1234
+			 /downloads {
+				 root .
+			 }`
+
+	_, err = LoadReader("test", strings.NewReader(input))
+	if err != nil {
+		t.Errorf("Expected no errors for an existing root, but got '%s'", err)
+	}
+}
+
+func TestHostRoot(t *testing.T) {
+	for i, test := range []struct {
+		root, host, expected string
+		ok                   bool
+	}{
+		{"/sites/{host}", "example.com", "/sites/example.com", true},
+		{"/sites/{host}", "Example.COM.:8080", "/sites/example.com", true},
+		{"/sites/{label}/public", "tenant.example.com", "/sites/tenant/public", true},
+		{"/sites/{label}-{host}", "a.b", "/sites/a-a.b", true},
+		{"/sites/{host}", "..", "", false},
+		{"/sites/{host}", "a..b", "", false},
+		{"/sites/{host}", ".hidden", "", false},
+		{"/sites/{host}", "../etc", "", false},
+		{"/sites/{host}", "a/b", "", false},
+		{"/sites/{host}", `a\b`, "", false},
+		{"/sites/{host}", "[::1]:80", "", false},
+		{"/sites/{host}", "", "", false},
+	} {
+		dir, ok := HostRoot(test.root, test.host)
+		if ok != test.ok || dir != test.expected {
+			t.Errorf("Test %d: Expected '%s', %v for host '%s', got '%s', %v", i, test.expected, test.ok, test.host, dir, ok)
+		}
+	}
+
+	input := `localhost:1234
+			  /tenants {
+				  root ./{label}
+			  }`
+	_, err := LoadReader("test", strings.NewReader(input))
+	if err != nil {
+		t.Errorf("Expected the directory of a host root to be checked, but got '%s'", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	err := Validate("validate_test.txt")
+	if err == nil {
+		t.Fatal("Expected errors for an invalid configuration, but got none")
+	}
+	for _, expected := range []string{"99999", "/nonexistent/root", "nonexistent_cert.pem"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected errors to mention '%s', got '%s'", expected, err)
+		}
+	}
+
+	err = Validate("validate_valid_test.txt")
+	if err != nil {
+		t.Errorf("Expected no errors for a valid configuration, but got '%s'", err)
+	}
+
+	err = Validate("nonexistent_test.txt")
+	if !IsNotFound(err) {
+		t.Errorf("Expected a not found error for a missing file, got '%v'", err)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	dir := t.TempDir()
+	for i, test := range []struct {
+		json     string
+		expected []string // in the error; none if valid
+	}{
+		{`[{"host": "localhost", "port": "8080", "root": "."}]`, nil},
+		{`[{"host": "localhost", "port": "99999", "root": "/nonexistent/root",
+			"tls": {"certificate": "nonexistent_cert.pem", "key": "nonexistent_key.pem"}}]`,
+			[]string{"99999", "/nonexistent/root", "nonexistent_cert.pem"}},
+		{`[{"host": "localhost", "directives": [{"name": "foobar"}]}]`, []string{"caddy.json", "foobar"}},
+	} {
+		filename := filepath.Join(dir, "caddy.json")
+		err := os.WriteFile(filename, []byte(test.json), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Validate(filename)
+		if test.expected == nil {
+			if err != nil {
+				t.Errorf("Test %d: Expected no errors for a valid JSON configuration, but got '%s'", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Test %d: Expected errors for an invalid JSON configuration, but got none", i)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Test %d: Expected errors to mention '%s', got '%s'", i, expected, err)
+			}
+		}
+	}
+}
+
+func TestValidateArchiveRoot(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := os.Create(filepath.Join(dir, "site.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(archive)
+	w, err := zw.Create("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("<h1>Hello</h1>"))
+	zw.Close()
+	archive.Close()
+
+	err = os.WriteFile(filepath.Join(dir, "broken.zip"), []byte("not a zip"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		root  string
+		valid bool
+	}{
+		{"site.zip", true},
+		{"broken.zip", false},
+		{"missing.zip", false},
+	} {
+		caddyfile := filepath.Join(dir, "Caddyfile")
+		err := os.WriteFile(caddyfile, []byte("localhost:8080\nroot "+filepath.Join(dir, test.root)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Validate(caddyfile)
+		if test.valid && err != nil {
+			t.Errorf("Test %d: Expected no errors for root %s, but got '%s'", i, test.root, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Test %d: Expected an error for root %s, but got none", i, test.root)
+		}
+	}
+}
+
+func TestTLSConfigClientCAPool(t *testing.T) {
+	pool, err := TLSConfig{ClientCAs: []string{"client_ca_test.pem"}}.ClientCAPool()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if pool == nil {
+		t.Fatal("Expected a pool of client CAs, but got nil")
+	}
+
+	// A file without any certificates in it
+	_, err = TLSConfig{ClientCAs: []string{"validate_test.txt"}}.ClientCAPool()
+	if err == nil || !strings.Contains(err.Error(), "validate_test.txt") {
+		t.Errorf("Expected an error naming the file without certificates, got '%v'", err)
+	}
+
+	_, err = TLSConfig{ClientCAs: []string{"nonexistent_ca.pem"}}.ClientCAPool()
+	if err == nil {
+		t.Error("Expected an error for a missing file, but got none")
+	}
+}
+
+func TestConfigString(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`localhost:443
+		root /www
+		tls cert.pem key.pem {
+			protocols tls1.2
+			redirect off
+		}
+		gzip
+		/api {
+			internal /api/private
+		}`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+
+	str := confs[0].String()
+	for _, expected := range []string{
+		"localhost:443\n",
+		"root:        /www\n",
+		"tls:         on with cert.pem and key.pem; protocols tls1.2 to tls1.3; no HTTP redirect\n",
+		"middleware:  /: gzip\n",
+		"middleware:  /api: internal\n",
+	} {
+		if !strings.Contains(str, expected) {
+			t.Errorf("Expected string to contain %q, got:\n%s", expected, str)
+		}
+	}
+
+	if str := (TLSConfig{}).String(); str != "off" {
+		t.Errorf("Expected disabled TLS to be 'off', got '%s'", str)
+	}
+}
+
+func TestConfigAddStartup(t *testing.T) {
+	noop := func() error { return nil }
+	cfg := Config{Startup: []func() error{noop}} // added in code, without a name
+	cfg.AddStartup("first", noop)
+
+	// Copies mustn't share what is added to them
+	other := cfg
+	cfg.AddStartup("second", noop)
+	other.AddStartup("other", noop)
+
+	if expected := []string{"", "first", "second"}; !reflect.DeepEqual(cfg.StartupNames, expected) || len(cfg.Startup) != 3 {
+		t.Errorf("Expected startup names %v for 3 functions, got %v for %d", expected, cfg.StartupNames, len(cfg.Startup))
+	}
+	if expected := []string{"", "first", "other"}; !reflect.DeepEqual(other.StartupNames, expected) || len(other.Startup) != 3 {
+		t.Errorf("Expected startup names %v for 3 functions of the copy, got %v for %d", expected, other.StartupNames, len(other.Startup))
+	}
+}
+
+func TestConfigClone(t *testing.T) {
+	noop := func() error { return nil }
+	mid := func(next middleware.Handler) middleware.Handler { return next }
+	cfg := Config{
+		PathRoots:       map[string]string{"/docs": "/www/docs"},
+		IndexFiles:      []string{"index.html"},
+		MIMETypes:       map[string]string{".wasm": "application/wasm"},
+		Middleware:      map[string][]middleware.Middleware{"/": {mid}},
+		MiddlewareNames: map[string][]string{"/": {"gzip"}},
+		Startup:         []func() error{noop},
+		StartupNames:    []string{"first"},
+		TLS:             TLSConfig{Ciphers: []uint16{1}, ClientCAs: []string{"ca.pem"}},
+	}
+
+	clone := cfg.Clone()
+	if !reflect.DeepEqual(clone.PathRoots, cfg.PathRoots) || !reflect.DeepEqual(clone.TLS, cfg.TLS) ||
+		len(clone.Middleware["/"]) != 1 || len(clone.Startup) != 1 {
+		t.Fatalf("Expected the clone to have the same values, got %+v", clone)
+	}
+
+	clone.PathRoots["/docs"] = "/elsewhere"
+	clone.IndexFiles[0] = "default.html"
+	clone.MIMETypes[".wasm"] = "text/plain"
+	clone.Middleware["/"] = append(clone.Middleware["/"], mid)
+	clone.MiddlewareNames["/"][0] = "log"
+	clone.Startup[0] = nil
+	clone.StartupNames[0] = "other"
+	clone.TLS.Ciphers[0] = 2
+	clone.TLS.ClientCAs[0] = "other.pem"
+
+	if cfg.PathRoots["/docs"] != "/www/docs" || cfg.IndexFiles[0] != "index.html" || cfg.MIMETypes[".wasm"] != "application/wasm" {
+		t.Errorf("Expected the original's roots, index files, and MIME types unchanged, got %v, %v, %v",
+			cfg.PathRoots, cfg.IndexFiles, cfg.MIMETypes)
+	}
+	if len(cfg.Middleware["/"]) != 1 || cfg.MiddlewareNames["/"][0] != "gzip" {
+		t.Errorf("Expected the original's middleware unchanged, got %d named %v", len(cfg.Middleware["/"]), cfg.MiddlewareNames["/"])
+	}
+	if cfg.Startup[0] == nil || cfg.StartupNames[0] != "first" {
+		t.Errorf("Expected the original's startup functions unchanged, got names %v", cfg.StartupNames)
+	}
+	if cfg.TLS.Ciphers[0] != 1 || cfg.TLS.ClientCAs[0] != "ca.pem" {
+		t.Errorf("Expected the original's TLS config unchanged, got %+v", cfg.TLS)
+	}
+}
+
+func TestConfigAddress(t *testing.T) {
+	for i, test := range []struct {
+		host, expected string
+	}{
+		{"127.0.0.1", "127.0.0.1:80"},
+		{"::1", "[::1]:80"},
+		{"[::1]", "[::1]:80"},
+		{"::", "[::]:80"},
+		{"example.com", "example.com:80"},
+		{"", ":80"},
+	} {
+		cfg := Config{Host: test.host, Port: "80"}
+		if actual := cfg.Address(); actual != test.expected {
+			t.Errorf("Test %d: Expected address '%s' for host '%s', got '%s'", i, test.expected, test.host, actual)
+		}
+	}
+}
+
+func TestLoadOrDefault(t *testing.T) {
+	cfgs, err := LoadOrDefault("nonexistent_test.txt")
+	if err != nil {
+		t.Fatalf("Expected no errors for a missing file, but got '%s'", err)
+	}
+	if len(cfgs) != 1 {
+		t.Fatalf("Expected the default configuration, but got %d configurations", len(cfgs))
+	}
+	if cfgs[0].ConfigFile != "nonexistent_test.txt" {
+		t.Errorf("Expected ConfigFile to be 'nonexistent_test.txt', got '%s'", cfgs[0].ConfigFile)
+	}
+
+	cfgs, err = LoadOrDefault("validate_valid_test.txt")
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if cfgs[0].ConfigFile != "validate_valid_test.txt" {
+		t.Errorf("Expected the configuration from the file, got one from '%s'", cfgs[0].ConfigFile)
+	}
+
+	_, err = LoadOrDefault("validate_test.txt")
+	if err == nil {
+		t.Error("Expected an error for an invalid configuration, but got none")
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"blog":      "blog.example.com:8080\nroot /www/blog",
+		"shop.json": `[{"host": "shop.example.com", "port": "8080", "root": "/www/shop"}]`,
+		"again":     "blog.example.com:8080\nroot /www/other",
+		"https":     "localhost:443\ntls " + filepath.Join(dir, "https") + " " + filepath.Join(dir, "https"),
+		"plain":     "http://localhost\nroot /www/plain",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	cfgs, err := LoadAll(file("blog"), file("shop.json"))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(cfgs) != 2 {
+		t.Fatalf("Expected 2 configurations, but got %d", len(cfgs))
+	}
+	if cfgs[0].Host != "blog.example.com" || cfgs[0].ConfigFile != file("blog") {
+		t.Errorf("Expected blog.example.com from %s, got %s from %s", file("blog"), cfgs[0].Host, cfgs[0].ConfigFile)
+	}
+	if cfgs[1].Host != "shop.example.com" || cfgs[1].ConfigFile != file("shop.json") {
+		t.Errorf("Expected shop.example.com from %s, got %s from %s", file("shop.json"), cfgs[1].Host, cfgs[1].ConfigFile)
+	}
+
+	_, err = LoadAll(file("blog"), file("again"))
+	if err == nil {
+		t.Fatal("Expected an error for a site defined in two files, but got none")
+	}
+	if !strings.Contains(err.Error(), file("again")) || !strings.Contains(err.Error(), file("blog")) {
+		t.Errorf("Expected error to name both files, got '%s'", err)
+	}
+
+	// The redirect of an HTTPS site is left out if another
+	// file serves its host on port 80
+	cfgs, err = LoadAll(file("https"))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(cfgs) != 2 {
+		t.Errorf("Expected a redirect configuration for the HTTPS site, but got %d configurations", len(cfgs))
+	}
+	cfgs, err = LoadAll(file("https"), file("plain"))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(cfgs) != 2 || cfgs[1].Root != "/www/plain" {
+		t.Errorf("Expected just the HTTPS site and the plain one, got %v", cfgs)
+	}
+
+	_, err = LoadAll(file("blog"), file("missing"))
+	if !IsNotFound(err) {
+		t.Errorf("Expected a not found error for a missing file, got '%v'", err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	for _, name := range []string{"HOST", "PORT", "SITE_ROOT"} {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+
+	cfg := Default()[0]
+	if cfg.Host != defaultHost || cfg.Port != defaultPort || cfg.Root != defaultRoot {
+		t.Errorf("Expected defaults %s:%s with root '%s', got %s:%s with root '%s'",
+			defaultHost, defaultPort, defaultRoot, cfg.Host, cfg.Port, cfg.Root)
+	}
+
+	os.Setenv("HOST", "0.0.0.0")
+	os.Setenv("PORT", "5000")
+	os.Setenv("SITE_ROOT", "/srv/www")
+
+	cfg = Default()[0]
+	if cfg.Host != "0.0.0.0" || cfg.Port != "5000" || cfg.Root != "/srv/www" {
+		t.Errorf("Expected 0.0.0.0:5000 with root '/srv/www' from environment, got %s:%s with root '%s'",
+			cfg.Host, cfg.Port, cfg.Root)
+	}
+
+	os.Setenv("PORT", "")
+
+	cfg = Default()[0]
+	if cfg.Port != defaultPort {
+		t.Errorf("Expected empty PORT to fall back to '%s', got '%s'", defaultPort, cfg.Port)
+	}
+}
+
+func TestDefaultFile(t *testing.T) {
+	t.Setenv(ConfigFileEnv, "")
+	if file := DefaultFile(); file != DefaultConfigFile {
+		t.Errorf("Expected '%s' without %s set, got '%s'", DefaultConfigFile, ConfigFileEnv, file)
+	}
+
+	t.Setenv(ConfigFileEnv, "/etc/caddy/Caddyfile")
+	if file := DefaultFile(); file != "/etc/caddy/Caddyfile" {
+		t.Errorf("Expected '/etc/caddy/Caddyfile' from %s, got '%s'", ConfigFileEnv, file)
+	}
+}
+
+func TestConfigMiddlewareChain(t *testing.T) {
+	var order []string
+	named := func(name string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				order = append(order, name)
+				return next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	cfg := Config{
+		Middleware: map[string][]middleware.Middleware{
+			"/":       {named("log"), named("gzip")},
+			"/api":    {named("header")},
+			"/api/v1": {named("rewrite")},
+			"/other":  {named("browse")},
+		},
+	}
+
+	for i, test := range []struct {
+		path     string
+		expected []string
+	}{
+		{"/", []string{"log", "gzip"}},
+		{"/api/v1/users", []string{"rewrite", "header", "log", "gzip"}},
+		{"/api/v2", []string{"header", "log", "gzip"}},
+		{"/other", []string{"browse", "log", "gzip"}},
+	} {
+		var stack middleware.Handler = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return 0, nil
+		})
+		chain := cfg.MiddlewareChain(test.path)
+		for j := len(chain) - 1; j >= 0; j-- {
+			stack = chain[j](stack)
+		}
+
+		order = nil
+		stack.ServeHTTP(nil, nil)
+		if !reflect.DeepEqual(order, test.expected) {
+			t.Errorf("Test %d (%s): Expected middleware order %v, got %v", i, test.path, test.expected, order)
+		}
+	}
+}
+
+func TestConfigWildcardHosts(t *testing.T) {
+	for i, test := range []struct {
+		host             string
+		catchAll, wild   bool
+		expectedListener string
+	}{
+		{"example.com", false, false, "example.com:80"},
+		{"127.0.0.1", false, false, "127.0.0.1:80"},
+		{"*.example.com", false, true, ":80"},
+		{"*", true, true, ":80"},
+		{"", true, true, ":80"},
+		{"0.0.0.0", true, true, ":80"},
+		{"::", true, true, ":80"},
+	} {
+		if actual := IsCatchAllHost(test.host); actual != test.catchAll {
+			t.Errorf("Test %d (%s): Expected IsCatchAllHost to be %v, got %v", i, test.host, test.catchAll, actual)
+		}
+		if actual := IsWildcardHost(test.host); actual != test.wild {
+			t.Errorf("Test %d (%s): Expected IsWildcardHost to be %v, got %v", i, test.host, test.wild, actual)
+		}
+		cfg := Config{Host: test.host, Port: "80"}
+		if actual := cfg.ListenAddress(); actual != test.expectedListener {
+			t.Errorf("Test %d (%s): Expected listen address '%s', got '%s'", i, test.host, test.expectedListener, actual)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package config
 
-import "github.com/mholt/caddy/middleware"
+import (
+	"net/http"
+
+	"github.com/mholt/caddy/middleware"
+)
 
 // controller is a dispenser of tokens and also
 // facilitates setup with the server by providing
@@ -10,6 +14,7 @@ type controller struct {
 	dispenser
 	parser    *parser
 	pathScope string
+	usedRoot  bool // whether the middleware asked for the root
 }
 
 // newController returns a new controller.
@@ -23,23 +28,73 @@ func newController(p *parser) *controller {
 	}
 }
 
-// Startup registers a function to execute when the server starts.
+// Startup registers a function to execute when the server starts,
+// named after the directive.
 func (c *controller) Startup(fn func() error) {
-	c.parser.cfg.Startup = append(c.parser.cfg.Startup, fn)
+	c.parser.cfg.AddStartup(c.directive(), fn)
 }
 
-// Shutdown registers a function to execute when the server exits.
+// Shutdown registers a function to execute when the server exits,
+// named after the directive.
 func (c *controller) Shutdown(fn func() error) {
-	c.parser.cfg.Shutdown = append(c.parser.cfg.Shutdown, fn)
+	c.parser.cfg.AddShutdown(c.directive(), fn)
+}
+
+// directive returns the name of the controller's directive.
+func (c *controller) directive() string {
+	if len(c.tokens) == 0 {
+		return ""
+	}
+	return c.tokens[0].text
 }
 
-// Root returns the server root file path.
+// Root returns the server root file path for
+// the controller's path scope.
 func (c *controller) Root() string {
-	if c.parser.cfg.Root == "" {
+	c.usedRoot = true
+	root := c.parser.cfg.RootFor(c.pathScope)
+	if root == "" {
 		return "."
 	} else {
-		return c.parser.cfg.Root
+		return root
+	}
+}
+
+// checkRoot returns an error if the middleware asked for the
+// root and the root has a {host} or {label} placeholder: it is
+// only resolved for each request by the file server, so the
+// middleware would look for files under the placeholder itself.
+func (c *controller) checkRoot() error {
+	if !c.usedRoot || !IsHostRoot(c.parser.cfg.RootFor(c.pathScope)) {
+		return nil
 	}
+	return &ParseError{
+		Filename: c.filename,
+		Line:     c.tokens[0].line,
+		Column:   c.tokens[0].column,
+		Kind:     "Parse",
+		Message:  "The " + c.directive() + " directive can't be used with a root that has {host} or {label} in it",
+	}
+}
+
+// FileSystem returns the files of the root for the
+// controller's path scope, which the config may have
+// replaced with another file system.
+func (c *controller) FileSystem() (http.FileSystem, error) {
+	if fs := c.parser.cfg.FileSystem; fs != nil {
+		return fs, nil
+	}
+	root := c.Root()
+	if middleware.IsArchive(root) {
+		return middleware.OpenArchive(root)
+	}
+	return http.Dir(root), nil
+}
+
+// IndexFiles returns the names of the files to serve
+// for a directory, in order of preference.
+func (c *controller) IndexFiles() []string {
+	return c.parser.cfg.Indexes()
 }
 
 // Context returns the path scope that the Controller is in.
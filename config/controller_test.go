@@ -1,6 +1,10 @@
 package config
 
-import "testing"
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
 
 func TestController(t *testing.T) {
 	p := &parser{filename: "test"}
@@ -35,3 +39,25 @@ func TestController(t *testing.T) {
 		t.Errorf("Expected context to be '%s', got '%s'", c.pathScope, context)
 	}
 }
+
+func TestControllerFileSystem(t *testing.T) {
+	c := newController(&parser{filename: "test"})
+	c.parser.cfg.Root = "foobar/test"
+
+	fs, err := c.FileSystem()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if dir, ok := fs.(http.Dir); !ok || dir != "foobar/test" {
+		t.Errorf("Expected the directory of the root, got %#v", fs)
+	}
+
+	c.parser.cfg.FileSystem = http.FS(fstest.MapFS{"file.txt": {Data: []byte("Hello, world!")}})
+	fs, err = c.FileSystem()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := fs.Open("/file.txt"); err != nil {
+		t.Errorf("Expected the file system of the config, but opening a file in it failed: %v", err)
+	}
+}
@@ -1,12 +1,55 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
 )
 
+// repeatableDirectives are the directives, built-in or
+// middleware, that may appear more than once in the same
+// server block and path scope; any other directive that
+// appears again is an error. Directives registered with
+// RegisterDirective are added under registry.mu.
+var repeatableDirectives = map[string]bool{
+	"import":    true,
+	"tls":       true,
+	"mime":      true,
+	"startup":   true,
+	"shutdown":  true,
+	"realip":    true,
+	"log":       true,
+	"status":    true,
+	"errors":    true,
+	"header":    true,
+	"internal":  true,
+	"cors":      true,
+	"methods":   true,
+	"ratelimit": true,
+	"limit":     true,
+	"rewrite":   true,
+	"redir":     true,
+	"ext":       true,
+	"languages": true,
+	"basicauth": true,
+	"cache":     true,
+	"replace":   true,
+	"jsonp":     true,
+	"proxy":     true,
+	"fastcgi":   true,
+	"websocket": true,
+	"markdown":  true,
+	"templates": true,
+	"browse":    true,
+	"fallback":  true,
+}
+
 // dirFunc is a type of parsing function which processes
 // a particular directive and populates the config.
 type dirFunc func(*parser) error
@@ -27,99 +70,462 @@ func init() {
 			if !p.nextArg() {
 				return p.argErr()
 			}
+			// Inside a path block, root applies to just that path
+			if p.scope != nil && p.scope.path != "/" {
+				if p.cfg.PathRoots == nil {
+					p.cfg.PathRoots = make(map[string]string)
+				}
+				p.cfg.PathRoots[p.scope.path] = p.tkn()
+				return nil
+			}
 			p.cfg.Root = p.tkn()
 			return nil
 		},
-		"import": func(p *parser) error {
+		"index": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			p.cfg.IndexFiles = []string{p.tkn()}
+			for p.nextArg() {
+				p.cfg.IndexFiles = append(p.cfg.IndexFiles, p.tkn())
+			}
+			return nil
+		},
+		"follow_symlinks": func(p *parser) error {
 			if !p.nextArg() {
 				return p.argErr()
 			}
+			switch p.tkn() {
+			case "on":
+				p.cfg.DisableSymlinks = false
+			case "off":
+				p.cfg.DisableSymlinks = true
+			default:
+				return p.err("Parse", "Expected 'on' or 'off' for follow_symlinks, got '"+p.tkn()+"'")
+			}
+			return nil
+		},
+		"mime": func(p *parser) error {
+			addType := func() error {
+				ext := strings.ToLower(p.tkn())
+				if !strings.HasPrefix(ext, ".") || len(ext) == 1 {
+					return p.err("Parse", "Invalid extension '"+p.tkn()+"' - must start with a dot, like .wasm")
+				}
+				if !p.nextArg() {
+					return p.argErr()
+				}
+				if p.cfg.MIMETypes == nil {
+					p.cfg.MIMETypes = make(map[string]string)
+				}
+				p.cfg.MIMETypes[ext] = p.tkn()
+				return nil
+			}
 
-			filename := p.tkn()
-			file, err := os.Open(filename)
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			if p.tkn() != "{" {
+				return addType()
+			}
+
+			// A block has a mapping on each line
+			for p.next() {
+				if p.tkn() == "}" {
+					return nil
+				}
+				err := addType()
+				if err != nil {
+					return err
+				}
+			}
+			return p.eofErr()
+		},
+		"bind": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			addr, err := checkBindAddress(p.tkn())
 			if err != nil {
 				return p.err("Parse", err.Error())
 			}
-			defer file.Close()
-			p2, err := newParser(file)
-			if err != nil {
-				return p.err("Parse", "Could not import "+filename+"; "+err.Error())
+			p.cfg.BindAddress = addr
+			return nil
+		},
+		"user": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			p.cfg.User = p.tkn()
+			return nil
+		},
+		"group": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			p.cfg.Group = p.tkn()
+			return nil
+		},
+		"network": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			if err := checkNetwork(p.tkn()); err != nil {
+				return p.err("Parse", err.Error())
+			}
+			p.cfg.Network = p.tkn()
+			return nil
+		},
+		"socket_mode": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			mode, err := strconv.ParseUint(p.tkn(), 8, 32)
+			if err != nil || mode == 0 || mode > 0777 {
+				return p.err("Parse", "Invalid socket mode '"+p.tkn()+"'; expected octal permissions like 0660")
+			}
+			p.cfg.SocketMode = os.FileMode(mode)
+			return nil
+		},
+		"import": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+
+			// A snippet defined earlier takes precedence over files
+			if _, ok := p.snippets[p.tkn()]; ok {
+				return p.importSnippet(p.tkn())
 			}
 
-			p2.cfg = p.cfg
-			err = p2.directives()
+			// Paths are relative to the importing file
+			pattern := p.tkn()
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(p.filename), pattern)
+			}
+
+			filenames, err := filepath.Glob(pattern)
 			if err != nil {
-				return err
+				return p.err("Parse", err.Error())
+			}
+			if len(filenames) == 0 && !strings.ContainsAny(pattern, "*?[") {
+				filenames = []string{pattern} // not a glob, so it must exist
+			}
+
+			for _, filename := range filenames {
+				err := p.importFile(filename)
+				if err != nil {
+					return err
+				}
 			}
-			p.cfg = p2.cfg
 
 			return nil
 		},
 		"tls": func(p *parser) error {
-			tls := TLSConfig{Enabled: true}
+			// Each additional tls line adds another certificate
+			// and key to those already configured for these hosts
+			tls := p.cfg.TLS
+			var pair CertificatePair
 
 			if !p.nextArg() {
 				return p.argErr()
 			}
-			tls.Certificate = p.tkn()
+			pair.Certificate = p.tkn()
 
 			if !p.nextArg() {
+				// "tls off" serves these hosts over plain HTTP, even
+				// if TLS was turned on before, such as by an import
+				if pair.Certificate == "off" {
+					p.cfg.TLS = TLSConfig{}
+					return nil
+				}
 				return p.argErr()
 			}
-			tls.Key = p.tkn()
+			pair.Key = p.tkn()
+
+			if tls.Enabled {
+				tls.Certificates = append(tls.Certificates, pair)
+			} else {
+				tls.Enabled = true
+				tls.Certificate = pair.Certificate
+				tls.Key = pair.Key
+			}
+
+			// Optional block with more TLS settings
+			if p.nextArg() {
+				err := tlsBlock(p, &tls)
+				if err != nil {
+					return err
+				}
+			}
 
 			p.cfg.TLS = tls
 			return nil
 		},
-		"startup": func(p *parser) error {
-			// TODO: This code is duplicated with the shutdown directive below
+		"tls_inline": func(p *parser) error {
+			// Like tls, but with the PEM data of the certificate
+			// and key, usually from environment variables
+			tls := p.cfg.TLS
 
 			if !p.nextArg() {
 				return p.argErr()
 			}
+			certificate := p.tkn()
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			key := p.tkn()
 
-			command, args, err := middleware.SplitCommandAndArgs(p.tkn())
-			if err != nil {
-				return p.err("Parse", err.Error())
+			// Files from tls directives before this one are
+			// additional certificates, as they would be after it
+			if tls.Enabled {
+				tls.Certificates = append([]CertificatePair{{tls.Certificate, tls.Key}}, tls.Certificates...)
+				tls.Certificate, tls.Key = "", ""
 			}
+			tls.Enabled = true
+			tls.CertificatePEM, tls.KeyPEM = []byte(certificate), []byte(key)
 
-			startupfn := func() error {
-				cmd := exec.Command(command, args...)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				err := cmd.Run()
+			if p.nextArg() {
+				err := tlsBlock(p, &tls)
 				if err != nil {
 					return err
 				}
-				return nil
 			}
 
-			p.cfg.Startup = append(p.cfg.Startup, startupfn)
+			p.cfg.TLS = tls
 			return nil
 		},
-		"shutdown": func(p *parser) error {
+		"timeouts": func(p *parser) error {
+			parseDuration := func() (time.Duration, error) {
+				dur, err := time.ParseDuration(p.tkn())
+				if err != nil || dur < 0 {
+					return 0, p.err("Parse", "Invalid timeout '"+p.tkn()+"'")
+				}
+				return dur, nil
+			}
+
 			if !p.nextArg() {
 				return p.argErr()
 			}
 
-			command, args, err := middleware.SplitCommandAndArgs(p.tkn())
-			if err != nil {
-				return p.err("Parse", err.Error())
+			// Inside a path block, the read and write timeouts
+			// apply to just that path; idle is of the connection
+			read, write, idle := &p.cfg.ReadTimeout, &p.cfg.WriteTimeout, &p.cfg.IdleTimeout
+			if p.scope != nil && p.scope.path != "/" {
+				if p.cfg.PathTimeouts == nil {
+					p.cfg.PathTimeouts = make(map[string]Timeouts)
+				}
+				var scoped Timeouts
+				read, write, idle = &scoped.Read, &scoped.Write, nil
+				scope := p.scope.path
+				defer func() {
+					p.cfg.PathTimeouts[scope] = scoped
+				}()
 			}
 
-			shutdownfn := func() error {
-				cmd := exec.Command(command, args...)
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				err := cmd.Run()
+			// A single duration applies to all the timeouts
+			if p.tkn() != "{" {
+				dur, err := parseDuration()
 				if err != nil {
 					return err
 				}
+				*read, *write = dur, dur
+				if idle != nil {
+					*idle = dur
+				}
 				return nil
 			}
 
-			p.cfg.Shutdown = append(p.cfg.Shutdown, shutdownfn)
+			var closed bool
+			for p.next() {
+				if p.tkn() == "}" {
+					closed = true
+					break
+				}
+
+				var timeout *time.Duration
+				switch p.tkn() {
+				case "read":
+					timeout = read
+				case "write":
+					timeout = write
+				case "idle":
+					if idle == nil {
+						return p.err("Parse", "The idle timeout is of the connection, so it can't be set for a path")
+					}
+					timeout = idle
+				default:
+					return p.err("Parse", "Unknown timeout '"+p.tkn()+"'")
+				}
+
+				if !p.nextArg() {
+					return p.argErr()
+				}
+				dur, err := parseDuration()
+				if err != nil {
+					return err
+				}
+				*timeout = dur
+			}
+			if !closed {
+				return p.eofErr()
+			}
+
 			return nil
 		},
+		"max_conns": func(p *parser) error {
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			n, err := strconv.Atoi(p.tkn())
+			if err != nil || n < 1 {
+				return p.err("Parse", "Invalid max_conns '"+p.tkn()+"' - must be a positive integer")
+			}
+			p.cfg.MaxConns = n
+			return nil
+		},
+		"startup": func(p *parser) error {
+			name, fn, err := commandFunc(p)
+			if err != nil {
+				return err
+			}
+			p.cfg.AddStartup(name, fn)
+			return nil
+		},
+		"shutdown": func(p *parser) error {
+			name, fn, err := commandFunc(p)
+			if err != nil {
+				return err
+			}
+			p.cfg.AddShutdown(name, fn)
+			return nil
+		},
+	}
+}
+
+// commandFunc parses the command of a startup or shutdown
+// directive and returns a function that runs it, blocking
+// until it exits, named after the directive and command.
+// The command and its arguments may be separate tokens or
+// all in one quoted token.
+func commandFunc(p *parser) (string, func() error, error) {
+	directive := p.tkn()
+
+	if !p.nextArg() {
+		return "", nil, p.argErr()
+	}
+	command, args, err := middleware.SplitCommandAndArgs(p.tkn())
+	if err != nil {
+		return "", nil, p.err("Parse", err.Error())
+	}
+	for p.nextArg() {
+		args = append(args, p.tkn())
+	}
+
+	return directive + " " + command, func() error {
+		cmd := exec.Command(command, args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("%s command %s: %v", directive, command, err)
+		}
+		return nil
+	}, nil
+}
+
+// tlsBlock parses the block of a tls or tls_inline directive,
+// starting at its opening brace, into tls.
+func tlsBlock(p *parser, tls *TLSConfig) error {
+	err := p.openCurlyBrace()
+	if err != nil {
+		return err
+	}
+	var closed bool
+	for p.next() {
+		if p.tkn() == "}" {
+			closed = true
+			break
+		}
+		switch p.tkn() {
+		case "protocols":
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			tls.ProtocolMinVersion = p.tkn()
+			tls.ProtocolMaxVersion = highestProtocol
+			if p.nextArg() {
+				tls.ProtocolMaxVersion = p.tkn()
+			}
+
+			err := checkProtocols(tls.ProtocolMinVersion, tls.ProtocolMaxVersion)
+			if err != nil {
+				return p.err("Parse", err.Error())
+			}
+		case "ciphers":
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			for {
+				cipher, err := cipherSuite(p.tkn())
+				if err != nil {
+					return p.err("Parse", err.Error())
+				}
+				tls.Ciphers = append(tls.Ciphers, cipher)
+				if !p.nextArg() {
+					break
+				}
+			}
+		case "redirect":
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			switch p.tkn() {
+			case "on":
+				tls.DisableRedirect = false
+			case "off":
+				tls.DisableRedirect = true
+			default:
+				return p.err("Parse", "Expected 'on' or 'off' for TLS redirect, got '"+p.tkn()+"'")
+			}
+		case "clients":
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			tls.ClientAuth = "verify"
+			more := true
+			if ClientAuthModes[p.tkn()] {
+				tls.ClientAuth = p.tkn()
+				more = p.nextArg()
+			}
+			for more {
+				tls.ClientCAs = append(tls.ClientCAs, p.tkn())
+				more = p.nextArg()
+			}
+			if len(tls.ClientCAs) == 0 && tls.ClientAuth != "require" {
+				return p.err("Parse", "Client authentication mode '"+tls.ClientAuth+"' requires a CA certificate file")
+			}
+		case "http2":
+			if !p.nextArg() {
+				return p.argErr()
+			}
+			switch p.tkn() {
+			case "on":
+				tls.DisableHTTP2 = false
+			case "off":
+				tls.DisableHTTP2 = true
+			default:
+				return p.err("Parse", "Expected 'on' or 'off' for TLS http2, got '"+p.tkn()+"'")
+			}
+		case "experimental_http3":
+			if p.nextArg() {
+				return p.argErr()
+			}
+			tls.HTTP3 = true
+		default:
+			return p.err("Parse", "Unknown TLS property '"+p.tkn()+"'")
+		}
+	}
+	if !closed {
+		return p.eofErr()
 	}
+	return nil
 }
@@ -1,10 +1,5 @@
 package config
 
-import (
-	"errors"
-	"fmt"
-)
-
 // dispenser is a type that dispenses tokens, similarly to
 // a lexer, except that it can do so with some notion of
 // structure. Its methods implement part of the
@@ -153,7 +148,13 @@ func (d *dispenser) ArgErr() error {
 }
 
 // Err generates a custom parse error with a message of msg.
+// The error is a *ParseError.
 func (d *dispenser) Err(msg string) error {
-	msg = fmt.Sprintf("%s:%d - Parse error: %s", d.filename, d.tokens[d.cursor].line, msg)
-	return errors.New(msg)
+	return &ParseError{
+		Filename: d.filename,
+		Line:     d.tokens[d.cursor].line,
+		Column:   d.tokens[d.cursor].column,
+		Kind:     "Parse",
+		Message:  msg,
+	}
 }
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+// formatLine is a line of a formatted Caddyfile: its tokens,
+// and a comment at the end of it, if any.
+type formatLine struct {
+	tokens  []string
+	comment string
+	blank   bool // whether a blank line goes before it
+}
+
+// Format returns the Caddyfile src in a canonical form: one
+// directive per line, indented with a tab for each block it
+// is in, with single spaces between tokens, opening braces at
+// the end of the line they belong to, closing braces on their
+// own lines, and no more than one blank line in a row. The
+// tokens, their order, and the comments are kept. Formatting
+// its own output again changes nothing. Errors are those of
+// ParseTree, for files that aren't structured correctly.
+func Format(src []byte) ([]byte, error) {
+	_, err := ParseTree(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	l := lexer{keepComments: true}
+	l.load(bytes.NewReader(src))
+
+	var lines []formatLine
+	cur := -1 // the line that tokens on the same line in src go on, if any
+	var prevLine, prevEnd int
+
+	for l.next() {
+		tkn := l.token
+		text := tkn.text
+		if tkn.quoted {
+			text = quote(text)
+		}
+		sameLine := len(lines) > 0 && tkn.line == prevLine
+		blank := len(lines) > 0 && tkn.line > prevEnd+1
+
+		switch {
+		case tkn.comment:
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+			if sameLine {
+				lines[len(lines)-1].comment = text
+			} else {
+				lines = append(lines, formatLine{comment: text, blank: blank})
+			}
+			cur = -1
+		case text == "{":
+			if cur < 0 || !sameLine {
+				// A brace on a line by itself goes at the end of the
+				// addresses before it, unless it opens the global
+				// options block; ParseTree allows no other case
+				cur = len(lines) - 1
+				for cur >= 0 && len(lines[cur].tokens) == 0 {
+					cur--
+				}
+				if cur < 0 {
+					lines = append(lines, formatLine{blank: blank})
+					cur = len(lines) - 1
+				}
+			}
+			lines[cur].tokens = append(lines[cur].tokens, text)
+			cur = -1
+		case text == "}":
+			lines = append(lines, formatLine{tokens: []string{text}, blank: blank})
+			cur = -1
+		case cur >= 0 && sameLine:
+			lines[cur].tokens = append(lines[cur].tokens, text)
+		default:
+			lines = append(lines, formatLine{tokens: []string{text}, blank: blank})
+			cur = len(lines) - 1
+		}
+
+		prevLine = tkn.line
+		prevEnd = tkn.line + strings.Count(tkn.text, "\n")
+	}
+
+	var buf bytes.Buffer
+	var depth int
+	var opened bool // whether the line before opened a block
+	for _, line := range lines {
+		closes := len(line.tokens) == 1 && line.tokens[0] == "}"
+		if closes {
+			depth--
+		}
+		if line.blank && !opened && !closes {
+			buf.WriteByte('\n')
+		}
+
+		buf.WriteString(strings.Repeat("\t", depth))
+		buf.WriteString(strings.Join(line.tokens, " "))
+		if line.comment != "" {
+			if len(line.tokens) > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(line.comment)
+		}
+		buf.WriteByte('\n')
+
+		opened = len(line.tokens) > 0 && line.tokens[len(line.tokens)-1] == "{"
+		if opened {
+			depth++
+		}
+	}
+
+	return buf.Bytes(), nil
+}
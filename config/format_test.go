@@ -0,0 +1,94 @@
+package config
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	for i, test := range []struct {
+		input, expected string
+	}{
+		{"", ""},
+		{"localhost:8080", "localhost:8080\n"},
+		{
+			"localhost:8080   gzip\n\n\n\n   root    /www\n",
+			"localhost:8080 gzip\n\nroot /www\n",
+		},
+		{
+			`# comment at the top
+
+
+localhost:8080,   # first
+  example.com
+{ # after a brace
+
+    root /www   # the root
+
+	/api {   proxy / localhost:9000 {
+header_upstream Host {host}
+        }  }
+
+
+
+  log "access log.txt"
+  # near the end
+
+}
+site.com:80 { log }`,
+			`# comment at the top
+
+localhost:8080, # first
+example.com { # after a brace
+	root /www # the root
+
+	/api {
+		proxy / localhost:9000 {
+			header_upstream Host {host}
+		}
+	}
+
+	log "access log.txt"
+	# near the end
+}
+site.com:80 {
+	log
+}
+`,
+		},
+		{
+			"# defaults\n{ gzip\n    log }\nlocalhost",
+			"# defaults\n{\n\tgzip\n\tlog\n}\nlocalhost\n",
+		},
+		{
+			"(common) {\n  gzip\n}\nlocalhost {\n  import common\n  redir /a /b#top\n  rewrite / \"a \\\"b\\\"\"\n}\n",
+			"(common) {\n\tgzip\n}\nlocalhost {\n\timport common\n\tredir /a /b#top\n\trewrite / \"a \\\"b\\\"\"\n}\n",
+		},
+	} {
+		actual, err := Format([]byte(test.input))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		if string(actual) != test.expected {
+			t.Errorf("Test %d: Expected:\n%s\nbut got:\n%s", i, test.expected, actual)
+		}
+
+		again, err := Format(actual)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors formatting again, but got '%s'", i, err)
+		}
+		if string(again) != string(actual) {
+			t.Errorf("Test %d: Expected formatting again to change nothing, but got:\n%s", i, again)
+		}
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	for i, input := range []string{
+		"localhost {\n\tgzip\n",
+		"localhost\n}",
+		"localhost {\n}\n{\n\tgzip\n}",
+	} {
+		_, err := Format([]byte(input))
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Test %d: Expected a *ParseError, but got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// This file contains the JSON configuration format, which
+// is an alternative to the Caddyfile for configurations
+// that are generated by other programs. A JSON configuration
+// is an array of sites:
+//
+//	[{
+//		"host": "example.com",
+//		"port": "443",
+//		"root": "/www/example.com",
+//		"tls": {
+//			"certificate": "cert.pem",
+//			"key": "key.pem",
+//			"protocol_min": "tls1.2"
+//		},
+//		"directives": [
+//			{"name": "gzip"},
+//			{"name": "log", "args": ["/", "access.log"]},
+//			{"name": "proxy", "args": ["/api", "localhost:9000"],
+//			 "block": [["health_check", "/ping", "10s"]]}
+//		]
+//	}]
+//
+// Each site is translated into an equivalent Caddyfile
+// server block and parsed as such, so directives mean
+// exactly the same in both formats.
+
+type (
+	// jsonSite is a site (server block) in a JSON configuration.
+	jsonSite struct {
+		Host        string          `json:"host"`
+		Port        string          `json:"port"`
+		Root        string          `json:"root"`
+		BindAddress string          `json:"bind"`
+		Network     string          `json:"network"`
+		TLS         *jsonTLS        `json:"tls"`
+		Timeouts    *jsonTimeouts   `json:"timeouts"`
+		Startup     []string        `json:"startup"`
+		Shutdown    []string        `json:"shutdown"`
+		Directives  []jsonDirective `json:"directives"`
+	}
+
+	// jsonTLS is the TLS configuration of a site; the names
+	// of protocols and ciphers are the same as in a Caddyfile.
+	jsonTLS struct {
+		Certificate        string            `json:"certificate"`
+		Key                string            `json:"key"`
+		Certificates       []CertificatePair `json:"certificates"`
+		ProtocolMinVersion string            `json:"protocol_min"`
+		ProtocolMaxVersion string            `json:"protocol_max"`
+		Ciphers            []string          `json:"ciphers"`
+		DisableRedirect    bool              `json:"disable_redirect"`
+		DisableHTTP2       bool              `json:"disable_http2"`
+		HTTP3              bool              `json:"experimental_http3"`
+		ClientAuth         string            `json:"client_auth"`
+		ClientCAs          []string          `json:"client_cas"`
+	}
+
+	// jsonTimeouts are the timeouts of a site, as Go
+	// duration strings (e.g. "30s").
+	jsonTimeouts struct {
+		Read  string `json:"read"`
+		Write string `json:"write"`
+		Idle  string `json:"idle"`
+	}
+
+	// jsonDirective is a middleware directive with its
+	// arguments and, optionally, the lines of its block.
+	jsonDirective struct {
+		Name  string     `json:"name"`
+		Args  []string   `json:"args"`
+		Block [][]string `json:"block"`
+	}
+)
+
+// LoadJSON loads a JSON configuration file and returns
+// the same Config structs that the equivalent Caddyfile
+// would produce.
+func LoadJSON(filename string) ([]Config, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadJSONReader(filename, file)
+}
+
+// LoadJSONReader is like LoadReader, but for input in the
+// JSON configuration format. Line numbers in errors from
+// parsing the sites refer to the Caddyfile they translate
+// to, where each site begins with its address line.
+func LoadJSONReader(source string, input io.Reader) ([]Config, error) {
+	caddyfile, err := jsonCaddyfile(source, input)
+	if err != nil {
+		return []Config{}, err
+	}
+	return LoadReader(source, caddyfile)
+}
+
+// jsonCaddyfile translates the JSON configuration from
+// input to the Caddyfile it stands for.
+func jsonCaddyfile(source string, input io.Reader) (io.Reader, error) {
+	var sites []jsonSite
+	err := json.NewDecoder(input).Decode(&sites)
+	if err != nil {
+		return nil, fmt.Errorf("%s: Parse error: %v", source, err)
+	}
+
+	var caddyfile bytes.Buffer
+	for i, site := range sites {
+		err := site.writeCaddyfile(&caddyfile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: Site %d: %v", source, i, err)
+		}
+	}
+	return &caddyfile, nil
+}
+
+// writeCaddyfile writes site to w as a Caddyfile server block.
+func (site jsonSite) writeCaddyfile(w io.Writer) error {
+	if site.Host == "" && site.Port == "" {
+		return fmt.Errorf("host or port is required")
+	}
+
+	address := site.Host
+	if site.Port != "" {
+		address = Config{Host: site.Host, Port: site.Port}.Address()
+	}
+	fmt.Fprintf(w, "%s {\n", quote(address))
+
+	if site.Root != "" {
+		writeLine(w, "root", site.Root)
+	}
+	if site.BindAddress != "" {
+		writeLine(w, "bind", site.BindAddress)
+	}
+	if site.Network != "" {
+		writeLine(w, "network", site.Network)
+	}
+
+	if site.TLS != nil {
+		if site.TLS.ProtocolMaxVersion != "" && site.TLS.ProtocolMinVersion == "" {
+			return fmt.Errorf("TLS protocol_max requires protocol_min")
+		}
+
+		writeWords(w, "tls", site.TLS.Certificate, site.TLS.Key)
+		if site.TLS.ProtocolMinVersion != "" || len(site.TLS.Ciphers) > 0 || site.TLS.DisableRedirect || site.TLS.DisableHTTP2 ||
+			site.TLS.HTTP3 || site.TLS.ClientAuth != "" || len(site.TLS.ClientCAs) > 0 {
+			fmt.Fprint(w, " {\n")
+			if site.TLS.ProtocolMinVersion != "" {
+				protocols := []string{site.TLS.ProtocolMinVersion}
+				if site.TLS.ProtocolMaxVersion != "" {
+					protocols = append(protocols, site.TLS.ProtocolMaxVersion)
+				}
+				writeLine(w, "protocols", protocols...)
+			}
+			if len(site.TLS.Ciphers) > 0 {
+				writeLine(w, "ciphers", site.TLS.Ciphers...)
+			}
+			if site.TLS.DisableRedirect {
+				writeLine(w, "redirect", "off")
+			}
+			if site.TLS.DisableHTTP2 {
+				writeLine(w, "http2", "off")
+			}
+			if site.TLS.HTTP3 {
+				writeLine(w, "experimental_http3")
+			}
+			if site.TLS.ClientAuth != "" || len(site.TLS.ClientCAs) > 0 {
+				clients := site.TLS.ClientCAs
+				if site.TLS.ClientAuth != "" {
+					clients = append([]string{site.TLS.ClientAuth}, clients...)
+				}
+				writeLine(w, "clients", clients...)
+			}
+			fmt.Fprint(w, "}")
+		}
+		fmt.Fprint(w, "\n")
+
+		for _, pair := range site.TLS.Certificates {
+			writeLine(w, "tls", pair.Certificate, pair.Key)
+		}
+	}
+
+	if site.Timeouts != nil {
+		fmt.Fprint(w, "timeouts {\n")
+		for _, timeout := range [][2]string{
+			{"read", site.Timeouts.Read},
+			{"write", site.Timeouts.Write},
+			{"idle", site.Timeouts.Idle},
+		} {
+			if timeout[1] != "" {
+				writeLine(w, timeout[0], timeout[1])
+			}
+		}
+		fmt.Fprint(w, "}\n")
+	}
+
+	for _, command := range site.Startup {
+		writeLine(w, "startup", command)
+	}
+	for _, command := range site.Shutdown {
+		writeLine(w, "shutdown", command)
+	}
+
+	for _, directive := range site.Directives {
+		if directive.Name == "" {
+			return fmt.Errorf("directive name is required")
+		}
+		writeWords(w, directive.Name, directive.Args...)
+		if len(directive.Block) > 0 {
+			fmt.Fprint(w, " {\n")
+			for _, line := range directive.Block {
+				if len(line) == 0 {
+					continue
+				}
+				writeLine(w, line[0], line[1:]...)
+			}
+			fmt.Fprint(w, "}")
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprint(w, "}\n")
+	return nil
+}
+
+// writeLine writes name and args to w as one line.
+func writeLine(w io.Writer, name string, args ...string) {
+	writeWords(w, name, args...)
+	fmt.Fprint(w, "\n")
+}
+
+// writeWords writes name and args to w, separated
+// by spaces, without ending the line.
+func writeWords(w io.Writer, name string, args ...string) {
+	fmt.Fprint(w, quote(name))
+	for _, arg := range args {
+		fmt.Fprint(w, " "+quote(arg))
+	}
+}
+
+// quote encloses s in quotes so the lexer reads it
+// as one token, no matter what characters it has.
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadJSONReader(t *testing.T) {
+	caddyfile := `example.com:8080 {
+				  root /test/www
+				  bind 127.0.0.1
+				  timeouts {
+					  read 10s
+					  idle 1m
+				  }
+				  startup "echo starting"
+				  gzip
+				  log / access.log
+				  proxy /api localhost:9000 {
+					  health_check /ping 10s
+				  }
+			  }
+			  [::1]:443 {
+				  tls config_test.go config_test.go {
+					  protocols tls1.2
+					  ciphers ECDHE-RSA-AES128-GCM-SHA256
+				  }
+				  tls json_test.go json_test.go
+			  }`
+
+	json := `[{
+				"host": "example.com",
+				"port": "8080",
+				"root": "/test/www",
+				"bind": "127.0.0.1",
+				"timeouts": {"read": "10s", "idle": "1m"},
+				"startup": ["echo starting"],
+				"directives": [
+					{"name": "gzip"},
+					{"name": "log", "args": ["/", "access.log"]},
+					{"name": "proxy", "args": ["/api", "localhost:9000"], "block": [["health_check", "/ping", "10s"]]}
+				]
+			}, {
+				"host": "::1",
+				"port": "443",
+				"tls": {
+					"certificate": "config_test.go",
+					"key": "config_test.go",
+					"certificates": [{"certificate": "json_test.go", "key": "json_test.go"}],
+					"protocol_min": "tls1.2",
+					"ciphers": ["ECDHE-RSA-AES128-GCM-SHA256"]
+				}
+			}]`
+
+	expected, err := LoadReader("Caddyfile", strings.NewReader(caddyfile))
+	if err != nil {
+		t.Fatalf("Expected no errors loading the Caddyfile, but got '%s'", err)
+	}
+	actual, err := LoadJSONReader("caddy.json", strings.NewReader(json))
+	if err != nil {
+		t.Fatalf("Expected no errors loading the JSON, but got '%s'", err)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d configurations, but got %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		exp, act := expected[i], actual[i]
+		if act.Address() != exp.Address() || act.Root != exp.Root || act.BindAddress != exp.BindAddress {
+			t.Errorf("Config %d: Expected %s with root '%s' bound to '%s', got %s with root '%s' bound to '%s'",
+				i, exp.Address(), exp.Root, exp.BindAddress, act.Address(), act.Root, act.BindAddress)
+		}
+		if act.ReadTimeout != exp.ReadTimeout || act.WriteTimeout != exp.WriteTimeout || act.IdleTimeout != exp.IdleTimeout {
+			t.Errorf("Config %d: Expected timeouts %s/%s/%s, got %s/%s/%s", i, exp.ReadTimeout, exp.WriteTimeout,
+				exp.IdleTimeout, act.ReadTimeout, act.WriteTimeout, act.IdleTimeout)
+		}
+		if len(act.Middleware["/"]) != len(exp.Middleware["/"]) {
+			t.Errorf("Config %d: Expected %d middleware, got %d", i, len(exp.Middleware["/"]), len(act.Middleware["/"]))
+		}
+		if len(act.Startup) != len(exp.Startup) {
+			t.Errorf("Config %d: Expected %d startup functions, got %d", i, len(exp.Startup), len(act.Startup))
+		}
+		if len(act.TLS.Pairs()) != len(exp.TLS.Pairs()) || act.TLS.Enabled != exp.TLS.Enabled ||
+			act.TLS.ProtocolMinVersion != exp.TLS.ProtocolMinVersion ||
+			act.TLS.ProtocolMaxVersion != exp.TLS.ProtocolMaxVersion ||
+			len(act.TLS.Ciphers) != len(exp.TLS.Ciphers) {
+			t.Errorf("Config %d: Expected TLS config %#v, got %#v", i, exp.TLS, act.TLS)
+		}
+		if act.ConfigFile != "caddy.json" {
+			t.Errorf("Config %d: Expected ConfigFile to be 'caddy.json', got '%s'", i, act.ConfigFile)
+		}
+	}
+}
+
+func TestLoadJSONReaderErrors(t *testing.T) {
+	for i, input := range []string{
+		`{"host": "localhost"}`,
+		`[{"root": "/www"}]`,
+		`[{"host": "localhost", "directives": [{"args": ["/"]}]}]`,
+		`[{"host": "localhost", "directives": [{"name": "foobar"}]}]`,
+		`[{"host": "localhost", "tls": {"certificate": "config_test.go", "key": "config_test.go", "protocol_max": "tls1.2"}}]`,
+	} {
+		_, err := LoadJSONReader("caddy.json", strings.NewReader(input))
+		if err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		} else if !strings.Contains(err.Error(), "caddy.json") {
+			t.Errorf("Test %d: Expected error to name the source, got '%s'", i, err)
+		}
+	}
+}
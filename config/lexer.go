@@ -15,12 +15,21 @@ type (
 		reader *bufio.Reader
 		token  token
 		line   int
+		column int // of the last character read
+
+		replaying bool    // whether tokens come from replay instead of reader
+		replay    []token // tokens yet to be replayed
+
+		keepComments bool // whether comments are tokens instead of skipped
 	}
 
 	// token represents a single processable unit.
 	token struct {
-		line int
-		text string
+		line    int
+		column  int // of the first character, starting at 1
+		text    string
+		quoted  bool // whether the text was in quotes
+		comment bool // whether this is a comment, including the "#"
 	}
 )
 
@@ -28,18 +37,37 @@ type (
 func (l *lexer) load(file io.Reader) error {
 	l.reader = bufio.NewReader(file)
 	l.line = 1
+	l.column = 0
 	return nil
 }
 
+// loadTokens prepares the lexer to give tokens that
+// were already scanned, instead of reading a file.
+func (l *lexer) loadTokens(tokens []token) {
+	l.replaying = true
+	l.replay = tokens
+}
+
 // next loads the next token into the lexer.
 // A token is delimited by whitespace, unless
 // the token starts with a quotes character (")
 // in which case the token goes until the closing
 // quotes (the enclosing quotes are not included).
-// The rest of the line is skipped if a "#"
-// character is read in. Returns true if a token
-// was loaded; false otherwise.
+// A "#" character that starts a token begins a
+// comment, and the rest of the line is skipped;
+// elsewhere in a token (e.g. "/page#top") it is
+// just part of the token. If l.keepComments is set,
+// a comment is a token too, without the line ending.
+// Returns true if a token was loaded; false otherwise.
 func (l *lexer) next() bool {
+	if l.replaying {
+		if len(l.replay) == 0 {
+			return false
+		}
+		l.token, l.replay = l.replay[0], l.replay[1:]
+		return true
+	}
+
 	var val []rune
 	var comment, quoted, escaped bool
 
@@ -60,6 +88,7 @@ func (l *lexer) next() bool {
 				panic(err)
 			}
 		}
+		l.column++
 
 		if quoted {
 			if !escaped {
@@ -73,19 +102,34 @@ func (l *lexer) next() bool {
 			}
 			if ch == '\n' {
 				l.line++
+				l.column = 0
 			}
 			val = append(val, ch)
 			escaped = false
 			continue
 		}
 
+		if comment {
+			if ch == '\n' {
+				l.line++
+				l.column = 0
+				comment = false
+				if len(val) > 0 {
+					return makeToken()
+				}
+			} else if l.keepComments && ch != '\r' {
+				val = append(val, ch)
+			}
+			continue
+		}
+
 		if unicode.IsSpace(ch) {
 			if ch == '\r' {
 				continue
 			}
 			if ch == '\n' {
 				l.line++
-				comment = false
+				l.column = 0
 			}
 			if len(val) > 0 {
 				return makeToken()
@@ -93,18 +137,20 @@ func (l *lexer) next() bool {
 			continue
 		}
 
-		if ch == '#' {
+		if ch == '#' && len(val) == 0 {
 			comment = true
-		}
-
-		if comment {
+			if l.keepComments {
+				l.token = token{line: l.line, column: l.column, comment: true}
+				val = append(val, ch)
+			}
 			continue
 		}
 
 		if len(val) == 0 {
-			l.token = token{line: l.line}
+			l.token = token{line: l.line, column: l.column}
 			if ch == '"' {
 				quoted = true
+				l.token.quoted = true
 				continue
 			}
 		}
@@ -62,6 +62,44 @@ func TestLexer(t *testing.T) {
 				{line: 6, text: "}"},
 			},
 		},
+		{
+			input: `# comment at the top
+
+					host:123 # after the address
+					{ # after a brace
+
+						dir1 arg # after an argument
+						dir2 {
+							# inside a nested block
+							sub1 # after a subdirective
+
+						} # after a closing brace
+						#no space after the hash
+					}
+					# comment at the end`,
+			expected: []token{
+				{line: 3, text: "host:123"},
+				{line: 4, text: "{"},
+				{line: 6, text: "dir1"},
+				{line: 6, text: "arg"},
+				{line: 7, text: "dir2"},
+				{line: 7, text: "{"},
+				{line: 9, text: "sub1"},
+				{line: 11, text: "}"},
+				{line: 13, text: "}"},
+			},
+		},
+		{
+			input: `redir /a /b#fragment # comment
+					a "#not a comment"`,
+			expected: []token{
+				{line: 1, text: "redir"},
+				{line: 1, text: "/a"},
+				{line: 1, text: "/b#fragment"},
+				{line: 2, text: "a"},
+				{line: 2, text: "#not a comment"},
+			},
+		},
 		{
 			input: `a "quoted value" b
 					foobar`,
@@ -137,3 +175,63 @@ func lexerCompare(t *testing.T, n int, expected, actual []token) {
 		}
 	}
 }
+
+func TestLexerColumns(t *testing.T) {
+	input := `host:123 {
+	dir1 "quoted arg"
+  dir2 x # comment
+}`
+	expected := []token{
+		{line: 1, column: 1, text: "host:123"},
+		{line: 1, column: 10, text: "{"},
+		{line: 2, column: 2, text: "dir1"},
+		{line: 2, column: 7, text: "quoted arg"},
+		{line: 3, column: 3, text: "dir2"},
+		{line: 3, column: 8, text: "x"},
+		{line: 4, column: 1, text: "}"},
+	}
+
+	actual := tokenize(input)
+	lexerCompare(t, 0, expected, actual)
+	for i := 0; i < len(actual) && i < len(expected); i++ {
+		if actual[i].column != expected[i].column {
+			t.Errorf("Token %d ('%s'): expected column %d but was column %d",
+				i, expected[i].text, expected[i].column, actual[i].column)
+		}
+	}
+}
+
+func TestLexerKeepComments(t *testing.T) {
+	input := `# top
+host:123 { # after a brace
+	dir1 "quoted arg" #no space
+	dir2 /a#b
+}`
+	expected := []token{
+		{line: 1, text: "# top", comment: true},
+		{line: 2, text: "host:123"},
+		{line: 2, text: "{"},
+		{line: 2, text: "# after a brace", comment: true},
+		{line: 3, text: "dir1"},
+		{line: 3, text: "quoted arg", quoted: true},
+		{line: 3, text: "#no space", comment: true},
+		{line: 4, text: "dir2"},
+		{line: 4, text: "/a#b"},
+		{line: 5, text: "}"},
+	}
+
+	l := lexer{keepComments: true}
+	l.load(strings.NewReader(input))
+	var actual []token
+	for l.next() {
+		actual = append(actual, l.token)
+	}
+
+	lexerCompare(t, 0, expected, actual)
+	for i := 0; i < len(actual) && i < len(expected); i++ {
+		if actual[i].comment != expected[i].comment || actual[i].quoted != expected[i].quoted {
+			t.Errorf("Token %d ('%s'): expected comment=%v quoted=%v but was comment=%v quoted=%v", i, expected[i].text,
+				expected[i].comment, expected[i].quoted, actual[i].comment, actual[i].quoted)
+		}
+	}
+}
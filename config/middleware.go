@@ -1,20 +1,39 @@
 package config
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/basicauth"
 	"github.com/mholt/caddy/middleware/browse"
+	"github.com/mholt/caddy/middleware/cache"
+	"github.com/mholt/caddy/middleware/canonical"
+	"github.com/mholt/caddy/middleware/cors"
 	"github.com/mholt/caddy/middleware/errors"
 	"github.com/mholt/caddy/middleware/extensions"
+	"github.com/mholt/caddy/middleware/fallback"
 	"github.com/mholt/caddy/middleware/fastcgi"
 	"github.com/mholt/caddy/middleware/gzip"
 	"github.com/mholt/caddy/middleware/headers"
+	"github.com/mholt/caddy/middleware/internalsrv"
+	"github.com/mholt/caddy/middleware/jsonp"
+	"github.com/mholt/caddy/middleware/languages"
+	"github.com/mholt/caddy/middleware/limits"
 	"github.com/mholt/caddy/middleware/log"
+	"github.com/mholt/caddy/middleware/maintenance"
 	"github.com/mholt/caddy/middleware/markdown"
+	"github.com/mholt/caddy/middleware/methods"
+	"github.com/mholt/caddy/middleware/metrics"
 	"github.com/mholt/caddy/middleware/proxy"
+	"github.com/mholt/caddy/middleware/ratelimit"
+	"github.com/mholt/caddy/middleware/realip"
 	"github.com/mholt/caddy/middleware/redirect"
+	"github.com/mholt/caddy/middleware/replace"
 	"github.com/mholt/caddy/middleware/rewrite"
+	"github.com/mholt/caddy/middleware/status"
 	"github.com/mholt/caddy/middleware/templates"
+	"github.com/mholt/caddy/middleware/tryfiles"
 	"github.com/mholt/caddy/middleware/websockets"
 )
 
@@ -37,28 +56,52 @@ import (
 // other hand, DOES care what errors does to the response since
 // it must compress every output to the client, even error pages,
 // so it must be registered before the errors middleware and any
-// others that would write to the response.
+// others that would write to the response. Realip comes before
+// all of them, so that they all see the address of the client.
+// Status comes early too, so that health checks are answered
+// whatever the middleware after it would do with them, and
+// canonical and maintenance right after it, so that requests
+// they redirect or turn away don't get any further.
 func init() {
+	register("realip", realip.New)
 	register("log", log.New)
+	register("metrics", metrics.New)
+	register("status", status.New)
+	register("canonical", canonical.New)
+	register("maintenance", maintenance.New)
 	register("gzip", gzip.New)
 	register("errors", errors.New)
 	register("header", headers.New)
+	register("internal", internalsrv.New)
+	register("cors", cors.New)
+	register("methods", methods.New)
+	register("ratelimit", ratelimit.New)
+	register("limit", limits.New)
 	register("rewrite", rewrite.New)
 	register("redir", redirect.New)
 	register("ext", extensions.New)
+	register("try_files", tryfiles.New)
+	register("languages", languages.New)
 	register("basicauth", basicauth.New)
+	register("cache", cache.New)
+	register("replace", replace.New)
+	register("jsonp", jsonp.New)
 	register("proxy", proxy.New)
 	register("fastcgi", fastcgi.New)
 	register("websocket", websockets.New)
 	register("markdown", markdown.New)
 	register("templates", templates.New)
 	register("browse", browse.New)
+	register("fallback", fallback.New)
 }
 
 // registry stores the registered middleware:
 // both the order and the directives to which they
-// are bound.
+// are bound. Directives registered from outside
+// this package may come at any time, so it is
+// protected by mu.
 var registry = struct {
+	mu           sync.RWMutex
 	directiveMap map[string]middleware.Generator
 	ordered      []string
 }{
@@ -69,12 +112,67 @@ var registry = struct {
 // to a directive. Upon each request, middleware will be
 // executed in the order they are registered.
 func register(directive string, generator middleware.Generator) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.directiveMap[directive] = generator
+	registry.ordered = append(registry.ordered, directive)
+}
+
+// RegisterDirective binds a middleware generator to a new directive,
+// for middleware outside of Caddy, such as a plugin that registers
+// its directive in an init function. The generator gets the tokens
+// of the directive from its Controller, like the built-in ones, and
+// the middleware it returns is added to the Config. Its middleware
+// execute after those of the built-in directives, in the order they
+// are registered. Unless repeatable is true, the directive may only
+// appear once in a path scope. It is safe to call at any time, but
+// Caddyfiles parsed before then don't know the directive.
+func RegisterDirective(directive string, generator middleware.Generator, repeatable bool) error {
+	if directive == "" || generator == nil {
+		return fmt.Errorf("A directive needs a name and a middleware generator")
+	}
+	if _, ok := validDirectives[directive]; ok {
+		return fmt.Errorf("Directive '%s' is already a built-in directive", directive)
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.directiveMap[directive]; ok {
+		return fmt.Errorf("Directive '%s' is already registered", directive)
+	}
 	registry.directiveMap[directive] = generator
 	registry.ordered = append(registry.ordered, directive)
+	if repeatable {
+		repeatableDirectives[directive] = true
+	}
+	return nil
 }
 
 // middlewareRegistered returns whether or not a directive is registered.
 func middlewareRegistered(directive string) bool {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
 	_, ok := registry.directiveMap[directive]
 	return ok
 }
+
+// isRepeatable returns whether directive may appear
+// more than once in a path scope.
+func isRepeatable(directive string) bool {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return repeatableDirectives[directive]
+}
+
+// registered returns the registered middleware directives in
+// order, with the generators bound to them.
+func registered() ([]string, map[string]middleware.Generator) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	ordered := append([]string(nil), registry.ordered...)
+	generators := make(map[string]middleware.Generator, len(registry.directiveMap))
+	for directive, generator := range registry.directiveMap {
+		generators[directive] = generator
+	}
+	return ordered, generators
+}
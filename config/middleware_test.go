@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestRegisterDirective(t *testing.T) {
+	var args []string
+	generator := func(c middleware.Controller) (middleware.Middleware, error) {
+		for c.Next() {
+			args = append(args, c.RemainingArgs()...)
+		}
+		return func(next middleware.Handler) middleware.Handler { return next }, nil
+	}
+
+	err := RegisterDirective("test_plugin", generator, false)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	for i, name := range []string{"test_plugin", "gzip", "root", ""} {
+		if err := RegisterDirective(name, generator, false); err == nil {
+			t.Errorf("Test %d: Expected an error registering '%s' again, but got none", i, name)
+		}
+	}
+
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader("localhost:8080\ntest_plugin a b\ngzip"))
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if !reflect.DeepEqual(confs[0].MiddlewareNames["/"], []string{"gzip", "test_plugin"}) {
+		t.Errorf("Expected the plugin's middleware after gzip, got %v", confs[0].MiddlewareNames["/"])
+	}
+	if !reflect.DeepEqual(args, []string{"a", "b"}) {
+		t.Errorf("Expected the plugin to get arguments [a b], got %v", args)
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader("localhost:8080\ntest_plugin\ntest_plugin"))
+	if _, err := p.parse(); err == nil {
+		t.Error("Expected an error for a plugin directive that isn't repeatable, but got none")
+	}
+}
+
+func TestLogFilesSharedBySites(t *testing.T) {
+	dir := t.TempDir()
+	accessLog, errorLog := filepath.Join(dir, "access.log"), filepath.Join(dir, "error.log")
+	input := "a.com, b.com:80,8080 {\n" +
+		"log " + accessLog + "\n" +
+		"errors " + errorLog + "\n" +
+		"}"
+
+	cfgs, err := LoadReader("test", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(cfgs) != 3 {
+		t.Fatalf("Expected 3 configurations, but got %d", len(cfgs))
+	}
+
+	// As the server does for each site
+	for _, cfg := range cfgs {
+		for _, start := range cfg.Startup {
+			err := start()
+			if err != nil {
+				t.Fatalf("Expected no error starting %s, got %v", cfg.Address(), err)
+			}
+		}
+	}
+	for _, cfg := range cfgs {
+		for _, stop := range cfg.Shutdown {
+			err := stop()
+			if err != nil {
+				t.Errorf("Expected no error stopping %s, got %v", cfg.Address(), err)
+			}
+		}
+	}
+
+	// A file left open would be reopened at its path
+	for _, file := range []string{accessLog, errorLog} {
+		err := os.Remove(file)
+		if err != nil {
+			t.Fatalf("Expected %s to have been created, but: %v", file, err)
+		}
+	}
+	middleware.ReopenLogFiles()
+	for _, file := range []string{accessLog, errorLog} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be closed once all sites stopped, but it was reopened", file)
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -11,15 +14,32 @@ import (
 type (
 	// parser is a type which can parse config files.
 	parser struct {
-		filename string            // the name of the file that we're parsing
-		lexer    lexer             // the lexer that is giving us tokens from the raw input
-		hosts    []hostPort        // the list of host:port combinations current tokens apply to
-		cfg      Config            // each virtual host gets one Config; this is the one we're currently building
-		cfgs     []Config          // after a Config is created, it may need to be copied for multiple hosts
-		other    []locationContext // tokens to be 'parsed' later by middleware generators
-		scope    *locationContext  // the current location context (path scope) being populated
-		unused   *token            // sometimes a token will be read but not immediately consumed
-		eof      bool              // if we encounter a valid EOF in a hard place
+		filename  string             // the name of the file that we're parsing
+		lexer     lexer              // the lexer that is giving us tokens from the raw input
+		hosts     []hostPort         // the list of host:port combinations current tokens apply to
+		cfg       Config             // each virtual host gets one Config; this is the one we're currently building
+		cfgs      []Config           // after a Config is created, it may need to be copied for multiple hosts
+		other     []locationContext  // tokens to be 'parsed' later by middleware generators
+		scope     *locationContext   // the current location context (path scope) being populated
+		unused    *token             // sometimes a token will be read but not immediately consumed
+		eof       bool               // if we encounter a valid EOF in a hard place
+		strict    bool               // whether referencing an unset environment variable is an error
+		importing []string           // absolute paths of the files currently being parsed, outermost first
+		snippets  map[string][]token // the tokens of each snippet defined so far, by name
+		inlining  []string           // names of the snippets currently being parsed, outermost first
+		seen      map[string]int     // the line of each non-repeatable directive so far, by path scope and name
+		envErr    error              // the first unset environment variable error, if strict
+		sites     map[string]site    // the sites defined so far, by siteKey
+		global    []token            // the tokens of the global options block, if any
+		defaults  bool               // whether the global options are being parsed for a site
+		defaulted map[string]bool    // the keys of p.seen that came from the global options
+	}
+
+	// site is where a site was defined, for errors
+	// about it being defined again
+	site struct {
+		address string
+		line    int
 	}
 
 	// locationContext represents a location context
@@ -31,33 +51,56 @@ type (
 		directives map[string]*controller
 	}
 
-	// hostPort just keeps a hostname and port together
+	// hostPort just keeps a hostname and port together,
+	// or the path of a Unix socket in their place
 	hostPort struct {
-		host, port string
-	}
-)
+		host, port string // port is empty for the default one
+		socket     string
+		plain      bool   // whether the address was given as http://, without TLS
+		scheme     string // the scheme the address was given with, if any
 
-// newParser makes a new parser and prepares it for parsing, given
-// the input to parse.
-func newParser(file *os.File) (*parser, error) {
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, err
+		// The address token and where it is, for an error about it
+		addr         string
+		line, column int
 	}
-
-	p := &parser{filename: stat.Name()}
-	p.lexer.load(file)
-
-	return p, nil
-}
+)
 
 // Parse parses the configuration file. It produces a slice of Config
 // structs which can be used to create and configure server instances.
+// A block without addresses at the very start of the file holds the
+// global options: directives for every site, which the sites' own
+// ones take precedence over (see applyGlobal).
 func (p *parser) parse() ([]Config, error) {
 	var configs []Config
 
-	for p.lexer.next() {
+	for first := true; p.lex(); first = false {
+		if p.tkn() == "{" {
+			if !first {
+				return nil, p.err("Syntax", "The global options block (without addresses) must be the first block")
+			}
+			tokens, err := p.blockTokens()
+			if err != nil {
+				return nil, err
+			}
+			p.global = tokens
+			continue
+		}
+
+		if isSnippet(p.tkn()) {
+			err := p.defineSnippet()
+			if p.envErr != nil {
+				return nil, p.envErr
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		err := p.parseOne()
+		if p.envErr != nil {
+			return nil, p.envErr
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -67,6 +110,45 @@ func (p *parser) parse() ([]Config, error) {
 	return configs, nil
 }
 
+// lex loads the next token from the lexer and expands
+// any environment variables in it. Returns true if a
+// token was loaded; false otherwise.
+func (p *parser) lex() bool {
+	if !p.lexer.next() {
+		return false
+	}
+	p.lexer.token.text = p.replaceEnvVars(p.lexer.token.text)
+	return true
+}
+
+// replaceEnvVars replaces each {$NAME} in s with the value
+// of the environment variable NAME. Unset variables are
+// replaced with empty string; if the parser is strict, the
+// first one is also recorded as an error.
+func (p *parser) replaceEnvVars(s string) string {
+	for offset := 0; ; {
+		start := strings.Index(s[offset:], "{$")
+		if start < 0 {
+			return s
+		}
+		start += offset
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return s
+		}
+		end += start
+
+		name := s[start+2 : end]
+		value, ok := os.LookupEnv(name)
+		if !ok && p.strict && p.envErr == nil {
+			p.envErr = p.err("Parse", "Environment variable '"+name+"' is not set")
+		}
+
+		s = s[:start] + value + s[end+1:]
+		offset = start + len(value)
+	}
+}
+
 // nextArg loads the next token if it is on the same line.
 // Returns true if a token was loaded; false otherwise.
 func (p *parser) nextArg() bool {
@@ -91,7 +173,7 @@ func (p *parser) next() bool {
 		p.unused = nil
 		return true
 	} else {
-		return p.lexer.next()
+		return p.lex()
 	}
 }
 
@@ -105,15 +187,23 @@ func (p *parser) next() bool {
 func (p *parser) parseOne() error {
 	p.cfgs = []Config{}
 	p.cfg = Config{
-		Middleware: make(map[string][]middleware.Middleware),
+		Middleware:      make(map[string][]middleware.Middleware),
+		MiddlewareNames: make(map[string][]string),
 	}
 	p.other = []locationContext{}
+	p.seen = make(map[string]int)
+	line, column := p.line(), p.column()
 
 	err := p.begin()
 	if err != nil {
 		return err
 	}
 
+	err = p.applyGlobal()
+	if err != nil {
+		return err
+	}
+
 	err = p.unwrap()
 	if err != nil {
 		return err
@@ -121,52 +211,345 @@ func (p *parser) parseOne() error {
 
 	// Make a copy of the config for each
 	// address that will be using it
+	seen := make(map[string]bool)
 	for _, hostport := range p.hosts {
-		cfgCopy := p.cfg
+		cfgCopy := p.cfg.Clone()
 		cfgCopy.Host = hostport.host
 		cfgCopy.Port = hostport.port
+		if cfgCopy.Port == "" && hostport.socket == "" {
+			cfgCopy.Port = defaultPort
+			if cfgCopy.TLS.Enabled {
+				cfgCopy.Port = "443"
+			}
+		}
+		if hostport.plain {
+			// Served without TLS, even if the other addresses
+			// of the block have it
+			cfgCopy.TLS = TLSConfig{}
+		}
+		if hostport.socket != "" {
+			if cfgCopy.TLS.Enabled {
+				return p.err("Parse", "TLS is not supported on Unix socket "+hostport.socket)
+			}
+			if cfgCopy.Network != "" {
+				return p.err("Parse", "network is not allowed for sites on a Unix socket")
+			}
+			cfgCopy.Socket = hostport.socket
+			cfgCopy.AddShutdown("remove socket "+hostport.socket, removeSocket(hostport.socket))
+		} else if cfgCopy.SocketMode != 0 {
+			return p.err("Parse", "socket_mode is only allowed for sites on a Unix socket")
+		}
+
+		// Only now that its port is known can an address be
+		// compared with the others of the block
+		key := addressKey(hostport, cfgCopy)
+		if seen[key] {
+			return &ParseError{Filename: p.filename, Line: hostport.line, Column: hostport.column,
+				Kind: "Parse", Message: "Duplicate address '" + hostport.addr + "'"}
+		}
+		seen[key] = true
 		p.cfgs = append(p.cfgs, cfgCopy)
 	}
 
+	// A site defined again in another server block would
+	// fail when the server starts
+	if p.sites == nil {
+		p.sites = make(map[string]site)
+	}
+	for _, cfg := range p.cfgs {
+		if other, ok := p.sites[siteKey(cfg)]; ok {
+			msg := "Site " + cfg.Address() + " is already defined on line " + strconv.Itoa(other.line)
+			if !strings.EqualFold(other.address, cfg.Address()) {
+				msg = "Site " + cfg.Address() + " serves the same hosts on the same address as " +
+					other.address + " on line " + strconv.Itoa(other.line)
+			}
+			return &ParseError{Filename: p.filename, Line: line, Column: column, Kind: "Parse", Message: msg}
+		}
+	}
+	for _, cfg := range p.cfgs {
+		p.sites[siteKey(cfg)] = site{address: cfg.Address(), line: line}
+	}
+
 	return nil
 }
 
+// siteKey returns what identifies the site of cfg among
+// all the sites of a configuration: its host, or "*" for
+// all catch-all hosts, and where it listens. Wildcard hosts
+// like "*.example.com" just have lower precedence than the
+// hosts they match, so they don't collide with them.
+func siteKey(cfg Config) string {
+	if cfg.Socket != "" {
+		return "unix:" + cfg.Socket
+	}
+	host := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(cfg.Host, "["), "]"))
+	if IsCatchAllHost(host) {
+		host = "*"
+	}
+	return host + " " + portNumber(cfg.Port) + " " + cfg.BindAddress + " " + cfg.ListenNetwork()
+}
+
+// addressKey returns what identifies the address hp, which
+// cfg is made from, among those of its server block: its
+// host, port and scheme. An address without a scheme has
+// the one its port implies, if any, so "host:80" is the
+// same as "http://host:80", and "host" the same as
+// "host:2015" unless the block has TLS.
+func addressKey(hp hostPort, cfg Config) string {
+	if hp.socket != "" {
+		return "unix:" + hp.socket
+	}
+	port, scheme := portNumber(cfg.Port), hp.scheme
+	if scheme == "" {
+		switch port {
+		case "80":
+			scheme = "http"
+		case "443":
+			scheme = "https"
+		}
+	}
+	return strings.ToLower(hp.host) + " " + port + " " + scheme
+}
+
+// portNumber returns port, or its number if it is
+// named after a scheme ("http" or "https").
+func portNumber(port string) string {
+	switch port {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return port
+}
+
+// removeSocket returns a shutdown function that removes
+// the Unix socket file at path, if it is still there.
+func removeSocket(path string) func() error {
+	return func() error {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+}
+
 // unwrap gets the middleware generators from the middleware
 // package in the order in which they are registered, and
 // executes the top-level functions (the generator function)
 // to expose the second layers which are the actual middleware.
-// This function should be called only after p has filled out
-// p.other and the entire server block has already been consumed.
+// The middleware of each path scope are kept separately, in
+// registration order. This function should be called only
+// after p has filled out p.other and the entire server block
+// has already been consumed.
 func (p *parser) unwrap() error {
-	if len(p.other) == 0 {
-		// no middlewares were invoked
-		return nil
+	ordered, generators := registered()
+	for _, scope := range p.other {
+		for _, directive := range ordered {
+			if disp, ok := scope.directives[directive]; ok {
+				if generator, ok := generators[directive]; ok {
+					mid, err := generator(disp)
+					if err != nil {
+						return err
+					}
+					err = disp.checkRoot()
+					if err != nil {
+						return err
+					}
+					if mid != nil {
+						p.cfg.Middleware[scope.path] = append(p.cfg.Middleware[scope.path], mid)
+						p.cfg.MiddlewareNames[scope.path] = append(p.cfg.MiddlewareNames[scope.path], directive)
+					}
+				} else {
+					return errors.New("No middleware bound to directive '" + directive + "'")
+				}
+			}
+		}
 	}
 
-	for _, directive := range registry.ordered {
-		// TODO: For now, we only support the first and default path scope ("/", held in p.other[0])
-		// but when we implement support for path scopes, we will have to change this logic
-		// to loop over them and order them. We need to account for situations where multiple
-		// path scopes overlap, regex (??), etc...
-		if disp, ok := p.other[0].directives[directive]; ok {
-			if generator, ok := registry.directiveMap[directive]; ok {
-				mid, err := generator(disp)
-				if err != nil {
-					return err
-				}
-				if mid != nil {
-					// TODO: Again, we assume the default path scope here...
-					p.cfg.Middleware[p.other[0].path] = append(p.cfg.Middleware[p.other[0].path], mid)
-				}
-			} else {
-				return errors.New("No middleware bound to directive '" + directive + "'")
+	return nil
+}
+
+// importFile parses the directives in the file named filename
+// as if they appeared in place of the current token. It returns
+// an error if the file is already being parsed, which would
+// otherwise import it in an endless loop.
+func (p *parser) importFile(filename string) error {
+	if len(p.importing) == 0 {
+		outer, err := filepath.Abs(p.filename)
+		if err != nil {
+			return p.err("Parse", err.Error())
+		}
+		p.importing = []string{outer}
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return p.err("Parse", err.Error())
+	}
+	for _, importing := range p.importing {
+		if importing == abs {
+			return p.err("Parse", "Circular import of "+filename)
+		}
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return p.err("Parse", "Could not import "+filename+"; "+err.Error())
+	}
+	defer file.Close()
+
+	// Read tokens from the imported file for a while
+	outerFilename, outerLexer := p.filename, p.lexer
+	p.filename = filename
+	p.lexer = lexer{}
+	p.lexer.load(file)
+	p.importing = append(p.importing, abs)
+
+	err = p.directives()
+
+	p.importing = p.importing[:len(p.importing)-1]
+	p.filename, p.lexer = outerFilename, outerLexer
+
+	return err
+}
+
+// isSnippet returns whether tkn names a snippet
+// definition, like "(name)".
+func isSnippet(tkn string) bool {
+	return len(tkn) > 2 && tkn[0] == '(' && tkn[len(tkn)-1] == ')'
+}
+
+// defineSnippet expects the current token to be the name of
+// a snippet, like "(name)", and saves the tokens of the block
+// that follows it so they can be imported by name later. A
+// snippet is a server block without addresses and doesn't
+// produce a Config by itself.
+func (p *parser) defineSnippet() error {
+	tkn := p.tkn()
+	name := tkn[1 : len(tkn)-1]
+	if _, ok := p.snippets[name]; ok {
+		return p.err("Parse", "Snippet '"+name+"' is already defined")
+	}
+
+	if !p.next() {
+		return p.eofErr()
+	}
+	tokens, err := p.blockTokens()
+	if err != nil {
+		return err
+	}
+
+	if p.snippets == nil {
+		p.snippets = make(map[string][]token)
+	}
+	p.snippets[name] = tokens
+	return nil
+}
+
+// blockTokens expects the current token to be an opening
+// curly brace and returns the tokens after it, up to the
+// closing curly brace that matches it, which becomes the
+// current token.
+func (p *parser) blockTokens() ([]token, error) {
+	err := p.openCurlyBrace()
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []token
+	nesting := 1
+	for p.next() {
+		if p.tkn() == "{" {
+			nesting++
+		} else if p.tkn() == "}" {
+			nesting--
+			if nesting == 0 {
+				break
 			}
 		}
+		tokens = append(tokens, p.lexer.token)
 	}
+	if nesting > 0 {
+		return nil, p.eofErr()
+	}
+	return tokens, nil
+}
+
+// applyGlobal parses the directives of the global options
+// block for the current server block, after its own. Of the
+// directives that may appear only once in a path scope, the
+// global ones are skipped if the server block has its own;
+// the others, such as header and rewrite, add to those of
+// the server block, whose own come first.
+func (p *parser) applyGlobal() error {
+	if len(p.global) == 0 {
+		return nil
+	}
+
+	// Read tokens from the global options for a while
+	outerLexer, outerUnused := p.lexer, p.unused
+	p.lexer, p.unused = lexer{}, nil
+	p.lexer.loadTokens(p.global)
+	p.scope = &p.other[0]
+	p.defaults = true
+	p.defaulted = make(map[string]bool)
 
+	err := p.directives()
+
+	p.defaults = false
+	p.lexer, p.unused = outerLexer, outerUnused
+
+	return err
+}
+
+// skipDirective consumes the tokens of the current directive
+// without parsing it: the rest of its line and its block.
+func (p *parser) skipDirective() error {
+	line := p.line()
+	nesting := 0
+	for p.next() {
+		if p.tkn() == "{" {
+			nesting++
+		} else if p.line() > line && nesting == 0 {
+			p.unused = &p.lexer.token
+			break
+		} else if p.tkn() == "}" && nesting > 0 {
+			nesting--
+		} else if p.tkn() == "}" && nesting == 0 {
+			return p.err("Syntax", "Unexpected '}' because no matching opening brace")
+		}
+	}
+	if nesting > 0 {
+		return p.eofErr()
+	}
 	return nil
 }
 
+// importSnippet parses the directives of the snippet named
+// name as if they appeared in place of the current token.
+func (p *parser) importSnippet(name string) error {
+	for _, inlining := range p.inlining {
+		if inlining == name {
+			return p.err("Parse", "Circular import of snippet '"+name+"'")
+		}
+	}
+
+	// Read tokens from the snippet for a while
+	outerLexer := p.lexer
+	p.lexer = lexer{}
+	p.lexer.loadTokens(p.snippets[name])
+	p.inlining = append(p.inlining, name)
+
+	err := p.directives()
+
+	p.inlining = p.inlining[:len(p.inlining)-1]
+	p.lexer = outerLexer
+
+	return err
+}
+
 // tkn is shorthand to get the text/value of the current token.
 func (p *parser) tkn() string {
 	if p.unused != nil {
@@ -200,9 +583,45 @@ func (p *parser) eofErr() error {
 	return p.err("Syntax", "Unexpected EOF")
 }
 
-// err creates an error with a custom message msg: "{{kind}} error: {{msg}}". The
-// file name and line number are included in the error message.
+// column is shorthand to get the column number of the current token.
+func (p *parser) column() int {
+	if p.unused != nil {
+		return p.unused.column
+	}
+	return p.lexer.token.column
+}
+
+// err creates a *ParseError of the given kind with a custom message
+// msg at the position of the current token.
 func (p *parser) err(kind, msg string) error {
-	msg = fmt.Sprintf("%s:%d - %s error: %s", p.filename, p.line(), kind, msg)
-	return errors.New(msg)
+	return &ParseError{
+		Filename: p.filename,
+		Line:     p.line(),
+		Column:   p.column(),
+		Kind:     kind,
+		Message:  msg,
+	}
+}
+
+// ParseError is an error in a configuration file. It is
+// returned by Load for syntax errors and invalid directives.
+type ParseError struct {
+	Filename string
+	Line     int
+	Column   int    // 0 if unknown
+	Kind     string // "Syntax" or "Parse"
+	Message  string
+}
+
+// Error returns the error message, which begins with the
+// position of the error: "{{file}}:{{line}}:{{column}}: ".
+// Without a file name, it begins with "line {{line}}: ".
+func (e *ParseError) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("line %d: %s error: %s", e.Line, e.Kind, e.Message)
+	}
+	if e.Column == 0 {
+		return fmt.Sprintf("%s:%d: %s error: %s", e.Filename, e.Line, e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s error: %s", e.Filename, e.Line, e.Column, e.Kind, e.Message)
 }
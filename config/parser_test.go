@@ -2,31 +2,42 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
-)
+	"time"
 
-func TestNewParser(t *testing.T) {
-	filePath := "./parser_test.go"
-	expected := "parser_test.go"
+	"github.com/mholt/caddy/middleware/browse"
+)
 
-	file, err := os.Open(filePath)
+func TestParserFilename(t *testing.T) {
+	// Errors name the file by the path it was loaded with,
+	// like the ConfigFile of its sites
+	filename := filepath.Join(t.TempDir(), "Caddyfile")
+	err := os.WriteFile(filename, []byte("localhost:8080\nfoobar"), 0644)
 	if err != nil {
-		t.Fatal("Could not open file")
+		t.Fatal(err)
+	}
+
+	_, err = Load(filename)
+	if err == nil {
+		t.Fatal("Expected an error for an invalid directive, but got none")
+	}
+	if perr, ok := err.(*ParseError); !ok || perr.Filename != filename {
+		t.Errorf("Expected a parse error in %s, got %v", filename, err)
 	}
-	defer file.Close()
 
-	p, err := newParser(file)
+	err = os.WriteFile(filename, []byte("localhost:8080"), 0644)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if p.filename != expected {
-		t.Errorf("Expected parser to have filename '%s' but had '%s'", expected, p.filename)
+	cfgs, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
 	}
-
-	if p == nil {
-		t.Error("Expected parser to not be nil, but it was")
+	if cfgs[0].ConfigFile != filename {
+		t.Errorf("Expected ConfigFile %s, got %s", filename, cfgs[0].ConfigFile)
 	}
 }
 
@@ -65,6 +76,286 @@ func TestParserBasic(t *testing.T) {
 	}
 }
 
+func TestParserTLSProtocols(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		min, max  string
+	}{
+		{`localhost:443
+		  tls cert.pem key.pem`, false, "", ""},
+		{`localhost:443
+		  tls cert.pem key.pem {
+			  protocols tls1.2
+		  }`, false, "tls1.2", "tls1.3"},
+		{`localhost:443
+		  tls cert.pem key.pem {
+			  protocols tls1.1 tls1.2
+		  }
+		  root /test/www`, false, "tls1.1", "tls1.2"},
+		{`localhost:443
+		  tls cert.pem key.pem {
+			  protocols tls1.3 tls1.2
+		  }`, true, "", ""},
+		{`localhost:443
+		  tls cert.pem key.pem {
+			  protocols ssl2
+		  }`, true, "", ""},
+		{`localhost:443
+		  tls cert.pem key.pem {
+			  protocols
+		  }`, true, "", ""},
+		{`localhost:443
+		  tls cert.pem key.pem {
+			  protocols tls1.2`, true, "", ""},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		confs, err := p.parse()
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, but got '%s'", i, err)
+			continue
+		}
+		if confs[0].TLS.ProtocolMinVersion != test.min {
+			t.Errorf("Test %d: Expected min protocol '%s', got '%s'", i, test.min, confs[0].TLS.ProtocolMinVersion)
+		}
+		if confs[0].TLS.ProtocolMaxVersion != test.max {
+			t.Errorf("Test %d: Expected max protocol '%s', got '%s'", i, test.max, confs[0].TLS.ProtocolMaxVersion)
+		}
+	}
+}
+
+func TestParserTLSCiphers(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`localhost:443
+		tls cert.pem key.pem {
+			ciphers ECDHE-RSA-AES128-GCM-SHA256 ECDHE-RSA-AES256-GCM-SHA384
+		}`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	expected := []uint16{SupportedCiphers["ECDHE-RSA-AES128-GCM-SHA256"], SupportedCiphers["ECDHE-RSA-AES256-GCM-SHA384"]}
+	if len(confs[0].TLS.Ciphers) != len(expected) {
+		t.Fatalf("Expected %d ciphers, got %d: %v", len(expected), len(confs[0].TLS.Ciphers), confs[0].TLS.Ciphers)
+	}
+	for i, cipher := range expected {
+		if confs[0].TLS.Ciphers[i] != cipher {
+			t.Errorf("Expected cipher %d to be %#x, got %#x", i, cipher, confs[0].TLS.Ciphers[i])
+		}
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`localhost:443
+		tls cert.pem key.pem {
+			ciphers ECDHE-RSA-AES128-GCM-SHA256 FOO-BAR
+		}`))
+
+	_, err = p.parse()
+	if err == nil {
+		t.Fatal("Expected an error for unknown cipher, but got none")
+	}
+	if !strings.Contains(err.Error(), "FOO-BAR") || !strings.Contains(err.Error(), "test:3") {
+		t.Errorf("Expected error to name the cipher and line, got '%s'", err)
+	}
+}
+
+func TestParserTLSHTTP2(t *testing.T) {
+	for i, test := range []struct {
+		input        string
+		disableHTTP2 bool
+		shouldErr    bool
+	}{
+		{"tls cert.pem key.pem", false, false},
+		{"tls cert.pem key.pem {\n http2 off\n}", true, false},
+		{"tls cert.pem key.pem {\n http2 on\n}", false, false},
+		{"tls cert.pem key.pem {\n http2 maybe\n}", false, true},
+		{"tls cert.pem key.pem {\n http2\n}", false, true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("localhost:443\n" + test.input))
+
+		confs, err := p.parse()
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		if confs[0].TLS.DisableHTTP2 != test.disableHTTP2 {
+			t.Errorf("Test %d: Expected DisableHTTP2 to be %v, got %v", i, test.disableHTTP2, confs[0].TLS.DisableHTTP2)
+		}
+	}
+}
+
+func TestParserTLSHTTP3(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		http3     bool
+		shouldErr bool
+	}{
+		{"tls cert.pem key.pem", false, false},
+		{"tls cert.pem key.pem {\n experimental_http3\n}", true, false},
+		{"tls cert.pem key.pem {\n experimental_http3 on\n}", false, true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("localhost:443\n" + test.input))
+
+		confs, err := p.parse()
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		if confs[0].TLS.HTTP3 != test.http3 {
+			t.Errorf("Test %d: Expected HTTP3 to be %v, got %v", i, test.http3, confs[0].TLS.HTTP3)
+		}
+	}
+}
+
+func TestParserTLSClients(t *testing.T) {
+	for i, test := range []struct {
+		input      string
+		clientAuth string
+		clientCAs  []string
+		shouldErr  bool
+	}{
+		{"clients ca.pem", "verify", []string{"ca.pem"}, false},
+		{"clients request ca1.pem ca2.pem", "request", []string{"ca1.pem", "ca2.pem"}, false},
+		{"clients require", "require", nil, false},
+		{"clients verify", "", nil, true},
+		{"clients request", "", nil, true},
+		{"clients", "", nil, true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("localhost:443\ntls cert.pem key.pem {\n" + test.input + "\n}"))
+
+		confs, err := p.parse()
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		if confs[0].TLS.ClientAuth != test.clientAuth {
+			t.Errorf("Test %d: Expected client auth '%s', got '%s'", i, test.clientAuth, confs[0].TLS.ClientAuth)
+		}
+		if !reflect.DeepEqual(confs[0].TLS.ClientCAs, test.clientCAs) {
+			t.Errorf("Test %d: Expected client CAs %v, got %v", i, test.clientCAs, confs[0].TLS.ClientCAs)
+		}
+	}
+}
+
+func TestParserTLSOff(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`(secure) {
+				  tls cert.pem key.pem
+			  }
+
+			  public.com:443 {
+				  import secure
+			  }
+
+			  internal.lan:8080 {
+				  import secure
+				  tls off
+			  }`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 2 {
+		t.Fatalf("Expected 2 configurations, but got %d: %#v", len(confs), confs)
+	}
+	if !confs[0].TLS.Enabled || confs[0].TLS.Certificate != "cert.pem" {
+		t.Errorf("Expected TLS to be enabled with cert.pem for %s, got %#v", confs[0].Address(), confs[0].TLS)
+	}
+	if confs[1].TLS.Enabled || confs[1].TLS.Certificate != "" {
+		t.Errorf("Expected TLS to be off for %s, got %#v", confs[1].Address(), confs[1].TLS)
+	}
+
+	// With a key, "off" is just the name of a certificate file
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader("localhost:443\ntls off key.pem"))
+	confs, err = p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if !confs[0].TLS.Enabled || confs[0].TLS.Certificate != "off" {
+		t.Errorf("Expected TLS to be enabled with certificate 'off', got %#v", confs[0].TLS)
+	}
+}
+
+func TestParserHTTPAndHTTPS(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`http://example.com, https://example.com {
+				  root /www
+				  tls cert.pem key.pem
+			  }`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	confs = appendRedirects(confs)
+	if len(confs) != 2 {
+		t.Fatalf("Expected 2 configurations and no redirect, but got %d: %#v", len(confs), confs)
+	}
+	if confs[0].Port != "http" || confs[0].TLS.Enabled || confs[0].TLS.Certificate != "" {
+		t.Errorf("Expected %s to be served without TLS, got %#v", confs[0].Address(), confs[0].TLS)
+	}
+	if confs[1].Port != "https" || !confs[1].TLS.Enabled || confs[1].TLS.Certificate != "cert.pem" {
+		t.Errorf("Expected %s to be served with TLS and cert.pem, got %#v", confs[1].Address(), confs[1].TLS)
+	}
+	for _, conf := range confs {
+		if conf.Root != "/www" {
+			t.Errorf("Expected root '/www' for %s, got '%s'", conf.Address(), conf.Root)
+		}
+	}
+}
+
+func TestParserTLSMultipleCertificates(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`localhost:443
+		tls cert1.pem key1.pem
+		tls cert2.pem key2.pem`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+
+	pairs := confs[0].TLS.Pairs()
+	if len(pairs) != 2 {
+		t.Fatalf("Expected 2 certificate pairs, got %d: %#v", len(pairs), pairs)
+	}
+	if pairs[0].Certificate != "cert1.pem" || pairs[0].Key != "key1.pem" {
+		t.Errorf("Expected first pair to be cert1.pem and key1.pem, got %#v", pairs[0])
+	}
+	if pairs[1].Certificate != "cert2.pem" || pairs[1].Key != "key2.pem" {
+		t.Errorf("Expected second pair to be cert2.pem and key2.pem, got %#v", pairs[1])
+	}
+}
+
 func TestParserBasicWithMultipleServerBlocks(t *testing.T) {
 	p := &parser{filename: "test"}
 
@@ -260,6 +551,276 @@ func TestParserBasicWithAlternateAddressStyles(t *testing.T) {
 	}
 }
 
+func TestParserAddressHosts(t *testing.T) {
+	for i, test := range []struct {
+		input, host, port, address string
+	}{
+		{"127.0.0.1:8080", "127.0.0.1", "8080", "127.0.0.1:8080"},
+		{"127.0.0.1", "127.0.0.1", defaultPort, "127.0.0.1:" + defaultPort},
+		{"[::1]:8080", "::1", "8080", "[::1]:8080"},
+		{"[::1]", "::1", defaultPort, "[::1]:" + defaultPort},
+		{"::1", "::1", defaultPort, "[::1]:" + defaultPort},
+		{"https://[::1]", "::1", "https", "[::1]:https"},
+		{"[::]:80", "::", "80", "[::]:80"},
+		{"example.com:8080", "example.com", "8080", "example.com:8080"},
+		{"example.com", "example.com", defaultPort, "example.com:" + defaultPort},
+		{":8080", "", "8080", ":8080"},
+		{"localhost:0", "localhost", "0", "localhost:0"}, // the system chooses the port
+		{"*:80", "*", "80", "*:80"},
+		{"*.example.com", "*.example.com", defaultPort, "*.example.com:" + defaultPort},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		confs, err := p.parse()
+		if err != nil {
+			t.Errorf("Test %d (%s): Expected no errors, but got '%s'", i, test.input, err)
+			continue
+		}
+		if confs[0].Host != test.host {
+			t.Errorf("Test %d (%s): Expected host '%s', got '%s'", i, test.input, test.host, confs[0].Host)
+		}
+		if confs[0].Port != test.port {
+			t.Errorf("Test %d (%s): Expected port '%s', got '%s'", i, test.input, test.port, confs[0].Port)
+		}
+		if confs[0].Address() != test.address {
+			t.Errorf("Test %d (%s): Expected address '%s', got '%s'", i, test.input, test.address, confs[0].Address())
+		}
+	}
+}
+
+func TestParserAddressDefaultPort(t *testing.T) {
+	for i, test := range []struct {
+		input string
+		ports []string
+	}{
+		{"example.com", []string{defaultPort}},
+		{"example.com {\n tls cert.pem key.pem\n}", []string{"443"}},
+		{"example.com:8443 {\n tls cert.pem key.pem\n}", []string{"8443"}},
+		{"example.com, http://example.com {\n tls cert.pem key.pem\n}", []string{"443", "http"}},
+		{"[::1] {\n tls cert.pem key.pem\n}", []string{"443"}},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		confs, err := p.parse()
+		if err != nil {
+			t.Errorf("Test %d: Expected no errors, but got '%s'", i, err)
+			continue
+		}
+		var ports []string
+		for _, conf := range confs {
+			ports = append(ports, conf.Port)
+		}
+		if !reflect.DeepEqual(ports, test.ports) {
+			t.Errorf("Test %d: Expected ports %v, got %v", i, test.ports, ports)
+		}
+	}
+
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader("example.com:"))
+	if _, err := p.parse(); err == nil {
+		t.Error("Expected an error for an address with an empty port, but got none")
+	}
+}
+
+func TestParserMultiplePortsPerHost(t *testing.T) {
+	for _, input := range []string{
+		`host:80,8080
+		 root /public_html`, // port list
+
+		`host:80, host:8080
+		 root /public_html`, // repeated address
+
+		`host:80,
+		 host:8080 {
+			root /public_html
+		 }`, // repeated address, newlines, block
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(input))
+
+		confs, err := p.parse()
+		if err != nil {
+			t.Fatalf("Expected no errors, but got '%s'", err)
+		}
+		if len(confs) != 2 {
+			t.Fatalf("Expected 2 configurations, but got %d: %#v", len(confs), confs)
+		}
+
+		for i, port := range []string{"80", "8080"} {
+			if confs[i].Host != "host" {
+				t.Errorf("Expected host of conf %d to be 'host', got '%s'", i, confs[i].Host)
+			}
+			if confs[i].Port != port {
+				t.Errorf("Expected port of conf %d to be '%s', got '%s'", i, port, confs[i].Port)
+			}
+			if confs[i].Root != "/public_html" {
+				t.Errorf("Expected root of conf %d to be '/public_html', got '%s'", i, confs[i].Root)
+			}
+		}
+	}
+
+	for _, input := range []string{
+		`host:80,80`,
+		`host:80,8080,80`,
+		`host:0,0`,
+		`host:`,
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(input))
+
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Expected an error for input '%s', but got none", input)
+		}
+	}
+}
+
+func TestParserDuplicateAddresses(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		errMsg string // empty if no error is expected
+	}{
+		{"host:80, host:8080", ""},
+		{"host:80, other:80", ""},
+		{"host:80, host:80", "test:1:10: Parse error: Duplicate address 'host:80'"},
+		{"host:80,\nHOST:80 {\n}", "test:2:1: Parse error: Duplicate address 'HOST:80'"},
+		{"host:80,8080 host:8080", "Duplicate address 'host:8080'"},
+		{"host host", "Duplicate address 'host'"},
+		{"unix:/tmp/a.sock unix:/tmp/a.sock", "Duplicate address 'unix:/tmp/a.sock'"},
+		{"host host:2015", "Duplicate address 'host:2015'"},
+		{"host host:2015 {\ntls cert.pem key.pem\n}", ""},
+		{"host:443 host {\ntls cert.pem key.pem\n}", "Duplicate address 'host'"},
+		{"host:80 http://host:80", "Duplicate address 'http://host:80'"},
+		{"http://host host:80", "Duplicate address 'host:80'"},
+		{"https://host host:443", "Duplicate address 'host:443'"},
+		{"host:8080 http://host:8080", ""},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		_, err := p.parse()
+		if test.errMsg == "" {
+			if err != nil {
+				t.Errorf("Test %d: Expected no errors, but got '%s'", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+			t.Errorf("Test %d: Expected error containing '%s', got '%v'", i, test.errMsg, err)
+		}
+	}
+}
+
+func TestParserHostRootDirectives(t *testing.T) {
+	for i, test := range []struct {
+		directive string
+		shouldErr bool
+	}{
+		{"gzip", false},
+		{"header / X-Site {host}", false},
+		{"try_files {path} /index.html", true},
+		{"markdown /", true},
+		{"templates", true},
+		{"browse", true},
+		{"ext .html", true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("localhost:8080\nroot /sites/{host}\n" + test.directive))
+
+		_, err := p.parse()
+		if test.shouldErr {
+			if err == nil || !strings.Contains(err.Error(), "test:3:1:") || !strings.Contains(err.Error(), "{host} or {label}") {
+				t.Errorf("Test %d: Expected an error for %s at line 3 about the root, got '%v'", i, test.directive, err)
+			}
+		} else if err != nil {
+			t.Errorf("Test %d: Expected no errors for %s, but got '%s'", i, test.directive, err)
+		}
+	}
+}
+
+func TestParserEnvVars(t *testing.T) {
+	os.Setenv("CADDY_TEST_HOST", "example.com")
+	os.Setenv("CADDY_TEST_PORT", "8080")
+	os.Unsetenv("CADDY_TEST_UNSET")
+	defer os.Unsetenv("CADDY_TEST_HOST")
+	defer os.Unsetenv("CADDY_TEST_PORT")
+
+	input := `{$CADDY_TEST_HOST}:{$CADDY_TEST_PORT}
+			  root /www/{$CADDY_TEST_HOST}{$CADDY_TEST_UNSET}/public`
+
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(input))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].Host != "example.com" {
+		t.Errorf("Expected host to be 'example.com', got '%s'", confs[0].Host)
+	}
+	if confs[0].Port != "8080" {
+		t.Errorf("Expected port to be '8080', got '%s'", confs[0].Port)
+	}
+	if confs[0].Root != "/www/example.com/public" {
+		t.Errorf("Expected root to be '/www/example.com/public', got '%s'", confs[0].Root)
+	}
+
+	p = &parser{filename: "test", strict: true}
+	p.lexer.load(strings.NewReader(input))
+
+	_, err = p.parse()
+	if err == nil {
+		t.Fatal("Expected an error for unset variable in strict mode, but got none")
+	}
+	if !strings.Contains(err.Error(), "CADDY_TEST_UNSET") || !strings.Contains(err.Error(), "test:2") {
+		t.Errorf("Expected error to name the variable and line, got '%s'", err)
+	}
+}
+
+func TestParserStartupShutdown(t *testing.T) {
+	input := `localhost:1234
+			  startup "sh -c true"
+			  startup sh -c "exit 0"
+			  shutdown false`
+
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(input))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if n := len(confs[0].Startup); n != 2 {
+		t.Fatalf("Expected 2 startup functions, got %d", n)
+	}
+	for i, fn := range confs[0].Startup {
+		if err := fn(); err != nil {
+			t.Errorf("Expected startup function %d to succeed, but got '%s'", i, err)
+		}
+	}
+	if n := len(confs[0].Shutdown); n != 1 {
+		t.Fatalf("Expected 1 shutdown function, got %d", n)
+	}
+	if err := confs[0].Shutdown[0](); err == nil || !strings.Contains(err.Error(), "false") {
+		t.Errorf("Expected an error naming the failed command, got '%v'", err)
+	}
+	if expected := []string{"startup sh", "startup sh"}; !reflect.DeepEqual(confs[0].StartupNames, expected) {
+		t.Errorf("Expected startup names %v, got %v", expected, confs[0].StartupNames)
+	}
+	if expected := []string{"shutdown false"}; !reflect.DeepEqual(confs[0].ShutdownNames, expected) {
+		t.Errorf("Expected shutdown names %v, got %v", expected, confs[0].ShutdownNames)
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`localhost:1234
+			  startup`))
+
+	if _, err = p.parse(); err == nil {
+		t.Error("Expected an error for a missing command, but got none")
+	}
+}
+
 func TestParserImport(t *testing.T) {
 	p := &parser{filename: "test"}
 
@@ -294,14 +855,11 @@ func TestParserImport(t *testing.T) {
 	}
 }
 
-func TestParserLocationContext(t *testing.T) {
+func TestParserImportGlob(t *testing.T) {
 	p := &parser{filename: "test"}
 
-	input := `host:123 {
-				/scope {
-					gzip
-				}
-			}`
+	input := `host:123
+			  import import_glob*_test.txt`
 
 	p.lexer.load(strings.NewReader(input))
 
@@ -309,22 +867,784 @@ func TestParserLocationContext(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Expected no errors, but got '%s'", err)
 	}
-	if len(confs) != 1 {
-		t.Fatalf("Expected 1 configuration, but got %d: %#v", len(confs), confs)
+	if confs[0].Root != "/test/glob/public_html" {
+		t.Errorf("Expected root to be '/test/glob/public_html', got '%s'", confs[0].Root)
 	}
-
-	if len(p.other) != 2 {
-		t.Fatalf("Expected 2 path scopes, but got %d: %#v", len(p.other), p.other)
+	if _, ok := p.other[0].directives["gzip"]; !ok {
+		t.Errorf("Expected imported gzip directive, but got: %#v", p.other[0].directives)
 	}
+}
 
-	if p.other[0].path != "/" {
-		t.Fatalf("Expected first path scope to be default '/', but got %d: %#v", p.other[0].path, p.other)
-	}
-	if p.other[1].path != "/scope" {
-		t.Fatalf("Expected first path scope to be '/scope', but got %d: %#v", p.other[0].path, p.other)
-	}
+func TestParserImportCircular(t *testing.T) {
+	p := &parser{filename: "test"}
 
-	if dir, ok := p.other[1].directives["gzip"]; !ok {
-		t.Fatalf("Expected scoped directive to be gzip, but got %d: %#v", dir, p.other[1].directives)
+	input := `host:123
+			  import import_circular_test.txt`
+
+	p.lexer.load(strings.NewReader(input))
+
+	_, err := p.parse()
+	if err == nil {
+		t.Fatal("Expected an error for circular import, but got none")
+	}
+	if !strings.Contains(err.Error(), "Circular import") {
+		t.Errorf("Expected circular import error, got '%s'", err)
+	}
+}
+
+func TestParserLocationContext(t *testing.T) {
+	p := &parser{filename: "test"}
+
+	input := `host:123 {
+				/scope {
+					gzip
+				}
+			}`
+
+	p.lexer.load(strings.NewReader(input))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 1 {
+		t.Fatalf("Expected 1 configuration, but got %d: %#v", len(confs), confs)
+	}
+
+	if len(p.other) != 2 {
+		t.Fatalf("Expected 2 path scopes, but got %d: %#v", len(p.other), p.other)
+	}
+
+	if p.other[0].path != "/" {
+		t.Fatalf("Expected first path scope to be default '/', but got %d: %#v", p.other[0].path, p.other)
+	}
+	if p.other[1].path != "/scope" {
+		t.Fatalf("Expected first path scope to be '/scope', but got %d: %#v", p.other[0].path, p.other)
+	}
+
+	if dir, ok := p.other[1].directives["gzip"]; !ok {
+		t.Fatalf("Expected scoped directive to be gzip, but got %d: %#v", dir, p.other[1].directives)
+	}
+
+	if n := len(confs[0].Middleware["/scope"]); n != 1 {
+		t.Errorf("Expected 1 middleware for '/scope', got %d", n)
+	}
+	if n := len(confs[0].Middleware["/"]); n != 0 {
+		t.Errorf("Expected no middleware for '/', got %d", n)
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123 {
+				/scope {
+					gzip
+				}
+				/scope {
+					header / X-Scope yes
+				}
+			}`))
+
+	confs, err = p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(p.other) != 2 {
+		t.Errorf("Expected repeated path scope to be merged into 2 scopes, but got %d", len(p.other))
+	}
+	if n := len(confs[0].Middleware["/scope"]); n != 2 {
+		t.Errorf("Expected 2 middleware for repeated '/scope', got %d", n)
+	}
+}
+
+func TestParserComments(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`# A site with comments everywhere
+
+		localhost:8080, # the first address
+		localhost:8081  # the second address
+		{ # opening the block
+
+			# on its own line
+			root /tmp # trailing a directive
+
+			timeouts { # opening a directive block
+				# inside a directive block
+				read 10s # trailing a subdirective
+
+			} # closing a directive block
+
+			/api { # opening a path scope
+				# inside a path scope
+				gzip # trailing a middleware directive
+			}
+		} # closing the block
+
+		# between server blocks
+
+		example.com:80 # without a block
+		root /var/www # trailing a directive
+		# at the end`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 3 {
+		t.Fatalf("Expected 3 configurations, but got %d: %#v", len(confs), confs)
+	}
+	for _, conf := range confs[:2] {
+		if conf.Root != "/tmp" {
+			t.Errorf("Expected root for %s to be '/tmp', got '%s'", conf.Address(), conf.Root)
+		}
+		if conf.ReadTimeout != 10*time.Second {
+			t.Errorf("Expected read timeout for %s to be 10s, got %s", conf.Address(), conf.ReadTimeout)
+		}
+		if len(conf.Middleware["/api"]) != 1 {
+			t.Errorf("Expected one middleware for %s in /api, got %d", conf.Address(), len(conf.Middleware["/api"]))
+		}
+	}
+	if confs[2].Address() != "example.com:80" || confs[2].Root != "/var/www" {
+		t.Errorf("Expected example.com:80 with root '/var/www', got %s with root '%s'", confs[2].Address(), confs[2].Root)
+	}
+}
+
+func TestParserBind(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`example.com:8080
+			  bind 127.0.0.1`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].Host != "example.com" {
+		t.Errorf("Expected host to remain 'example.com', got '%s'", confs[0].Host)
+	}
+	if confs[0].BindAddress != "127.0.0.1" {
+		t.Errorf("Expected bind address '127.0.0.1', got '%s'", confs[0].BindAddress)
+	}
+	if addr := confs[0].ListenAddress(); addr != "127.0.0.1:8080" {
+		t.Errorf("Expected listen address '127.0.0.1:8080', got '%s'", addr)
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`example.com:8080
+			  bind [::1]`))
+
+	confs, err = p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if addr := confs[0].ListenAddress(); addr != "[::1]:8080" {
+		t.Errorf("Expected listen address '[::1]:8080', got '%s'", addr)
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`example.com:8080
+			  bind localhost`))
+
+	if _, err = p.parse(); err == nil {
+		t.Error("Expected an error for a bind address that isn't an IP, but got none")
+	}
+
+	if addr := (Config{Host: "example.com", Port: "80"}).ListenAddress(); addr != "example.com:80" {
+		t.Errorf("Expected listen address to default to 'example.com:80', got '%s'", addr)
+	}
+}
+
+func TestParserNetwork(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`example.com:8080
+			  network tcp6`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].Network != "tcp6" {
+		t.Errorf("Expected network 'tcp6', got '%s'", confs[0].Network)
+	}
+	if network := confs[0].ListenNetwork(); network != "tcp6" {
+		t.Errorf("Expected listen network 'tcp6', got '%s'", network)
+	}
+
+	if network := (Config{Host: "example.com", Port: "80"}).ListenNetwork(); network != "tcp" {
+		t.Errorf("Expected listen network to default to 'tcp', got '%s'", network)
+	}
+	if network := (Config{Socket: "/tmp/caddy.sock"}).ListenNetwork(); network != "unix" {
+		t.Errorf("Expected listen network 'unix' for a socket, got '%s'", network)
+	}
+
+	for _, input := range []string{
+		"example.com:8080\nnetwork udp",
+		"example.com:8080\nnetwork",
+		"unix:/tmp/caddy.sock\nnetwork tcp4",
+	} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(input))
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Expected an error for input %q, but got none", input)
+		}
+	}
+}
+
+func TestParserUnixSocket(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`unix:/var/run/caddy.sock
+			  socket_mode 0660`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].Socket != "/var/run/caddy.sock" {
+		t.Errorf("Expected socket '/var/run/caddy.sock', got '%s'", confs[0].Socket)
+	}
+	if confs[0].Host != "" || confs[0].Port != "" {
+		t.Errorf("Expected no host or port, got '%s' and '%s'", confs[0].Host, confs[0].Port)
+	}
+	if confs[0].SocketMode != 0660 {
+		t.Errorf("Expected socket mode 0660, got %o", confs[0].SocketMode)
+	}
+	if addr := confs[0].Address(); addr != "unix:/var/run/caddy.sock" {
+		t.Errorf("Expected address 'unix:/var/run/caddy.sock', got '%s'", addr)
+	}
+	if addr := confs[0].ListenAddress(); addr != "unix:/var/run/caddy.sock" {
+		t.Errorf("Expected listen address 'unix:/var/run/caddy.sock', got '%s'", addr)
+	}
+	if len(confs[0].Shutdown) != 1 {
+		t.Errorf("Expected a shutdown function to remove the socket, got %d", len(confs[0].Shutdown))
+	}
+
+	for _, input := range []string{
+		"unix:",
+		"unix:/tmp/caddy.sock\nsocket_mode rw",
+		"unix:/tmp/caddy.sock\nsocket_mode 1777",
+		"localhost:8080\nsocket_mode 0660",
+		"unix:/tmp/caddy.sock\ntls cert.pem key.pem",
+	} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(input))
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Expected an error for input %q, but got none", input)
+		}
+	}
+}
+
+func TestParserPathRoot(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123 {
+				root /www
+				/downloads {
+					root /mnt/downloads
+				}
+			}`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].Root != "/www" {
+		t.Errorf("Expected root to be '/www', got '%s'", confs[0].Root)
+	}
+	if root := confs[0].PathRoots["/downloads"]; root != "/mnt/downloads" {
+		t.Errorf("Expected root for '/downloads' to be '/mnt/downloads', got '%s'", root)
+	}
+
+	for path, expected := range map[string]string{
+		"/":                   "/www",
+		"/index.html":         "/www",
+		"/downloads/file.zip": "/mnt/downloads",
+	} {
+		if root := confs[0].RootFor(path); root != expected {
+			t.Errorf("Expected root for '%s' to be '%s', got '%s'", path, expected, root)
+		}
+	}
+}
+
+func TestParserIndex(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  []string
+		shouldErr bool
+	}{
+		{"", browse.IndexPages, false},
+		{"index home.html", []string{"home.html"}, false},
+		{"index index.html index.htm default.html", []string{"index.html", "index.htm", "default.html"}, false},
+		{"index", nil, true},
+		{"index a.html\nindex b.html", nil, true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + test.input))
+
+		confs, err := p.parse()
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		if !reflect.DeepEqual(confs[0].Indexes(), test.expected) {
+			t.Errorf("Test %d: Expected index files %v, got %v", i, test.expected, confs[0].Indexes())
+		}
+	}
+}
+
+func TestParserTimeouts(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123
+			  timeouts 30s`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].ReadTimeout != 30*time.Second || confs[0].WriteTimeout != 30*time.Second || confs[0].IdleTimeout != 30*time.Second {
+		t.Errorf("Expected all timeouts to be 30s, got read %s, write %s, idle %s",
+			confs[0].ReadTimeout, confs[0].WriteTimeout, confs[0].IdleTimeout)
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123
+			  timeouts {
+				  read 10s
+				  idle 2m
+			  }`))
+
+	confs, err = p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].ReadTimeout != 10*time.Second {
+		t.Errorf("Expected read timeout to be 10s, got %s", confs[0].ReadTimeout)
+	}
+	if confs[0].WriteTimeout != 0 {
+		t.Errorf("Expected write timeout to be unset, got %s", confs[0].WriteTimeout)
+	}
+	if confs[0].IdleTimeout != 2*time.Minute {
+		t.Errorf("Expected idle timeout to be 2m, got %s", confs[0].IdleTimeout)
+	}
+
+	for i, input := range []string{
+		`timeouts`,
+		`timeouts forever`,
+		`timeouts -1s`,
+		`timeouts {
+			read 10
+		}`,
+		`timeouts {
+			connect 10s
+		}`,
+		`timeouts {
+			read 10s`,
+	} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + input))
+
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
+	}
+}
+
+func TestParserPathTimeouts(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123
+			  timeouts 30s
+			  /upload {
+				  timeouts {
+					  write 10m
+				  }
+			  }
+			  /slow {
+				  timeouts 1m
+			  }`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].WriteTimeout != 30*time.Second {
+		t.Errorf("Expected the site's write timeout to stay 30s, got %s", confs[0].WriteTimeout)
+	}
+	if got, ok := confs[0].TimeoutsFor("/upload/file"); !ok || got != (Timeouts{Write: 10 * time.Minute}) {
+		t.Errorf("Expected /upload to have a write timeout of 10m, got %+v (%v)", got, ok)
+	}
+	if got, _ := confs[0].TimeoutsFor("/slow"); got != (Timeouts{Read: time.Minute, Write: time.Minute}) {
+		t.Errorf("Expected /slow to have timeouts of 1m, got %+v", got)
+	}
+	if _, ok := confs[0].TimeoutsFor("/other"); ok {
+		t.Error("Expected no timeouts for /other")
+	}
+
+	p = &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123
+			  /upload {
+				  timeouts {
+					  idle 10m
+				  }
+			  }`))
+	if _, err := p.parse(); err == nil {
+		t.Error("Expected an error for an idle timeout in a path block, but got none")
+	}
+}
+
+func TestParserMaxConns(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader("host:123\nmax_conns 100"))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].MaxConns != 100 {
+		t.Errorf("Expected max conns to be 100, got %d", confs[0].MaxConns)
+	}
+
+	for i, input := range []string{
+		`max_conns`,
+		`max_conns 0`,
+		`max_conns -5`,
+		`max_conns many`,
+		"max_conns 10\nmax_conns 20",
+	} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + input))
+
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
+	}
+}
+
+func TestParserMIME(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`host:123
+		mime .WASM application/wasm
+		mime {
+			.webmanifest application/manifest+json
+			.foo         text/plain
+		}`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	expected := map[string]string{
+		".wasm":        "application/wasm",
+		".webmanifest": "application/manifest+json",
+		".foo":         "text/plain",
+	}
+	if !reflect.DeepEqual(confs[0].MIMETypes, expected) {
+		t.Errorf("Expected MIME types %v, got %v", expected, confs[0].MIMETypes)
+	}
+
+	for i, input := range []string{
+		`mime`,
+		`mime .wasm`,
+		`mime wasm application/wasm`,
+		`mime . application/wasm`,
+		"mime {\n.wasm\n}",
+		"mime {\n.wasm application/wasm",
+	} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + input))
+
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
+	}
+}
+
+func TestParserFollowSymlinks(t *testing.T) {
+	for i, test := range []struct {
+		input    string
+		disabled bool
+	}{
+		{"", false},
+		{"follow_symlinks on", false},
+		{"follow_symlinks off", true},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + test.input))
+
+		confs, err := p.parse()
+		if err != nil {
+			t.Fatalf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+		if confs[0].DisableSymlinks != test.disabled {
+			t.Errorf("Test %d: Expected DisableSymlinks to be %v, got %v", i, test.disabled, confs[0].DisableSymlinks)
+		}
+	}
+
+	for i, input := range []string{
+		`follow_symlinks`,
+		`follow_symlinks maybe`,
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + input))
+
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
+	}
+}
+
+func TestParserUserGroup(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader("host:123\nuser www-data\ngroup 33"))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if confs[0].User != "www-data" || confs[0].Group != "33" {
+		t.Errorf("Expected user www-data and group 33, got '%s' and '%s'", confs[0].User, confs[0].Group)
+	}
+
+	for i, input := range []string{`user`, `group`, "user a\nuser b"} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader("host:123\n" + input))
+
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
+	}
+}
+
+func TestParserErrorPosition(t *testing.T) {
+	p := &parser{filename: "Caddyfile"}
+	p.lexer.load(strings.NewReader(`host:123 {
+				root /www
+			   foobar
+			}`))
+
+	_, err := p.parse()
+	if err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected a *ParseError, got %T", err)
+	}
+	if parseErr.Filename != "Caddyfile" || parseErr.Line != 3 || parseErr.Column != 7 {
+		t.Errorf("Expected error at Caddyfile:3:7, got %s:%d:%d", parseErr.Filename, parseErr.Line, parseErr.Column)
+	}
+	if parseErr.Kind != "Syntax" {
+		t.Errorf("Expected a Syntax error, got '%s'", parseErr.Kind)
+	}
+	if !strings.HasPrefix(err.Error(), "Caddyfile:3:7: ") || !strings.Contains(err.Error(), "foobar") {
+		t.Errorf("Expected error message to start with 'Caddyfile:3:7: ' and name the token, got '%s'", err)
+	}
+
+	p = &parser{filename: "Caddyfile"}
+	p.lexer.load(strings.NewReader(`host:123
+			  gzip {
+				  level 10
+			  }`))
+
+	_, err = p.parse()
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("Expected middleware errors to be a *ParseError too, got %T: %v", err, err)
+	}
+}
+
+func TestParserSnippets(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`(common) {
+				gzip
+				proxy /api localhost:9000 {
+					health_check /ping 10s
+				}
+			}
+			host1.com {
+				import common
+				root /www/host1
+			}
+			host2.com {
+				import common
+			}`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 2 {
+		t.Fatalf("Expected 2 configurations (none for the snippet), but got %d: %#v", len(confs), confs)
+	}
+	if confs[0].Root != "/www/host1" {
+		t.Errorf("Expected directives after import to apply; root was '%s'", confs[0].Root)
+	}
+	for i, conf := range confs {
+		if n := len(conf.Middleware["/"]); n != 2 {
+			t.Errorf("Config %d: Expected 2 middleware from the snippet, got %d", i, n)
+		}
+	}
+
+	for i, test := range []struct {
+		input, expected string
+	}{
+		{`host1.com {
+			  import undefined
+		  }`, "undefined"},
+		{`(common) {
+			  import common
+		  }
+		  host1.com {
+			  import common
+		  }`, "Circular"},
+		{`(common) {
+			  gzip
+		  }
+		  (common) {
+			  gzip
+		  }`, "already defined"},
+		{`(common) {
+			  gzip`, "EOF"},
+	} {
+		p = &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		_, err := p.parse()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Test %d: Expected an error containing '%s', got '%v'", i, test.expected, err)
+		}
+	}
+}
+
+func TestParserDuplicateDirectives(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`host:123 {
+			  root /www
+			  root /www2
+		  }`, true},
+		{`host:123 {
+			  gzip
+			  gzip
+		  }`, true},
+		{`host1:123 {
+			  gzip
+		  }
+		  host2:123 {
+			  gzip
+		  }`, false},
+		{`host:123 {
+			  root /www
+			  /downloads {
+				  root /downloads
+			  }
+		  }`, false},
+		{`host:123 {
+			  header / X-One 1
+			  header / X-Two 2
+			  proxy /a localhost:8080
+			  proxy /b localhost:8081
+		  }`, false},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		_, err := p.parse()
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		} else if test.shouldErr && !strings.Contains(err.Error(), "test:3:") {
+			t.Errorf("Test %d: Expected the error to identify line 3, got '%s'", i, err)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d: Expected no errors, but got '%s'", i, err)
+		}
+	}
+}
+
+func TestParserDuplicateSites(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		errMsg string // empty if no error is expected
+	}{
+		{"localhost:8080 {\n}\nlocalhost:8081 {\n}", ""},
+		{"localhost:8080 {\n}\n\nexample.com, localhost:8080 {\n}", "test:4:1: Parse error: Site localhost:8080 is already defined on line 1"},
+		{"localhost:8080 {\n}\nLOCALHOST:8080 {\n}", "Site LOCALHOST:8080 is already defined on line 1"},
+		{":8080 {\n}\n0.0.0.0:8080 {\n}", "Site 0.0.0.0:8080 serves the same hosts on the same address as :8080 on line 1"},
+		{"*:80 {\n}\n[::]:80 {\n}", "serves the same hosts"},
+		{"*.example.com:80 {\n}\na.example.com:80 {\n}", ""},
+		{"example.com:80 {\nbind 127.0.0.1\n}\nexample.com:80 {\nbind 127.0.0.2\n}", ""},
+		{"unix:/tmp/a.sock {\n}\nunix:/tmp/a.sock {\n}", "Site unix:/tmp/a.sock is already defined on line 1"},
+		{"host {\n}\nhost:2015 {\n}", "Site host:2015 is already defined on line 1"},
+		{"host:80 {\n}\nhttp://host:80 {\n}", "Site host:80 is already defined on line 1"},
+		{"host:80 {\n}\nhttp://host {\n}", "Site host:http serves the same hosts on the same address as host:80 on line 1"},
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(test.input))
+
+		_, err := p.parse()
+		if test.errMsg == "" {
+			if err != nil {
+				t.Errorf("Test %d: Expected no errors, but got '%s'", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+			t.Errorf("Test %d: Expected error containing '%s', got '%v'", i, test.errMsg, err)
+		}
+	}
+}
+
+func TestParserGlobalOptions(t *testing.T) {
+	p := &parser{filename: "test"}
+	p.lexer.load(strings.NewReader(`{
+				  gzip
+				  timeouts 30s
+				  header / X-Global yes
+				  /api {
+					  header / X-API yes
+				  }
+			  }
+
+			  plain.com:8080 {
+				  root /www
+			  }
+
+			  custom.com:8080 {
+				  timeouts 5s
+				  header / X-Site yes
+			  }`))
+
+	confs, err := p.parse()
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+	if len(confs) != 2 {
+		t.Fatalf("Expected 2 configurations, but got %d: %#v", len(confs), confs)
+	}
+
+	for _, conf := range confs {
+		if !reflect.DeepEqual(conf.MiddlewareNames["/"], []string{"gzip", "header"}) {
+			t.Errorf("Expected gzip and header middleware for %s, got %v", conf.Address(), conf.MiddlewareNames["/"])
+		}
+		if !reflect.DeepEqual(conf.MiddlewareNames["/api"], []string{"header"}) {
+			t.Errorf("Expected header middleware for %s/api, got %v", conf.Address(), conf.MiddlewareNames["/api"])
+		}
+	}
+	if confs[0].Root != "/www" || confs[0].ReadTimeout != 30*time.Second {
+		t.Errorf("Expected root /www and read timeout 30s for %s, got '%s' and %v", confs[0].Address(), confs[0].Root, confs[0].ReadTimeout)
+	}
+	if confs[1].ReadTimeout != 5*time.Second {
+		t.Errorf("Expected the site's own read timeout 5s for %s, got %v", confs[1].Address(), confs[1].ReadTimeout)
+	}
+
+	for i, input := range []string{
+		"localhost:8080 {\n}\n{\n\tgzip\n}",
+		"{\n\tgzip\n\tgzip\n}\nlocalhost:8080",
+		"{\n\tgzip\n",
+	} {
+		p := &parser{filename: "test"}
+		p.lexer.load(strings.NewReader(input))
+		if _, err := p.parse(); err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+		}
 	}
 }
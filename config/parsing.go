@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"strings"
 )
@@ -31,14 +32,29 @@ func (p *parser) begin() error {
 // and/or ":port" portions may be omitted). If multiple
 // addresses are specified, they must be space-
 // separated on the same line, or each token must end
-// with a comma.
+// with a comma. The port portion may be a comma-separated
+// list of ports (e.g. "host:80,8080") to serve the host
+// on each of them. An IPv6 host must be in brackets if
+// a port is given (e.g. "[::1]:8080"). An address of
+// "unix:" followed by a path (e.g. "unix:/var/run/caddy.sock")
+// is a Unix domain socket at that path. An address with the
+// "http://" scheme is served without TLS even if the block
+// has the tls directive, so that one block can serve a site
+// over both HTTP and HTTPS (e.g. "http://example.com,
+// https://example.com"); since the host is then served on
+// port 80, HTTP requests aren't redirected to HTTPS. An
+// address without a port or scheme is served on port 443 if
+// the block has the tls directive, otherwise on the default
+// port (2015); one with just a port (e.g. ":8080") is served
+// for any host. The same address can't be given twice.
 func (p *parser) addresses() error {
 	var expectingAnother bool
 	p.hosts = []hostPort{}
 
-	// address gets host and port in a format accepted by net.Dial
-	address := func(str string) (host, port string, err error) {
-		var schemePort string
+	// address gets host and port(s) in a format accepted by net.Dial,
+	// or no ports if the address doesn't say which
+	address := func(str string) (host string, ports []string, err error) {
+		var port, schemePort string
 
 		if strings.HasPrefix(str, "https://") {
 			schemePort = "https"
@@ -46,8 +62,20 @@ func (p *parser) addresses() error {
 		} else if strings.HasPrefix(str, "http://") {
 			schemePort = "http"
 			str = str[7:]
-		} else if !strings.Contains(str, ":") {
-			str += ":" + defaultPort
+		}
+
+		// An IPv6 literal without a port may or may not be
+		// in brackets, e.g. "[::1]" or "::1"
+		if strings.HasPrefix(str, "[") && strings.HasSuffix(str, "]") {
+			str = str[1 : len(str)-1]
+		}
+		if !strings.Contains(str, ":") || net.ParseIP(str) != nil {
+			if schemePort == "" {
+				// The default port depends on whether the
+				// block has TLS, which isn't known yet
+				return str, nil, nil
+			}
+			return str, []string{schemePort}, nil
 		}
 
 		host, port, err = net.SplitHostPort(str)
@@ -57,6 +85,7 @@ func (p *parser) addresses() error {
 			err = nil
 		}
 
+		ports = strings.Split(port, ",")
 		return
 	}
 
@@ -80,12 +109,32 @@ func (p *parser) addresses() error {
 			expectingAnother = false // but we may still see another one on this line
 		}
 
-		// Parse and save this address
-		host, port, err := address(tkn)
-		if err != nil {
-			return err
+		if strings.HasPrefix(tkn, "unix:") {
+			if len(tkn) == len("unix:") {
+				return p.err("Syntax", "Missing socket path in address '"+tkn+"'")
+			}
+			p.addHost(hostPort{socket: tkn[len("unix:"):]}, tkn)
+		} else {
+			// Parse and save this address (once for each port)
+			host, ports, err := address(tkn)
+			if err != nil {
+				return err
+			}
+			if ports == nil {
+				p.addHost(hostPort{host: host}, tkn)
+			}
+			for i, port := range ports {
+				if err := checkPort(port); err != nil {
+					return p.err("Syntax", err.Error()+" in address '"+tkn+"'")
+				}
+				for _, other := range ports[:i] {
+					if other == port {
+						return p.err("Syntax", "Duplicate port '"+port+"' in address '"+tkn+"'")
+					}
+				}
+				p.addHost(hostPort{host: host, port: port, plain: strings.HasPrefix(tkn, "http://")}, tkn)
+			}
 		}
-		p.hosts = append(p.hosts, hostPort{host, port})
 
 		// Advance token and possibly break out of loop or return error
 		hasNext := p.next()
@@ -104,6 +153,18 @@ func (p *parser) addresses() error {
 	return nil
 }
 
+// addHost adds hp, from the address tkn, to p.hosts. Whether
+// an earlier address of the same server block is the same
+// can only be told once the block's TLS, which the default
+// port depends on, is known (see parseOne).
+func (p *parser) addHost(hp hostPort, tkn string) {
+	if i := strings.Index(tkn, "://"); i > -1 {
+		hp.scheme = tkn[:i]
+	}
+	hp.addr, hp.line, hp.column = tkn, p.line(), p.column()
+	p.hosts = append(p.hosts, hp)
+}
+
 // addressBlock leads into parsing directives, including
 // possible opening/closing curly braces around the block.
 // It handles directives enclosed by curly braces and
@@ -184,21 +245,18 @@ func (p *parser) directives() error {
 			// Path scope (a.k.a. location context)
 			// Starts with / ('starts with') or * ('ends with').
 
-			// TODO: The parser can handle the syntax (obviously), but the
-			// implementation is incomplete. This is intentional,
-			// until we can better decide what kind of feature set we
-			// want to support and how exactly we want these location
-			// scopes to work. Until this is ready, we leave this
-			// syntax undocumented. Some changes will need to be
-			// made in parser.go also (the unwrap function) and
-			// probably in server.go when we do this... see those TODOs.
+			// TODO: Only 'starts with' scopes are matched to requests
+			// (see Config.MiddlewareChain); until we decide how 'ends
+			// with' scopes should work, we leave this syntax undocumented.
 
 			var scope *locationContext
+			var existing bool
 
 			// If the path block is a duplicate, append to existing one
 			for i := 0; i < len(p.other); i++ {
 				if p.other[i].path == p.tkn() {
 					scope = &p.other[i]
+					existing = true
 					break
 				}
 			}
@@ -237,7 +295,9 @@ func (p *parser) directives() error {
 			}
 
 			// Save the new scope and put the current scope back to "/"
-			p.other = append(p.other, *scope)
+			if !existing {
+				p.other = append(p.other, *scope)
+			}
 			p.scope = &p.other[0]
 
 		} else if err := p.directive(); err != nil {
@@ -252,6 +312,20 @@ func (p *parser) directives() error {
 // will be returned. If it is a valid directive, tokens will be
 // collected.
 func (p *parser) directive() error {
+	if !isRepeatable(p.tkn()) {
+		key := p.scope.path + " " + p.tkn()
+		if line, ok := p.seen[key]; ok {
+			if p.defaults && !p.defaulted[key] {
+				return p.skipDirective() // the server block's own takes precedence
+			}
+			return p.err("Parse", fmt.Sprintf("Duplicate '%s' directive (already used on line %d)", p.tkn(), line))
+		}
+		p.seen[key] = p.line()
+		if p.defaults {
+			p.defaulted[key] = true
+		}
+	}
+
 	if fn, ok := validDirectives[p.tkn()]; ok {
 		// Built-in (standard, or 'core') directive
 		err := fn(p)
@@ -283,6 +357,7 @@ func (p *parser) collectTokens() error {
 	line := p.line()
 	nesting := 0
 	cont := newController(p)
+	cont.pathScope = p.scope.path
 
 	// Re-use a duplicate directive's controller from before
 	// (the parsing logic in the middleware generator must
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"io"
+	"strings"
+)
+
+// This file contains a lower-level view of a Caddyfile than
+// Config: the server blocks and directives as they are written,
+// for tools such as linters and formatters. Nothing is checked
+// but the structure of the file; directives are not run, files
+// are not imported, and environment variables are not replaced.
+
+type (
+	// ServerBlock is a server block of a Caddyfile as written:
+	// its addresses (without commas between them) and its
+	// directives. A snippet definition is a ServerBlock whose
+	// only address is the name of the snippet in parentheses,
+	// such as "(common)", and the global options block is one
+	// without addresses.
+	ServerBlock struct {
+		Addresses  []string
+		Directives []Directive
+		Line       int // of the first address, or of the brace
+	}
+
+	// Directive is a directive as written: its name, the
+	// arguments on the same line, and the lines of its block
+	// if it has one, each of which is a Directive too. Path
+	// scopes are directives with a block whose name is the
+	// path (e.g. "/api").
+	Directive struct {
+		Name  string
+		Args  []string
+		Block []Directive // nil if there is no block
+		Line  int
+	}
+)
+
+// ParseTree parses the Caddyfile in r into its server blocks,
+// without interpreting any of the directives. Errors are of
+// type *ParseError, without a Filename.
+func ParseTree(r io.Reader) ([]ServerBlock, error) {
+	var l lexer
+	l.load(r)
+
+	t := &treeParser{cursor: -1}
+	for l.next() {
+		t.tokens = append(t.tokens, l.token)
+	}
+
+	var blocks []ServerBlock
+	for first := true; t.next(); first = false {
+		if first && t.tkn().text == "{" {
+			block := ServerBlock{Line: t.tkn().line}
+			directives, err := t.directives(true)
+			if err != nil {
+				return nil, err
+			}
+			block.Directives = directives
+			blocks = append(blocks, block)
+			continue
+		}
+
+		block, err := t.serverBlock()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// treeParser builds a tree of server blocks and
+// directives from the tokens of a Caddyfile.
+type treeParser struct {
+	tokens []token
+	cursor int
+}
+
+// next loads the next token, returning false if
+// there are no more.
+func (t *treeParser) next() bool {
+	if t.cursor < len(t.tokens)-1 {
+		t.cursor++
+		return true
+	}
+	t.cursor = len(t.tokens)
+	return false
+}
+
+// peek returns the token after the current one, and
+// false if there are no more.
+func (t *treeParser) peek() (token, bool) {
+	if t.cursor+1 < len(t.tokens) {
+		return t.tokens[t.cursor+1], true
+	}
+	return token{}, false
+}
+
+// tkn returns the current token.
+func (t *treeParser) tkn() token {
+	if t.cursor < len(t.tokens) {
+		return t.tokens[t.cursor]
+	}
+	if len(t.tokens) > 0 {
+		return t.tokens[len(t.tokens)-1]
+	}
+	return token{line: 1}
+}
+
+// serverBlock parses a server block, starting at the
+// current token, which is its first address. Like Load,
+// a server block without braces goes to the end of the
+// file.
+func (t *treeParser) serverBlock() (ServerBlock, error) {
+	block := ServerBlock{Line: t.tkn().line}
+
+	// Addresses are on the first line, or on more lines
+	// if each line but the last ends with a comma
+	for {
+		tkn := t.tkn()
+		if tkn.text == "{" {
+			return block, t.err("Syntax", "Expected an address but had '{'")
+		}
+		block.Addresses = append(block.Addresses, strings.TrimSuffix(tkn.text, ","))
+
+		next, ok := t.peek()
+		if !ok {
+			return block, nil
+		}
+		if next.line > tkn.line && tkn.text[len(tkn.text)-1] != ',' {
+			break
+		}
+		if next.text == "{" {
+			break
+		}
+		t.next()
+	}
+
+	if next, _ := t.peek(); next.text == "{" {
+		t.next()
+		directives, err := t.directives(true)
+		if err != nil {
+			return block, err
+		}
+		block.Directives = directives
+		return block, nil
+	}
+
+	directives, err := t.directives(false)
+	if err != nil {
+		return block, err
+	}
+	block.Directives = directives
+	return block, nil
+}
+
+// directives parses directives, starting after the current
+// token, until the closing brace if inBlock is true, or else
+// until the end of the file.
+func (t *treeParser) directives(inBlock bool) ([]Directive, error) {
+	directives := []Directive{}
+
+	for t.next() {
+		tkn := t.tkn()
+		if tkn.text == "}" {
+			if !inBlock {
+				return directives, t.err("Syntax", "Unexpected '}' outside of a block")
+			}
+			return directives, nil
+		}
+		if tkn.text == "{" {
+			return directives, t.err("Syntax", "Unexpected '{' without a directive")
+		}
+
+		dir := Directive{Name: tkn.text, Line: tkn.line}
+
+		// Arguments are the rest of the line, up to a brace
+		for {
+			next, ok := t.peek()
+			if !ok || next.line != tkn.line || next.text == "}" {
+				break
+			}
+			t.next()
+			if next.text == "{" {
+				block, err := t.directives(true)
+				if err != nil {
+					return directives, err
+				}
+				dir.Block = block
+				break
+			}
+			dir.Args = append(dir.Args, next.text)
+		}
+
+		directives = append(directives, dir)
+	}
+
+	if inBlock {
+		return directives, t.err("Syntax", "Unexpected EOF, expected '}'")
+	}
+	return directives, nil
+}
+
+// err returns a *ParseError at the current token.
+func (t *treeParser) err(kind, msg string) error {
+	tkn := t.tkn()
+	return &ParseError{Line: tkn.line, Column: tkn.column, Kind: kind, Message: msg}
+}
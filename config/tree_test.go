@@ -0,0 +1,114 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTree(t *testing.T) {
+	blocks, err := ParseTree(strings.NewReader(`(common) {
+	gzip
+}
+
+localhost:8080, # first
+example.com {
+	root /www
+	import common
+	/api {
+		proxy / localhost:9000 {
+			header_upstream Host {host}
+		}
+	}
+}
+
+site.com:80 { log }
+
+other.com
+errors {
+	404 404.html
+}`))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+
+	expected := []ServerBlock{
+		{
+			Addresses:  []string{"(common)"},
+			Directives: []Directive{{Name: "gzip", Line: 2}},
+			Line:       1,
+		},
+		{
+			Addresses: []string{"localhost:8080", "example.com"},
+			Directives: []Directive{
+				{Name: "root", Args: []string{"/www"}, Line: 7},
+				{Name: "import", Args: []string{"common"}, Line: 8},
+				{Name: "/api", Line: 9, Block: []Directive{
+					{Name: "proxy", Args: []string{"/", "localhost:9000"}, Line: 10, Block: []Directive{
+						{Name: "header_upstream", Args: []string{"Host", "{host}"}, Line: 11},
+					}},
+				}},
+			},
+			Line: 5,
+		},
+		{
+			Addresses:  []string{"site.com:80"},
+			Directives: []Directive{{Name: "log", Line: 16}},
+			Line:       16,
+		},
+		{
+			Addresses: []string{"other.com"},
+			Directives: []Directive{
+				{Name: "errors", Line: 19, Block: []Directive{
+					{Name: "404", Args: []string{"404.html"}, Line: 20},
+				}},
+			},
+			Line: 18,
+		},
+	}
+
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Expected tree:\n%#v\nbut got:\n%#v", expected, blocks)
+	}
+}
+
+func TestParseTreeGlobalOptions(t *testing.T) {
+	blocks, err := ParseTree(strings.NewReader("{\n\tgzip\n}\nlocalhost {\n\troot /www\n}"))
+	if err != nil {
+		t.Fatalf("Expected no errors, but got '%s'", err)
+	}
+
+	expected := []ServerBlock{
+		{Directives: []Directive{{Name: "gzip", Line: 2}}, Line: 1},
+		{Addresses: []string{"localhost"}, Directives: []Directive{{Name: "root", Args: []string{"/www"}, Line: 5}}, Line: 4},
+	}
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Expected tree:\n%#v\nbut got:\n%#v", expected, blocks)
+	}
+}
+
+func TestParseTreeErrors(t *testing.T) {
+	for i, test := range []struct {
+		input string
+		line  int
+	}{
+		{"localhost {\n\troot /www\n", 2},
+		{"localhost\nroot /www\n}", 3},
+		{"localhost {\n\t{\n}", 2},
+		{"localhost {\n}\n{\n}", 3},
+	} {
+		_, err := ParseTree(strings.NewReader(test.input))
+		if err == nil {
+			t.Errorf("Test %d: Expected an error, but got none", i)
+			continue
+		}
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Test %d: Expected a *ParseError, got %T", i, err)
+			continue
+		}
+		if parseErr.Line != test.line {
+			t.Errorf("Test %d: Expected error on line %d, got line %d: %s", i, test.line, parseErr.Line, err)
+		}
+	}
+}
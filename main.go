@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
@@ -16,110 +18,276 @@ import (
 )
 
 var (
-	conf  string
-	http2 bool // TODO: temporary flag until http2 is standard
-	quiet bool
-	cpu   string
+	confs    confFiles
+	http2    bool // TODO: temporary flag until http2 is standard
+	quiet    bool
+	verbose  bool
+	cpu      string
+	validate bool
+	dump     bool
+	showAddr bool
 )
 
 func init() {
-	flag.StringVar(&conf, "conf", config.DefaultConfigFile, "the configuration file to use")
+	flag.Var(&confs, "conf", "the configuration file to use (default $"+config.ConfigFileEnv+", or "+config.DefaultConfigFile+"); repeat it to serve the sites of several files")
 	flag.BoolVar(&http2, "http2", true, "enable HTTP/2 support") // TODO: temporary flag until http2 merged into std lib
 	flag.BoolVar(&quiet, "quiet", false, "quiet mode (no initialization output)")
+	flag.BoolVar(&verbose, "verbose", false, "log each startup and shutdown function as it runs")
 	flag.StringVar(&cpu, "cpu", "100%", "CPU cap")
+	flag.BoolVar(&config.StrictEnv, "strictenv", false, "treat unset environment variables in the configuration file as errors")
+	flag.BoolVar(&validate, "validate", false, "check the configuration file and exit without starting the server")
+	flag.BoolVar(&dump, "dump", false, "print the configuration of each site as loaded and exit without starting the server")
+	flag.BoolVar(&showAddr, "show-addresses", false, "print the addresses that would be listened on and exit without starting the server")
 	flag.Parse()
+
+	// A file given with -conf takes precedence
+	// over the environment
+	if len(confs) == 0 {
+		confs = confFiles{config.DefaultFile()}
+	}
+}
+
+// confFiles is the list of configuration files given
+// with each -conf flag.
+type confFiles []string
+
+func (c *confFiles) String() string {
+	return strings.Join(*c, ", ")
+}
+
+func (c *confFiles) Set(filename string) error {
+	*c = append(*c, filename)
+	return nil
 }
 
 func main() {
 	var wg sync.WaitGroup
 
+	// Only check the configuration, if requested
+	if validate {
+		for _, conf := range confs {
+			err := config.Validate(conf)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if len(confs) > 1 {
+			// The files may be valid on their own but
+			// define the same site
+			_, err := config.LoadAll(confs...)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if !quiet && len(confs) == 1 {
+			fmt.Println(confs[0] + " is valid")
+		} else if !quiet {
+			fmt.Println(confs.String() + " are valid")
+		}
+		return
+	}
+
+	// Only print the configuration, if requested
+	if dump {
+		allConfigs, err := loadAll()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, cfg := range allConfigs {
+			fmt.Println(cfg)
+		}
+		return
+	}
+
+	// Only print the addresses to listen on, if requested
+	if showAddr {
+		allConfigs, err := loadAll()
+		if err != nil {
+			log.Fatal(err)
+		}
+		addrs, err := config.ListenAddresses(allConfigs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, addr := range addrs {
+			fmt.Println(addr)
+		}
+		return
+	}
+
 	// Set CPU cap
 	err := setCPU(cpu)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Load config from file
-	allConfigs, err := config.Load(conf)
+	// Load config from file and group by address (virtual hosts)
+	addresses, err := loadConfigs()
 	if err != nil {
-		if config.IsNotFound(err) {
-			allConfigs = config.Default()
-		} else {
-			log.Fatal(err)
-		}
-	}
-	if len(allConfigs) == 0 {
-		allConfigs = config.Default()
+		log.Fatal(err)
 	}
 
-	// Group by address (virtual hosts)
-	addresses, err := arrangeBindings(allConfigs)
+	userName, groupName, err := runAs(addresses)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Start each server with its one or more configurations
+	// Create a server for each address with its one or more
+	// configurations, and have them all listen before any of
+	// them serve, so that privileges can be dropped in between
+	var servers []*server.Server
 	for addr, configs := range addresses {
 		s, err := server.New(addr, configs, configs[0].TLS.Enabled)
 		if err != nil {
 			log.Fatal(err)
 		}
 		s.HTTP2 = http2 // TODO: This setting is temporary
+		s.Verbose = verbose
+		err = s.Listen()
+		if err != nil {
+			log.Fatal(err) // includes failed startup functions
+		}
+		servers = append(servers, s)
+	}
+
+	err = dropPrivileges(userName, groupName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Start each server
+	for _, s := range servers {
 		wg.Add(1)
 		go func(s *server.Server) {
 			defer wg.Done()
 			err := s.Serve()
 			if err != nil {
-				log.Println(err)
+				log.Fatal(err)
 			}
 		}(s)
 
 		if !quiet {
-			for _, config := range configs {
-				fmt.Println(config.Address())
+			for _, config := range addresses[s.Address()] {
+				fmt.Println(boundAddress(config, s))
 			}
 		}
 	}
 
+	// Stop the servers gracefully when interrupted; each
+	// Serve call returns once its server has stopped
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, os.Kill) // TODO: syscall.SIGQUIT? (Ctrl+\, Unix-only)
+		<-interrupt
+		for _, s := range servers {
+			go func(s *server.Server) {
+				err := s.Stop()
+				if err != nil {
+					log.Println(err)
+				}
+			}(s)
+		}
+	}()
+
+	// Reload the configuration or reopen the log files
+	// when signaled, if supported
+	go reloadOnSignal(servers)
+	go reopenLogsOnSignal()
+
 	wg.Wait()
 }
 
-// arrangeBindings groups configurations by their bind address. For example,
-// a server that should listen on localhost and another on 127.0.0.1 will
-// be grouped into the same address: 127.0.0.1. It will return an error
-// if the address lookup fails or if a TLS listener is configured on the
-// same address as a plaintext HTTP listener.
-func arrangeBindings(allConfigs []config.Config) (map[string][]config.Config, error) {
-	addresses := make(map[string][]config.Config)
-
-	// Group configs by bind address
-	for _, conf := range allConfigs {
-		addr, err := net.ResolveTCPAddr("tcp", conf.Address())
-		if err != nil {
-			return addresses, err
-		}
-		addresses[addr.String()] = append(addresses[addr.String()], conf)
+// loadConfigs loads the configuration files, like loadAll, and
+// groups the configurations by their bind address.
+func loadConfigs() (map[string][]config.Config, error) {
+	allConfigs, err := loadAll()
+	if err != nil {
+		return nil, err
 	}
 
-	// Don't allow HTTP and HTTPS to be served on the same address
+	return config.ArrangeBindings(allConfigs)
+}
+
+// loadAll loads the configuration file, falling back to the
+// default configuration if there is none, or all the files
+// together if more than one was given.
+func loadAll() ([]config.Config, error) {
+	if len(confs) == 1 {
+		return config.LoadOrDefault(confs[0])
+	}
+	return config.LoadAll(confs...)
+}
+
+// runAs returns the user and group to run as that the sites
+// in addresses configure. Since they are served by the same
+// process, the sites that configure them must agree.
+func runAs(addresses map[string][]config.Config) (userName, groupName string, err error) {
 	for _, configs := range addresses {
-		isTLS := configs[0].TLS.Enabled
-		for _, config := range configs {
-			if config.TLS.Enabled != isTLS {
-				thisConfigProto, otherConfigProto := "HTTP", "HTTP"
-				if config.TLS.Enabled {
-					thisConfigProto = "HTTPS"
+		for _, cfg := range configs {
+			if cfg.User != "" {
+				if userName != "" && cfg.User != userName {
+					return "", "", errors.New("Sites must run as the same user, but " + cfg.Address() + " runs as " + cfg.User + ", not " + userName)
 				}
-				if configs[0].TLS.Enabled {
-					otherConfigProto = "HTTPS"
+				userName = cfg.User
+			}
+			if cfg.Group != "" {
+				if groupName != "" && cfg.Group != groupName {
+					return "", "", errors.New("Sites must run as the same group, but " + cfg.Address() + " runs as " + cfg.Group + ", not " + groupName)
 				}
-				return addresses, fmt.Errorf("Configuration error: Cannot multiplex %s (%s) and %s (%s) on same address",
-					configs[0].Address(), otherConfigProto, config.Address(), thisConfigProto)
+				groupName = cfg.Group
 			}
 		}
 	}
+	return userName, groupName, nil
+}
+
+// reload loads the configuration file again and replaces the
+// sites served by servers with the new ones, without closing
+// their listeners. If the new configuration is invalid or
+// needs different listeners, the servers keep serving what
+// they were and an error is returned.
+func reload(servers []*server.Server) error {
+	addresses, err := loadConfigs()
+	if err != nil {
+		return err
+	}
+
+	// Listeners can't be added or removed without a restart
+	if len(addresses) != len(servers) {
+		return errors.New("Cannot reload: the configuration changes which addresses to listen on; restart instead")
+	}
+	for _, s := range servers {
+		if _, ok := addresses[s.Address()]; !ok {
+			return errors.New("Cannot reload: the configuration no longer listens on " + s.Address() + "; restart instead")
+		}
+	}
 
-	return addresses, nil
+	for _, s := range servers {
+		err := s.Reload(addresses[s.Address()])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// boundAddress returns the address of conf, served by s, with
+// the port that s is bound to if conf asks the system to choose
+// one with port 0.
+func boundAddress(conf config.Config, s *server.Server) string {
+	if conf.Port != "0" {
+		return conf.Address()
+	}
+	addr := s.ListenAddr()
+	if addr == nil {
+		return conf.Address() // Serve failed and will say why
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return conf.Address()
+	}
+	return net.JoinHostPort(conf.Host, port)
 }
 
 // setCPU parses string cpu and sets GOMAXPROCS
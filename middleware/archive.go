@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IsArchive returns whether the root at path is an archive
+// to serve files from, rather than a directory: whether it
+// is a .zip file.
+func IsArchive(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+// OpenArchive returns a file system with the files in the zip
+// archive at path, in which directories can be listed and files
+// can seek, so they can be served like those in an http.Dir. The
+// archive is read into memory, and each file is decompressed when
+// it is opened. Middleware that open the same archive share it,
+// until the archive file changes.
+func OpenArchive(path string) (http.FileSystem, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archivesMu.Lock()
+	defer archivesMu.Unlock()
+	if a, ok := archives[path]; ok && a.modTime.Equal(info.ModTime()) && a.size == info.Size() {
+		return a.fs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	a := archive{fs: http.FS(zipFS{reader}), modTime: info.ModTime(), size: info.Size()}
+	archives[path] = a
+	return a.fs, nil
+}
+
+// archive is an archive opened by OpenArchive, with
+// the modified time and size of its file at the time.
+type archive struct {
+	fs      http.FileSystem
+	modTime time.Time
+	size    int64
+}
+
+var (
+	archives   = make(map[string]archive) // by path
+	archivesMu sync.Mutex
+)
+
+// zipFS is the fs.FS of a zip archive, with files
+// that can seek because they are read into memory.
+type zipFS struct {
+	reader *zip.Reader
+}
+
+// Open opens the file or directory name in the archive.
+func (z zipFS) Open(name string) (fs.File, error) {
+	f, err := z.reader.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &zipFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+// zipFile is a file in a zip archive, decompressed.
+type zipFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+// Stat returns the info of the file in the archive.
+func (f *zipFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Close does nothing, since the file is in memory.
+func (f *zipFile) Close() error {
+	return nil
+}
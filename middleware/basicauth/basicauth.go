@@ -2,6 +2,7 @@
 package basicauth
 
 import (
+	"crypto/subtle"
 	"net/http"
 
 	"github.com/mholt/caddy/middleware"
@@ -26,30 +27,46 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 
 // ServeHTTP implements the middleware.Handler interface.
 func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var protected bool
+
+	// Parse auth header
+	username, password, ok := r.BasicAuth()
+
 	for _, rule := range a.Rules {
 		for _, res := range rule.Resources {
 			if !middleware.Path(r.URL.Path).Matches(res) {
 				continue
 			}
 
-			// Path matches; parse auth header
-			username, password, ok := r.BasicAuth()
+			// Path matches; any rule for it may allow the request
+			protected = true
 
 			// Check credentials
-			if !ok || username != rule.Username || password != rule.Password {
-				w.Header().Set("WWW-Authenticate", "Basic")
-				return http.StatusUnauthorized, nil
+			if ok && rule.allows(username, password) {
+				// "It's an older code, sir, but it checks out. I was about to clear them."
+				return a.Next.ServeHTTP(w, r)
 			}
-
-			// "It's an older code, sir, but it checks out. I was about to clear them."
-			return a.Next.ServeHTTP(w, r)
 		}
 	}
 
+	if protected {
+		w.Header().Set("WWW-Authenticate", "Basic")
+		return http.StatusUnauthorized, nil
+	}
+
 	// Pass-thru when no paths match
 	return a.Next.ServeHTTP(w, r)
 }
 
+// allows returns whether username and password are the credentials
+// for rule. Comparisons take constant time so as not to reveal how
+// much of a guess was correct.
+func (rule Rule) allows(username, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(rule.Username))
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(rule.Password))
+	return userOK&passOK == 1
+}
+
 func parse(c middleware.Controller) ([]Rule, error) {
 	var rules []Rule
 
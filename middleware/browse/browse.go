@@ -21,9 +21,11 @@ import (
 // Browse is an http.Handler that can show a file listing when
 // directories in the given paths are specified.
 type Browse struct {
-	Next    middleware.Handler
-	Root    string
-	Configs []BrowseConfig
+	Next       middleware.Handler
+	Root       string
+	FileSystem http.FileSystem // the files of Root, if not a directory on disk
+	Configs    []BrowseConfig
+	IndexPages []string // directories with one of these aren't listed
 }
 
 // BrowseConfig is a configuration for browsing in a particular path.
@@ -65,6 +67,8 @@ func (fi FileInfo) HumanModTime(format string) string {
 	return fi.ModTime.Format(format)
 }
 
+// IndexPages are the default names of the files that
+// are served for a directory, in order of preference.
 var IndexPages = []string{
 	"index.html",
 	"index.htm",
@@ -79,9 +83,15 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
+	fs, err := c.FileSystem()
+	if err != nil {
+		return nil, err
+	}
 	browse := Browse{
-		Root:    c.Root(),
-		Configs: configs,
+		Root:       c.Root(),
+		FileSystem: fs,
+		Configs:    configs,
+		IndexPages: c.IndexFiles(),
 	}
 
 	return func(next middleware.Handler) middleware.Handler {
@@ -92,9 +102,20 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 
 // ServeHTTP implements the middleware.Handler interface.
 func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	filename := b.Root + r.URL.Path
+	// Clean the path so a listing can't be had above the configured scope
+	upath := path.Clean("/" + r.URL.Path)
+	fs := b.FileSystem
+	if fs == nil {
+		fs = http.Dir(b.Root)
+	}
+
+	file, err := fs.Open(upath)
+	if err != nil {
+		return b.Next.ServeHTTP(w, r)
+	}
+	defer file.Close()
 
-	info, err := os.Stat(filename)
+	info, err := file.Stat()
 	if err != nil {
 		return b.Next.ServeHTTP(w, r)
 	}
@@ -104,8 +125,9 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	}
 
 	// See if there's a browse configuration to match the path
+	var files []os.FileInfo
 	for _, bc := range b.Configs {
-		if !middleware.Path(r.URL.Path).Matches(bc.PathScope) {
+		if !middleware.Path(upath).Matches(bc.PathScope) {
 			continue
 		}
 
@@ -116,16 +138,12 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			return 0, nil
 		}
 
-		// Load directory contents
-		file, err := os.Open(b.Root + r.URL.Path)
-		if err != nil {
-			return http.StatusForbidden, err
-		}
-		defer file.Close()
-
-		files, err := file.Readdir(-1)
-		if err != nil {
-			return http.StatusForbidden, err
+		// Load directory contents, once for all the configs
+		if files == nil {
+			files, err = file.Readdir(-1)
+			if err != nil {
+				return http.StatusForbidden, err
+			}
 		}
 
 		// Assemble listing of directory contents
@@ -135,7 +153,7 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			name := f.Name()
 
 			// Directory is not browseable if it contains index file
-			for _, indexName := range IndexPages {
+			for _, indexName := range b.IndexPages {
 				if name == indexName {
 					abort = true
 					break
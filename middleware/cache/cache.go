@@ -0,0 +1,445 @@
+// Package cache is middleware that keeps responses on disk and
+// serves them again, for content that is expensive to generate,
+// such as rendered markdown and templates or proxied pages.
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of cache middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files left from earlier runs aren't in the entries, so they
+	// would never be evicted or count towards the size limit
+	c.Startup(func() error {
+		for _, rule := range rules {
+			err := rule.sweep()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Cache{Next: next, Rules: rules}
+	}, nil
+}
+
+// Cache is middleware that stores successful responses to GET
+// requests on disk and serves them to later requests for the
+// same host, path, and query until they are TTL old. Responses
+// that vary by request headers, as named by their Vary header
+// (and Accept-Encoding for those with a Content-Encoding), are
+// stored apart for each value of those headers, so a compressed
+// body is only served to clients that accept it. Requests
+// with "Cache-Control: no-cache" are passed on to Next, though
+// their responses are still stored. Responses that set cookies
+// or say not to store them, or that vary by anything (Vary: *),
+// are never stored. The cache files in the directory of a rule
+// are removed when the server starts.
+type Cache struct {
+	Next  middleware.Handler
+	Rules []*Rule
+}
+
+// Rule caches responses to requests under Path for TTL in
+// the directory Dir, and evicts the oldest responses when
+// they add up to more than MaxSize bytes.
+type Rule struct {
+	Path    string
+	TTL     time.Duration
+	Dir     string
+	MaxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	varies  map[string][]string // request headers that responses vary by, by base key
+	size    int64
+}
+
+// entry is a response stored in a file on disk.
+type entry struct {
+	file   string
+	header http.Header
+	size   int64
+	stored time.Time
+}
+
+// Defaults for rules that don't specify their own.
+var (
+	DefaultDir     = filepath.Join(os.TempDir(), "caddy-cache")
+	DefaultMaxSize = int64(100 << 20)
+)
+
+// ServeHTTP implements the middleware.Handler interface.
+func (c Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	i := middleware.LongestMatch(r.URL.Path, len(c.Rules), func(i int) string { return c.Rules[i].Path })
+	if i < 0 || (r.Method != "GET" && r.Method != "HEAD") {
+		return c.Next.ServeHTTP(w, r)
+	}
+	rule := c.Rules[i]
+
+	base := r.Host + r.URL.RequestURI()
+	key := variantKey(base, rule.varyFor(base), r)
+	cacheControl := strings.ToLower(r.Header.Get("Cache-Control"))
+
+	if !strings.Contains(cacheControl, "no-cache") {
+		if e, ok := rule.get(key, time.Now()); ok {
+			file, err := os.Open(e.file)
+			if err == nil {
+				defer file.Close()
+				for name, values := range e.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(http.StatusOK)
+				if r.Method == "GET" {
+					io.Copy(w, file)
+				}
+				return http.StatusOK, nil
+			}
+			rule.remove(key) // the file is gone
+		}
+	}
+
+	if r.Method == "HEAD" || strings.Contains(cacheControl, "no-store") {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK, limit: rule.MaxSize}
+	status, err := c.Next.ServeHTTP(rec, r)
+	if err == nil && status < 400 && rec.status == http.StatusOK && rec.cacheable() {
+		vary := varyHeaders(rec.header)
+		rule.setVary(base, vary)
+		rule.put(variantKey(base, vary, r), rec.header, rec.body.Bytes(), time.Now())
+	}
+	return status, err
+}
+
+// varyHeaders returns the names of the request headers that a
+// response with header varies by, in canonical form.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	add := func(name string) {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) != "" {
+				add(name)
+			}
+		}
+	}
+	if header.Get("Content-Encoding") != "" {
+		add("Accept-Encoding")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variantKey returns the key of the response to r for base,
+// given the names of the request headers that it varies by.
+func variantKey(base string, vary []string, r *http.Request) string {
+	key := base
+	for _, name := range vary {
+		key += "\n" + name + ": " + strings.Join(r.Header.Values(name), ", ")
+	}
+	return key
+}
+
+// varyFor returns the names of the request headers that the
+// last stored response for base varied by.
+func (rule *Rule) varyFor(base string) []string {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	return rule.varies[base]
+}
+
+// setVary records that responses for base vary by the
+// request headers named in vary.
+func (rule *Rule) setVary(base string, vary []string) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	if len(vary) == 0 {
+		delete(rule.varies, base)
+		return
+	}
+	if rule.varies == nil {
+		rule.varies = make(map[string][]string)
+	}
+	rule.varies[base] = vary
+}
+
+// sweep removes the cache files in rule.Dir, such as
+// those left by an earlier run, and forgets their entries.
+func (rule *Rule) sweep() error {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	files, err := os.ReadDir(rule.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !f.IsDir() && isCacheFile(f.Name()) {
+			err := os.Remove(filepath.Join(rule.Dir, f.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	rule.entries, rule.varies, rule.size = nil, nil, 0
+	return nil
+}
+
+// isCacheFile returns whether name is that of a file
+// written by put: a hex SHA-256 or a temporary file.
+func isCacheFile(name string) bool {
+	if strings.HasPrefix(name, "tmp-") {
+		return true
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil && len(name) == 2*sha256.Size
+}
+
+// get returns the entry for key if there is one
+// that isn't expired at time now.
+func (rule *Rule) get(key string, now time.Time) (*entry, bool) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	e, ok := rule.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if now.Sub(e.stored) >= rule.TTL {
+		rule.evict(key, e)
+		return nil, false
+	}
+	return e, true
+}
+
+// put stores body with header as the entry for key at time
+// now, evicting the oldest entries if the cache gets too big.
+func (rule *Rule) put(key string, header http.Header, body []byte, now time.Time) {
+	size := int64(len(body))
+	if size > rule.MaxSize {
+		return
+	}
+
+	name := sha256.Sum256([]byte(key))
+	file := filepath.Join(rule.Dir, hex.EncodeToString(name[:]))
+
+	// Write to a temporary file first so that requests being
+	// served the old file don't see a partial new one
+	err := os.MkdirAll(rule.Dir, 0700)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(rule.Dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	if rule.entries == nil {
+		rule.entries = make(map[string]*entry)
+	}
+	if old, ok := rule.entries[key]; ok {
+		rule.size -= old.size
+	}
+	rule.entries[key] = &entry{file: file, header: header, size: size, stored: now}
+	rule.size += size
+
+	for rule.size > rule.MaxSize {
+		var oldestKey string
+		var oldest *entry
+		for k, e := range rule.entries {
+			if oldest == nil || e.stored.Before(oldest.stored) {
+				oldestKey, oldest = k, e
+			}
+		}
+		rule.evict(oldestKey, oldest)
+	}
+}
+
+// remove forgets the entry for key, if there is one.
+func (rule *Rule) remove(key string) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	if e, ok := rule.entries[key]; ok {
+		delete(rule.entries, key)
+		rule.size -= e.size
+	}
+}
+
+// evict removes the entry e for key and its file.
+// rule.mu must be locked.
+func (rule *Rule) evict(key string, e *entry) {
+	delete(rule.entries, key)
+	rule.size -= e.size
+	os.Remove(e.file)
+}
+
+// recorder is a ResponseWriter that passes the response on
+// to the client and keeps a copy of it, as long as the body
+// isn't longer than limit.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	limit       int64
+	tooLong     bool
+	wroteHeader bool
+}
+
+// WriteHeader records the status code and headers and
+// calls the underlying ResponseWriter's WriteHeader method.
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.header = r.Header().Clone()
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes buf to the client and keeps a copy of it.
+func (r *recorder) Write(buf []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.tooLong {
+		if int64(r.body.Len()+len(buf)) > r.limit {
+			r.tooLong = true
+			r.body.Reset()
+		} else {
+			r.body.Write(buf)
+		}
+	}
+	return r.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher, if the underlying
+// ResponseWriter does, for streamed responses.
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// cacheable returns whether the recorded response
+// may be stored.
+func (r *recorder) cacheable() bool {
+	if !r.wroteHeader || r.tooLong || r.header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, name := range varyHeaders(r.header) {
+		if name == "*" {
+			return false
+		}
+	}
+	cacheControl := strings.ToLower(r.header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
+
+// parse gets the cache rules from the tokens of the
+// directive(s), which look like:
+//
+//	cache [path] ttl {
+//		dir      directory
+//		max_size size
+//	}
+//
+// where the path defaults to "/", ttl is a duration like
+// "10m", and max_size is a size like "100MB".
+func parse(c middleware.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Path: "/", Dir: DefaultDir, MaxSize: DefaultMaxSize}
+		var ttl string
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 1:
+			ttl = args[0]
+		case 2:
+			rule.Path, ttl = args[0], args[1]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		var err error
+		rule.TTL, err = time.ParseDuration(ttl)
+		if err != nil || rule.TTL <= 0 {
+			return rules, c.Err("Invalid cache TTL '" + ttl + "'; expected a duration like 10m")
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "dir":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				rule.Dir = c.Val()
+			case "max_size":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				rule.MaxSize, err = middleware.ParseSize(c.Val())
+				if err != nil {
+					return rules, c.Err(err.Error())
+				}
+			default:
+				return rules, c.Err("Expected valid cache configuration property")
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
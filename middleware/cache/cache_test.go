@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestServeHTTPVary(t *testing.T) {
+	// A handler that serves a precompressed body to
+	// clients that accept it, like the file server
+	calls := 0
+	next := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		calls++
+		w.Header().Add("Vary", "Accept-Encoding")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte("gzipped"))
+		} else {
+			w.Write([]byte("plain"))
+		}
+		return http.StatusOK, nil
+	})
+	c := Cache{Next: next, Rules: []*Rule{{Path: "/", TTL: time.Minute, Dir: t.TempDir(), MaxSize: DefaultMaxSize}}}
+
+	for i, test := range []struct {
+		acceptEncoding string
+		expectedBody   string
+		expectedCache  string
+		expectedCalls  int
+	}{
+		{"gzip", "gzipped", "", 1},
+		{"", "plain", "", 2},
+		{"gzip", "gzipped", "HIT", 2},
+		{"", "plain", "HIT", 2},
+	} {
+		r := httptest.NewRequest("GET", "/file.txt", nil)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+
+		_, err := c.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if cache := w.Header().Get("X-Cache"); cache != test.expectedCache {
+			t.Errorf("Test %d: Expected X-Cache %q, got %q", i, test.expectedCache, cache)
+		}
+		if calls != test.expectedCalls {
+			t.Errorf("Test %d: Expected %d calls to the next handler, got %d", i, test.expectedCalls, calls)
+		}
+	}
+}
+
+func TestServeHTTPVaryAll(t *testing.T) {
+	calls := 0
+	next := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		calls++
+		w.Header().Set("Vary", "*")
+		w.Write([]byte("body"))
+		return http.StatusOK, nil
+	})
+	c := Cache{Next: next, Rules: []*Rule{{Path: "/", TTL: time.Minute, Dir: t.TempDir(), MaxSize: DefaultMaxSize}}}
+
+	for i := 0; i < 2; i++ {
+		c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if calls != 2 {
+		t.Errorf("Expected a response with Vary: * not to be stored, but the next handler was called %d times", calls)
+	}
+}
+
+func TestRuleSweep(t *testing.T) {
+	dir := t.TempDir()
+	rule := &Rule{Path: "/", TTL: time.Minute, Dir: dir, MaxSize: DefaultMaxSize}
+	rule.put("example.com/", http.Header{}, []byte("body"), time.Now())
+
+	// Files left by an earlier run, and one that isn't the cache's
+	stale := filepath.Join(dir, strings.Repeat("ab", 32))
+	other := filepath.Join(dir, "notes.txt")
+	for _, file := range []string{stale, filepath.Join(dir, "tmp-123"), other} {
+		err := os.WriteFile(file, []byte("x"), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write %s: %v", file, err)
+		}
+	}
+
+	err := rule.sweep()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Unable to read %s: %v", dir, err)
+	}
+	if len(files) != 1 || files[0].Name() != "notes.txt" {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("Expected only notes.txt to be left, got %v", names)
+	}
+	if len(rule.entries) != 0 || rule.size != 0 {
+		t.Errorf("Expected the entries to be forgotten, got %d of size %d", len(rule.entries), rule.size)
+	}
+
+	err = (&Rule{Dir: filepath.Join(dir, "missing")}).sweep()
+	if err != nil {
+		t.Errorf("Expected no error sweeping a directory that doesn't exist, got %v", err)
+	}
+}
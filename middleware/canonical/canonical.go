@@ -0,0 +1,119 @@
+// Package canonical is middleware that redirects requests to
+// the canonical scheme and host of a site, such as from
+// http://www.example.com to https://example.com.
+package canonical
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of canonical middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	canonical, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		canonical.Next = next
+		return canonical
+	}, nil
+}
+
+// Canonical is middleware that redirects requests made with
+// another scheme, host or port than those of the canonical
+// URL of the site to the same path and query there, with 301
+// Moved Permanently. Requests with methods other than GET and
+// HEAD get 308 Permanent Redirect instead, so that clients
+// send them again as they were. Requests that match are
+// served as usual. The scheme of a request is https if it
+// came over TLS, so a site behind a proxy that terminates TLS
+// shouldn't use https as its canonical scheme.
+type Canonical struct {
+	Next   middleware.Handler
+	Scheme string // "http" or "https"
+	Host   string // the host name, in lower case
+	Port   string // the port, if not the default one of Scheme
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (c Canonical) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.matches(r) {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	code := http.StatusMovedPermanently
+	if r.Method != "GET" && r.Method != "HEAD" {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, c.url()+r.URL.RequestURI(), code)
+	return 0, nil
+}
+
+// matches returns whether r was made with the canonical
+// scheme, host and port.
+func (c Canonical) matches(r *http.Request) bool {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]") // no port, maybe IPv6
+	}
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+	return scheme == c.Scheme && strings.EqualFold(strings.TrimSuffix(host, "."), c.Host) && port == c.Port
+}
+
+// url returns the canonical URL of the root of the site.
+func (c Canonical) url() string {
+	host := c.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if c.Port != "" {
+		host += ":" + c.Port
+	}
+	return c.Scheme + "://" + host
+}
+
+// defaultPorts are the ports that URLs of each
+// scheme have if they don't have one.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// parse gets the canonical URL from the tokens of the
+// directive, an http or https URL without a path:
+//
+//	canonical scheme://host[:port]
+func parse(c middleware.Controller) (Canonical, error) {
+	var canonical Canonical
+
+	for c.Next() {
+		if !c.NextArg() {
+			return canonical, c.ArgErr()
+		}
+		u, err := url.Parse(c.Val())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" ||
+			strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.User != nil {
+			return canonical, c.Err("Invalid canonical URL '" + c.Val() + "'; expected one like https://example.com")
+		}
+		if c.NextArg() {
+			return canonical, c.ArgErr()
+		}
+
+		canonical.Scheme = u.Scheme
+		canonical.Host = strings.ToLower(u.Hostname())
+		if port := u.Port(); port != defaultPorts[u.Scheme] {
+			canonical.Port = port
+		}
+	}
+
+	return canonical, nil
+}
@@ -0,0 +1,98 @@
+package canonical
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Canonical
+	}{
+		{"canonical https://example.com", false, Canonical{Scheme: "https", Host: "example.com"}},
+		{"canonical https://Example.COM:443/", false, Canonical{Scheme: "https", Host: "example.com"}},
+		{"canonical http://example.com:8080", false, Canonical{Scheme: "http", Host: "example.com", Port: "8080"}},
+		{"canonical http://[::1]:80", false, Canonical{Scheme: "http", Host: "::1"}},
+		{"canonical", true, Canonical{}},
+		{"canonical ftp://example.com", true, Canonical{}},
+		{"canonical example.com", true, Canonical{}},
+		{"canonical https://example.com/path", true, Canonical{}},
+		{"canonical https://example.com/?a=b", true, Canonical{}},
+		{"canonical https://user@example.com", true, Canonical{}},
+		{"canonical https://example.com https://www.example.com", true, Canonical{}},
+	} {
+		canonical, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if canonical != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, canonical)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	next := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	for i, test := range []struct {
+		canonical        Canonical
+		method           string
+		target           string
+		tls              bool
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{Canonical{Scheme: "https", Host: "example.com"}, "GET", "https://example.com/a?b=c", true, http.StatusOK, ""},
+		// The default port of the scheme is the same as none
+		{Canonical{Scheme: "https", Host: "example.com"}, "GET", "https://example.com:443/a", true, http.StatusOK, ""},
+		{Canonical{Scheme: "http", Host: "example.com"}, "GET", "http://example.com:80/a", false, http.StatusOK, ""},
+		{Canonical{Scheme: "https", Host: "example.com"}, "GET", "http://example.com:443/a", false, http.StatusMovedPermanently, "https://example.com/a"},
+		{Canonical{Scheme: "https", Host: "example.com"}, "GET", "https://EXAMPLE.com./a", true, http.StatusOK, ""},
+		{Canonical{Scheme: "https", Host: "example.com"}, "GET", "http://example.com/a?b=c", false, http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{Canonical{Scheme: "https", Host: "example.com"}, "HEAD", "https://www.example.com/a", true, http.StatusMovedPermanently, "https://example.com/a"},
+		{Canonical{Scheme: "https", Host: "example.com"}, "POST", "https://www.example.com/form", true, http.StatusPermanentRedirect, "https://example.com/form"},
+		{Canonical{Scheme: "https", Host: "example.com", Port: "8443"}, "GET", "https://example.com/a", true, http.StatusMovedPermanently, "https://example.com:8443/a"},
+		{Canonical{Scheme: "https", Host: "example.com", Port: "8443"}, "GET", "https://example.com:8443/a", true, http.StatusOK, ""},
+		{Canonical{Scheme: "http", Host: "::1"}, "GET", "http://[::1]:80/a", false, http.StatusOK, ""},
+		{Canonical{Scheme: "http", Host: "::1"}, "GET", "http://localhost/a", false, http.StatusMovedPermanently, "http://[::1]/a"},
+	} {
+		test.canonical.Next = next
+		r := httptest.NewRequest(test.method, test.target, nil)
+		if !test.tls {
+			r.TLS = nil
+		} else if r.TLS == nil {
+			r.TLS = new(tls.ConnectionState)
+		}
+		w := httptest.NewRecorder()
+
+		status, err := test.canonical.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if location := w.Header().Get("Location"); location != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, location)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package cors is middleware for Cross-Origin Resource Sharing,
+// which lets web pages on other origins make requests to a site.
+package cors
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of CORS middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return CORS{Next: next, Rules: rules}
+	}, nil
+}
+
+// CORS is middleware that adds CORS headers to the responses
+// to cross-origin requests from allowed origins, and responds
+// to their preflight requests with 204 No Content.
+type CORS struct {
+	Next  middleware.Handler
+	Rules []Rule
+}
+
+// Rule is the CORS policy for requests under Path. An origin
+// of "*" allows any origin. If Headers is empty, any headers
+// a preflight request asks for are allowed.
+type Rule struct {
+	Path    string
+	Origins []string
+	Methods []string
+	Headers []string
+}
+
+// Defaults for rules that don't specify their own.
+var (
+	DefaultOrigins = []string{"*"}
+	DefaultMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+)
+
+// ServeHTTP implements the middleware.Handler interface.
+func (c CORS) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	origin := r.Header.Get("Origin")
+	i := middleware.LongestMatch(r.URL.Path, len(c.Rules), func(i int) string { return c.Rules[i].Path })
+	if i < 0 || origin == "" {
+		return c.Next.ServeHTTP(w, r)
+	}
+	rule := c.Rules[i]
+
+	allowed, ok := rule.allowOrigin(origin)
+	if !ok {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if allowed != "*" {
+		header.Add("Vary", "Origin")
+	}
+
+	if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+		header.Set("Access-Control-Allow-Methods", strings.Join(rule.Methods, ", "))
+		if len(rule.Headers) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(rule.Headers, ", "))
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return 0, nil
+	}
+
+	return c.Next.ServeHTTP(w, r)
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin
+// header for a request from origin, and false if the origin is not
+// allowed. A listed origin is echoed back, so that only it is allowed.
+func (rule Rule) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range rule.Origins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// parse gets the CORS rules from the tokens of the
+// directive(s), which look like:
+//
+//	cors [path] {
+//		origins origin...
+//		methods method...
+//		headers header...
+//	}
+//
+// where the path defaults to "/" and each property
+// is optional.
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			property := c.Val()
+			values := c.RemainingArgs()
+			if len(values) == 0 {
+				return rules, c.ArgErr()
+			}
+			switch property {
+			case "origins":
+				rule.Origins = append(rule.Origins, values...)
+			case "methods":
+				for _, method := range values {
+					rule.Methods = append(rule.Methods, strings.ToUpper(method))
+				}
+			case "headers":
+				rule.Headers = append(rule.Headers, values...)
+			default:
+				return rules, c.Err("Expected valid cors configuration property")
+			}
+		}
+
+		if len(rule.Origins) == 0 {
+			rule.Origins = DefaultOrigins
+		}
+		if len(rule.Methods) == 0 {
+			rule.Methods = DefaultMethods
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
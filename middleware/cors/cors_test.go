@@ -0,0 +1,128 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"cors", false, []Rule{{Path: "/", Origins: DefaultOrigins, Methods: DefaultMethods}}},
+		{"cors /api {\norigins https://a.com https://b.com\nmethods get post\nheaders X-Token\n}", false,
+			[]Rule{{Path: "/api", Origins: []string{"https://a.com", "https://b.com"}, Methods: []string{"GET", "POST"}, Headers: []string{"X-Token"}}}},
+		{"cors /a /b", true, nil},
+		{"cors {\norigins\n}", true, nil},
+		{"cors {\nunknown value\n}", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	next := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.WriteHeader(http.StatusOK)
+		return http.StatusOK, nil
+	})
+	c := CORS{Next: next, Rules: []Rule{
+		{Path: "/", Origins: []string{"*"}, Methods: DefaultMethods},
+		{Path: "/api", Origins: []string{"https://a.com"}, Methods: []string{"GET", "POST"}, Headers: []string{"X-Token"}},
+		{Path: "/open", Origins: []string{"https://a.com"}, Methods: []string{"GET"}},
+	}}
+
+	for i, test := range []struct {
+		method          string
+		path            string
+		origin          string
+		requestHeaders  map[string]string
+		expectedStatus  int
+		expectedHeaders map[string]string // "" for a header that must be missing
+	}{
+		// Any origin
+		{"GET", "/page", "https://x.com", nil, http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin": "*",
+			"Vary":                        "",
+		}},
+		// A listed origin is echoed, and the response varies by it
+		{"GET", "/api/users", "https://a.com", nil, http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin": "https://a.com",
+			"Vary":                        "Origin",
+		}},
+		// One that isn't listed gets nothing
+		{"GET", "/api/users", "https://evil.com", nil, http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		// Not a cross-origin request
+		{"GET", "/api/users", "", nil, http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin": "",
+		}},
+		// A preflight request
+		{"OPTIONS", "/api/users", "https://a.com", map[string]string{
+			"Access-Control-Request-Method":  "POST",
+			"Access-Control-Request-Headers": "X-Other",
+		}, 0, map[string]string{
+			"Access-Control-Allow-Origin":  "https://a.com",
+			"Access-Control-Allow-Methods": "GET, POST",
+			"Access-Control-Allow-Headers": "X-Token",
+		}},
+		// A preflight request for a rule allowing any headers
+		{"OPTIONS", "/open", "https://a.com", map[string]string{
+			"Access-Control-Request-Method":  "GET",
+			"Access-Control-Request-Headers": "X-Other",
+		}, 0, map[string]string{
+			"Access-Control-Allow-Methods": "GET",
+			"Access-Control-Allow-Headers": "X-Other",
+		}},
+		// A plain OPTIONS request isn't a preflight request
+		{"OPTIONS", "/api/users", "https://a.com", nil, http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin":  "https://a.com",
+			"Access-Control-Allow-Methods": "",
+		}},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		for name, value := range test.requestHeaders {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+
+		status, err := c.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status == 0 && w.Code != http.StatusNoContent {
+			t.Errorf("Test %d: Expected response status %d, got %d", i, http.StatusNoContent, w.Code)
+		}
+		for name, expected := range test.expectedHeaders {
+			if actual := w.Header().Get(name); actual != expected {
+				t.Errorf("Test %d: Expected %s header %q, got %q", i, name, expected, actual)
+			}
+		}
+	}
+}
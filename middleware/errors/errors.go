@@ -20,25 +20,37 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
-	// Open the log file for writing when the server starts
-	c.Startup(func() error {
-		var err error
-		var file *os.File
+	var logFile *middleware.LogFile
 
+	// The middleware gets a copy of handler before the server starts,
+	// so it must share the logger whose output is set at startup. With
+	// only error pages configured, errors still go to stderr.
+	handler.Log = log.New(os.Stderr, "", 0)
+
+	// Open the log file for writing when the server starts,
+	// and close it when it quits
+	startup, shutdown := middleware.ShareHooks(func() error {
 		if handler.LogFile == "stdout" {
-			file = os.Stdout
-		} else if handler.LogFile == "stderr" {
-			file = os.Stderr
-		} else if handler.LogFile != "" {
-			file, err = os.OpenFile(handler.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+			handler.Log.SetOutput(os.Stdout)
+		} else if handler.LogFile != "stderr" && handler.LogFile != "" {
+			file, err := middleware.OpenLogFile(handler.LogFile)
 			if err != nil {
 				return err
 			}
+			handler.Log.SetOutput(file)
+			logFile = file
 		}
-
-		handler.Log = log.New(file, "", 0)
 		return nil
+	}, func() error {
+		if logFile == nil {
+			return nil
+		}
+		err := logFile.Close()
+		logFile = nil
+		return err
 	})
+	c.Startup(startup)
+	c.Shutdown(shutdown)
 
 	return func(next middleware.Handler) middleware.Handler {
 		handler.Next = next
@@ -47,11 +59,13 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 }
 
 // ErrorHandler handles HTTP errors (or errors from other middleware).
+// Status codes without an error page get a plain default response.
 type ErrorHandler struct {
-	Next       middleware.Handler
-	ErrorPages map[int]string // map of status code to filename
-	LogFile    string
-	Log        *log.Logger
+	Next         middleware.Handler
+	ErrorPages   map[int]string // map of status code to filename
+	ErrorContent map[int]string // map of status code to the page itself, given inline
+	LogFile      string         // stderr is used if empty
+	Log          *log.Logger
 }
 
 func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -82,6 +96,14 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 func (h ErrorHandler) errorPage(w http.ResponseWriter, code int) {
 	defaultBody := fmt.Sprintf("%d %s", code, http.StatusText(code))
 
+	// An error page given inline needs no file
+	if content, ok := h.ErrorContent[code]; ok {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		io.WriteString(w, content)
+		return
+	}
+
 	// See if an error page for this status code was specified
 	if pagePath, ok := h.ErrorPages[code]; ok {
 
@@ -113,8 +135,23 @@ func (h ErrorHandler) errorPage(w http.ResponseWriter, code int) {
 	http.Error(w, defaultBody, code)
 }
 
+// parse gets the error handler from the tokens of the
+// directive(s), which look like:
+//
+//	errors [logfile]
+//
+// or
+//
+//	errors {
+//		log  logfile
+//		code page
+//		code inline content
+//	}
+//
+// where page is the name of a file in the root, and content
+// is the error page itself, quoted, which may span lines.
 func parse(c middleware.Controller) (ErrorHandler, error) {
-	handler := ErrorHandler{ErrorPages: make(map[int]string)}
+	handler := ErrorHandler{ErrorPages: make(map[int]string), ErrorContent: make(map[int]string)}
 
 	optionalBlock := func() (bool, error) {
 		var hadBlock bool
@@ -130,21 +167,31 @@ func parse(c middleware.Controller) (ErrorHandler, error) {
 
 			if what == "log" {
 				handler.LogFile = where
-			} else {
-				// Error page; ensure it exists
-				where = path.Join(c.Root(), where)
-				f, err := os.Open(where)
-				if err != nil {
-					return hadBlock, c.Err("Unable to open error page '" + where + "': " + err.Error())
-				}
-				f.Close()
-
-				whatInt, err := strconv.Atoi(what)
-				if err != nil {
-					return hadBlock, c.Err("Expecting a numeric status code, got '" + what + "'")
-				}
-				handler.ErrorPages[whatInt] = where
+				continue
 			}
+
+			whatInt, err := strconv.Atoi(what)
+			if err != nil {
+				return hadBlock, c.Err("Expecting a numeric status code, got '" + what + "'")
+			}
+
+			if where == "inline" && c.NextArg() {
+				// Error page given right here
+				handler.ErrorContent[whatInt] = c.Val()
+				delete(handler.ErrorPages, whatInt)
+				continue
+			}
+
+			// Error page; ensure it exists
+			where = path.Join(c.Root(), where)
+			f, err := os.Open(where)
+			if err != nil {
+				return hadBlock, c.Err("Unable to open error page '" + where + "': " + err.Error())
+			}
+			f.Close()
+
+			handler.ErrorPages[whatInt] = where
+			delete(handler.ErrorContent, whatInt)
 		}
 		return hadBlock, nil
 	}
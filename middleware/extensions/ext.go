@@ -46,10 +46,12 @@ type Ext struct {
 	Extensions []string
 }
 
-// ServeHTTP implements the middleware.Handler interface.
+// ServeHTTP implements the middleware.Handler interface. Only
+// requests for paths without an extension that aren't a file
+// themselves are rewritten.
 func (e Ext) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	urlpath := strings.TrimSuffix(r.URL.Path, "/")
-	if path.Ext(urlpath) == "" {
+	urlpath := strings.TrimSuffix(path.Clean("/"+r.URL.Path), "/")
+	if urlpath != "" && path.Ext(urlpath) == "" && !resourceExists(e.Root, urlpath) {
 		for _, ext := range e.Extensions {
 			if resourceExists(e.Root, urlpath+ext) {
 				r.URL.Path = urlpath + ext
@@ -67,23 +69,26 @@ func parse(c middleware.Controller) ([]string, error) {
 
 	for c.Next() {
 		// At least one extension is required
-		if !c.NextArg() {
+		exts := c.RemainingArgs()
+		if len(exts) == 0 {
 			return extensions, c.ArgErr()
 		}
-		extensions = append(extensions, c.Val())
-
-		// Tack on any other extensions that may have been listed
-		extensions = append(extensions, c.RemainingArgs()...)
+		for _, ext := range exts {
+			if !strings.HasPrefix(ext, ".") {
+				return extensions, c.Err("Extension '" + ext + "' must start with a dot")
+			}
+		}
+		extensions = append(extensions, exts...)
 	}
 
 	return extensions, nil
 }
 
 // resourceExists returns true if the file specified at
-// root + path exists; false otherwise.
+// root + path exists and is not a directory; false otherwise.
 func resourceExists(root, path string) bool {
-	_, err := os.Stat(root + path)
+	info, err := os.Stat(root + path)
 	// technically we should use os.IsNotExist(err)
 	// but we don't handle any other kinds of errors anyway
-	return err == nil
+	return err == nil && !info.IsDir()
 }
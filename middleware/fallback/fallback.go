@@ -0,0 +1,139 @@
+// Package fallback is middleware that serves a file in place of
+// files that don't exist, such as the index page of a single-page
+// app, which routes paths on the client.
+package fallback
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of fallback middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Fallback{Next: next, Rules: rules}
+	}, nil
+}
+
+// Fallback is middleware that serves the file of a rule, with a
+// status of 200, for GET and HEAD requests that Next responds to
+// with 404 Not Found. Requests for paths with one of the rule's
+// Except extensions, which are assets like images, still get a 404.
+type Fallback struct {
+	Next  middleware.Handler
+	Rules []Rule
+}
+
+// Rule is the file to serve for requests under Path that
+// aren't found, and the extensions of paths to leave alone.
+type Rule struct {
+	Path   string
+	File   string
+	Except []string
+}
+
+// DefaultExcept are the extensions of assets that don't fall
+// back, for rules that don't specify their own.
+var DefaultExcept = []string{
+	".css", ".js", ".map", ".json", ".xml", ".txt",
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+	".mp3", ".mp4", ".webm", ".pdf", ".zip",
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (f Fallback) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	status, err := f.Next.ServeHTTP(w, r)
+	if status != http.StatusNotFound || (r.Method != "GET" && r.Method != "HEAD") {
+		return status, err
+	}
+
+	i := middleware.LongestMatch(r.URL.Path, len(f.Rules), func(i int) string { return f.Rules[i].Path })
+	if i < 0 {
+		return status, err
+	}
+	rule := f.Rules[i]
+	if r.URL.Path == rule.File || rule.excepts(r.URL.Path) {
+		return status, err
+	}
+
+	r.URL.Path = rule.File
+	return f.Next.ServeHTTP(w, r)
+}
+
+// excepts returns whether upath has one of the
+// extensions that rule doesn't fall back for.
+func (rule Rule) excepts(upath string) bool {
+	ext := path.Ext(upath)
+	for _, except := range rule.Except {
+		if strings.EqualFold(ext, except) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse gets the fallback rules from the tokens of the
+// directive(s), which look like:
+//
+//	fallback [path] file {
+//		except ext...
+//	}
+//
+// where the path defaults to "/" and the except
+// extensions replace DefaultExcept.
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 1:
+			rule.File = args[0]
+		case 2:
+			rule.Path, rule.File = args[0], args[1]
+		default:
+			return rules, c.ArgErr()
+		}
+		if !strings.HasPrefix(rule.File, "/") {
+			rule.File = "/" + rule.File
+		}
+
+		var except bool
+		for c.NextBlock() {
+			switch c.Val() {
+			case "except":
+				exts := c.RemainingArgs()
+				if len(exts) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, ext := range exts {
+					if !strings.HasPrefix(ext, ".") {
+						return rules, c.Err("Extension '" + ext + "' must start with a dot")
+					}
+				}
+				rule.Except = append(rule.Except, exts...)
+				except = true
+			default:
+				return rules, c.Err("Expected valid fallback configuration property")
+			}
+		}
+		if !except {
+			rule.Except = DefaultExcept
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
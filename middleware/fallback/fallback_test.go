@@ -0,0 +1,83 @@
+package fallback
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"fallback index.html", false, []Rule{{Path: "/", File: "/index.html", Except: DefaultExcept}}},
+		{"fallback /app /app/index.html {\nexcept .png .css\n}", false,
+			[]Rule{{Path: "/app", File: "/app/index.html", Except: []string{".png", ".css"}}}},
+		{"fallback", true, nil},
+		{"fallback /app index.html extra", true, nil},
+		{"fallback index.html {\nexcept\n}", true, nil},
+		{"fallback index.html {\nexcept png\n}", true, nil},
+		{"fallback index.html {\nunknown\n}", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var served string
+	f := Fallback{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/index.html" || r.URL.Path == "/style.css" {
+				served = r.URL.Path
+				return http.StatusOK, nil
+			}
+			served = ""
+			return http.StatusNotFound, nil
+		}),
+		Rules: []Rule{{Path: "/", File: "/index.html", Except: DefaultExcept}},
+	}
+
+	for i, test := range []struct {
+		method         string
+		path           string
+		expectedStatus int
+		expectedServed string
+	}{
+		{"GET", "/style.css", http.StatusOK, "/style.css"},
+		{"GET", "/users/42", http.StatusOK, "/index.html"},
+		{"HEAD", "/users/42", http.StatusOK, "/index.html"},
+		{"GET", "/missing.png", http.StatusNotFound, ""},
+		{"GET", "/MISSING.PNG", http.StatusNotFound, ""},
+		{"POST", "/users/42", http.StatusNotFound, ""},
+	} {
+		status, err := f.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(test.method, test.path, nil))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if served != test.expectedServed {
+			t.Errorf("Test %d: Expected %q to be served, got %q", i, test.expectedServed, served)
+		}
+	}
+}
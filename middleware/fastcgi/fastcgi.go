@@ -79,11 +79,15 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 				return http.StatusInternalServerError, err
 			}
 
-			// Connect to FastCGI gateway
-			fcgi, err := Dial("tcp", rule.Address)
+			// Connect to FastCGI gateway; the connection is closed
+			// if the client goes away, so the request isn't kept
+			// working for nobody
+			network, address := parseAddress(rule.Address)
+			fcgi, err := DialContext(r.Context(), network, address)
 			if err != nil {
 				return http.StatusBadGateway, err
 			}
+			defer fcgi.Close()
 
 			// TODO: Allow more methods (requires refactoring fcgiclient first...)
 			var resp *http.Response
@@ -96,11 +100,11 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 			default:
 				return http.StatusMethodNotAllowed, nil
 			}
-			defer resp.Body.Close()
 
 			if err != nil && err != io.EOF {
 				return http.StatusBadGateway, err
 			}
+			defer resp.Body.Close()
 
 			// Write the response header
 			for key, vals := range resp.Header {
@@ -123,6 +127,16 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 	return h.Next.ServeHTTP(w, r)
 }
 
+// parseAddress returns the network and address to dial for
+// the FastCGI server at addr, which is either a TCP address
+// (host:port) or the path to a Unix socket prefixed by "unix:".
+func parseAddress(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", addr[len("unix:"):]
+	}
+	return "tcp", addr
+}
+
 func (h Handler) exists(path string) bool {
 	if _, err := os.Stat(h.Root + path); err == nil {
 		return true
@@ -250,6 +264,8 @@ func parse(c middleware.Controller) ([]Rule, error) {
 					return rules, c.ArgErr()
 				}
 				rule.IndexFile = c.Val()
+			default:
+				return rules, c.Err("Expected valid fastcgi configuration property")
 			}
 		}
 
@@ -278,7 +294,8 @@ type Rule struct {
 	// The base path to match. Required.
 	Path string
 
-	// The address of the FastCGI server. Required.
+	// The address of the FastCGI server: either host:port or
+	// the path to a Unix socket prefixed with "unix:". Required.
 	Address string
 
 	// Always process files with this extension with fastcgi.
@@ -0,0 +1,72 @@
+package fastcgi
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeHTTPClientGone(t *testing.T) {
+	// A FastCGI server that reads the request but never responds
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn) // until the client closes the connection
+		close(closed)
+	}()
+
+	handler := Handler{
+		Root: t.TempDir(),
+		Rules: []Rule{{
+			Path:      "/",
+			Address:   listener.Addr().String(),
+			Ext:       ".php",
+			SplitPath: ".php",
+			IndexFile: "index.php",
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := http.NewRequestWithContext(ctx, "GET", "/index.php", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+
+	returned := make(chan int)
+	go func() {
+		status, _ := handler.ServeHTTP(httptest.NewRecorder(), r)
+		returned <- status
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case status := <-returned:
+		if status != http.StatusBadGateway {
+			t.Errorf("Expected status %d when the client went away, got %d", http.StatusBadGateway, status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected ServeHTTP to return when the client went away, but it didn't")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the connection to the FastCGI server to be closed, but it wasn't")
+	}
+}
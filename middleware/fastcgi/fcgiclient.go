@@ -13,6 +13,7 @@ package fastcgi
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -133,14 +134,22 @@ type FCGIClient struct {
 	buf       bytes.Buffer
 	keepAlive bool
 	reqId     uint16
+	closed    chan struct{} // closed by Close
+	closeOnce sync.Once
 }
 
 // Connects to the fcgi responder at the specified network address.
 // See func net.Dial for a description of the network and address parameters.
 func Dial(network, address string) (fcgi *FCGIClient, err error) {
-	var conn net.Conn
+	return DialContext(context.Background(), network, address)
+}
 
-	conn, err = net.Dial(network, address)
+// DialContext is like Dial, but gives up connecting when ctx is done.
+// If ctx is done after the connection is made, the connection is
+// closed then, which ends the request waiting on it.
+func DialContext(ctx context.Context, network, address string) (fcgi *FCGIClient, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
 	if err != nil {
 		return
 	}
@@ -149,6 +158,17 @@ func Dial(network, address string) (fcgi *FCGIClient, err error) {
 		rwc:       conn,
 		keepAlive: false,
 		reqId:     1,
+		closed:    make(chan struct{}),
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-fcgi.closed:
+			}
+		}()
 	}
 
 	return
@@ -156,6 +176,7 @@ func Dial(network, address string) (fcgi *FCGIClient, err error) {
 
 // Close fcgi connnection
 func (this *FCGIClient) Close() {
+	this.closeOnce.Do(func() { close(this.closed) })
 	this.rwc.Close()
 }
 
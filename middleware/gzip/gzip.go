@@ -5,8 +5,10 @@ package gzip
 import (
 	"compress/gzip"
 	"fmt"
-	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy/middleware"
@@ -18,34 +20,61 @@ import (
 // application/x-gzip and try to download a file.
 type Gzip struct {
 	Next middleware.Handler
+
+	// If not empty, only requests for paths with
+	// one of these extensions are compressed
+	Extensions []string
+
+	// If not empty, only responses with one of these
+	// media types are compressed; a type may end with
+	// "/*" to match all of its subtypes
+	MimeTypes []string
+
+	// Responses with fewer bytes than this are not compressed,
+	// going by their Content-Length or, if they don't have one,
+	// by how much is written before the response ends; one that
+	// is flushed before then is compressed
+	MinLength int
 }
 
 // New creates a new gzip middleware instance.
 func New(c middleware.Controller) (middleware.Middleware, error) {
+	g, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(next middleware.Handler) middleware.Handler {
-		return Gzip{Next: next}
+		g.Next = next
+		return g
 	}, nil
 }
 
 // ServeHTTP serves a gzipped response if the client supports it.
 func (g Gzip) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+	if !g.extensionAllowed(r.URL.Path) {
 		return g.Next.ServeHTTP(w, r)
 	}
 
-	// Delete this header so gzipping isn't repeated later in the chain
-	r.Header.Del("Accept-Encoding")
+	// Caches must know that the response depends on whether
+	// the client accepts gzip, whichever way this one goes
+	w.Header().Add("Vary", "Accept-Encoding")
 
-	w.Header().Set("Content-Encoding", "gzip")
-	gzipWriter := gzip.NewWriter(w)
-	defer gzipWriter.Close()
-	gz := gzipResponseWriter{Writer: gzipWriter, ResponseWriter: w}
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		return g.Next.ServeHTTP(w, r)
+	}
+
+	// Accept-Encoding is left as it is for the file server, which
+	// serves files compressed ahead of time (foo.js.gz for foo.js);
+	// responses that are already encoded aren't compressed again
+	gz := &gzipResponseWriter{ResponseWriter: w, gzip: g, status: http.StatusOK}
+	defer gz.close()
 
 	// Any response in forward middleware will now be compressed
 	status, err := g.Next.ServeHTTP(gz, r)
 
 	// If there was an error that remained unhandled, we need
-	// to send something back before gzipWriter gets closed at
+	// to send something back before gz gets closed at
 	// the return of this method!
 	if status >= 400 {
 		gz.Header().Set("Content-Type", "text/plain") // very necessary
@@ -57,18 +86,176 @@ func (g Gzip) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	}
 }
 
+// extensionAllowed returns whether a request for urlPath
+// may be compressed according to g.Extensions.
+func (g Gzip) extensionAllowed(urlPath string) bool {
+	if len(g.Extensions) == 0 {
+		return true
+	}
+	ext := path.Ext(urlPath)
+	for _, allowed := range g.Extensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeTypeAllowed returns whether a response with the
+// given Content-Type may be compressed according to
+// g.MimeTypes.
+func (g Gzip) mimeTypeAllowed(contentType string) bool {
+	if len(g.MimeTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range g.MimeTypes {
+		if mediaType == allowed ||
+			(strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
 // gzipResponeWriter wraps the underlying Write method
-// with a gzip.Writer to compress the output.
+// with a gzip.Writer to compress the output. Headers
+// and body are held back until it is known whether
+// the response should be compressed.
 type gzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	gzip     Gzip
+	writer   *gzip.Writer
+	buf      []byte // body written before deciding
+	status   int
+	decided  bool
+	compress bool
+}
+
+// WriteHeader records the status code; it is written
+// to the client once it is known whether to compress.
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.status = status
+	if length := w.Header().Get("Content-Length"); length != "" {
+		// We know the length, so no need to hold back the body
+		n, err := strconv.Atoi(length)
+		w.decide(err == nil && n > 0 && n >= w.gzip.MinLength)
+	}
 }
 
 // Write wraps the underlying Write method to do compression.
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 	if w.Header().Get("Content-Type") == "" {
 		w.Header().Set("Content-Type", http.DetectContentType(b))
 	}
-	n, err := w.Writer.Write(b)
-	return n, err
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.gzip.MinLength {
+			w.decide(true)
+		}
+		return len(b), nil
+	}
+	if w.compress {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide writes the header, compressing the response from then on
+// if long is true and the response qualifies, and writes out any
+// body written so far. Only the first call has an effect.
+func (w *gzipResponseWriter) decide(long bool) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	// Don't compress what is already encoded or doesn't have a body,
+	// nor parts of a file, whose byte ranges are of the file as it is
+	w.compress = long &&
+		w.Header().Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified &&
+		w.status != http.StatusPartialContent &&
+		w.gzip.mimeTypeAllowed(w.Header().Get("Content-Type"))
+
+	if w.compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.writer = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) > 0 {
+		w.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+// Flush sends what has been written so far to the client.
+// A response being streamed without a known length may go
+// on for a long time, so it is compressed if it hasn't been
+// decided yet.
+func (w *gzipResponseWriter) Flush() {
+	w.decide(true)
+	if w.writer != nil {
+		w.writer.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close finishes the response, writing out anything
+// still held back.
+func (w *gzipResponseWriter) close() {
+	w.decide(len(w.buf) > 0 && len(w.buf) >= w.gzip.MinLength)
+	if w.writer != nil {
+		w.writer.Close()
+	}
+}
+
+// parse sets up the gzip middleware from the tokens
+// of its directive(s).
+func parse(c middleware.Controller) (Gzip, error) {
+	var g Gzip
+
+	for c.Next() {
+		for c.NextBlock() {
+			switch c.Val() {
+			case "ext":
+				exts := c.RemainingArgs()
+				if len(exts) == 0 {
+					return g, c.ArgErr()
+				}
+				for _, ext := range exts {
+					if !strings.HasPrefix(ext, ".") {
+						return g, c.Err("Extension '" + ext + "' must start with a dot")
+					}
+				}
+				g.Extensions = append(g.Extensions, exts...)
+			case "mimes":
+				mimes := c.RemainingArgs()
+				if len(mimes) == 0 {
+					return g, c.ArgErr()
+				}
+				g.MimeTypes = append(g.MimeTypes, mimes...)
+			case "min_length":
+				if !c.NextArg() {
+					return g, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil || n < 0 {
+					return g, c.Err("Expecting a non-negative length, got '" + c.Val() + "'")
+				}
+				g.MinLength = n
+			default:
+				return g, c.Err("Expected valid gzip configuration property")
+			}
+		}
+	}
+
+	return g, nil
 }
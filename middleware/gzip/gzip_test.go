@@ -0,0 +1,81 @@
+package gzip
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestGzipRange(t *testing.T) {
+	const content = "Hello, world! Hello, world! Hello, world!"
+
+	// ServeContent answers range requests like the file server
+	g := Gzip{Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeContent(w, r, "file.txt", time.Unix(0, 0), strings.NewReader(content))
+		return http.StatusOK, nil
+	})}
+
+	for i, test := range []struct {
+		rangeHeader      string
+		expectedStatus   int
+		expectedCompress bool
+		expectedBody     string // if not empty, after decompressing
+		expectedContains []string
+	}{
+		{"", http.StatusOK, true, content, nil},
+		{"bytes=0-", http.StatusPartialContent, false, content, nil},
+		{"bytes=7-11", http.StatusPartialContent, false, "world", nil},
+		{"bytes=0-1,4-5", http.StatusPartialContent, false, "", []string{"Content-Range: bytes 0-1/41", "He", "Content-Range: bytes 4-5/41", "o,"}},
+	} {
+		r := httptest.NewRequest("GET", "/file.txt", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if test.rangeHeader != "" {
+			r.Header.Set("Range", test.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+
+		_, err := g.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if w.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, w.Code)
+		}
+
+		compressed := w.Header().Get("Content-Encoding") == "gzip"
+		if compressed != test.expectedCompress {
+			t.Errorf("Test %d: Expected compressed to be %v, got %v", i, test.expectedCompress, compressed)
+		}
+		body := w.Body.String()
+		if compressed {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("Test %d: Unable to read the gzipped body: %v", i, err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Test %d: Unable to decompress the body: %v", i, err)
+			}
+			body = string(b)
+		}
+		if test.expectedBody != "" && body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		for _, expected := range test.expectedContains {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Test %d: Expected body to contain %q, got %q", i, expected, body)
+			}
+		}
+		if length := w.Header().Get("Content-Length"); !compressed && length != "" && length != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("Test %d: Expected Content-Length %d, got %s", i, w.Body.Len(), length)
+		}
+	}
+}
@@ -4,7 +4,11 @@
 package headers
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -18,15 +22,88 @@ type Headers struct {
 
 // ServeHTTP implements the middleware.Handler interface and serves requests,
 // adding headers to the response according to the configured rules.
+// Headers are applied just before the response header is written,
+// or once the handlers are done if they didn't write a response,
+// so that error pages written after that have them as well.
 func (h Headers) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var headers []Header
 	for _, rule := range h.Rules {
 		if middleware.Path(r.URL.Path).Matches(rule.Url) {
-			for _, header := range rule.Headers {
-				w.Header().Set(header.Name, header.Value)
-			}
+			headers = append(headers, rule.Headers...)
 		}
 	}
-	return h.Next.ServeHTTP(w, r)
+	if len(headers) == 0 {
+		return h.Next.ServeHTTP(w, r)
+	}
+
+	// Values may have placeholders (see middleware.NewReplacer)
+	replacer := middleware.NewReplacer(r, nil, "")
+	for i := range headers {
+		headers[i].Value = replacer.Replace(headers[i].Value)
+	}
+	hw := &headerWriter{ResponseWriter: w, headers: headers}
+	status, err := h.Next.ServeHTTP(hw, r)
+
+	// If nothing was written, an error page will be, on w
+	// after this returns; it gets the headers too
+	hw.apply()
+	return status, err
+}
+
+// headerWriter is a http.ResponseWriter which applies headers
+// to the response right before the header is written, so they
+// take effect regardless of what handlers further down set.
+type headerWriter struct {
+	http.ResponseWriter
+	headers []Header
+	applied bool
+}
+
+// apply sets the headers, or removes those whose name
+// begins with "-". It only has an effect once.
+func (w *headerWriter) apply() {
+	if w.applied {
+		return
+	}
+	w.applied = true
+	for _, header := range w.headers {
+		if strings.HasPrefix(header.Name, "-") {
+			w.Header().Del(strings.TrimPrefix(header.Name, "-"))
+		} else {
+			w.Header().Set(header.Name, header.Value)
+		}
+	}
+}
+
+// WriteHeader applies the headers and writes the status code.
+func (w *headerWriter) WriteHeader(status int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write applies the headers if they haven't been yet
+// and writes the body.
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying
+// ResponseWriter does.
+func (w *headerWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.apply()
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker so that WebSocket
+// connections still work beneath this middleware.
+func (w *headerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("ResponseWriter does not implement http.Hijacker")
 }
 
 type (
@@ -38,6 +115,8 @@ type (
 	}
 
 	// Header represents a single HTTP header, simply a name and value.
+	// A name beginning with "-" removes the header from the response.
+	// The value may have placeholders (see middleware.NewReplacer).
 	Header struct {
 		Name  string
 		Value string
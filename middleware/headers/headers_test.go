@@ -0,0 +1,58 @@
+package headers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestHeaders(t *testing.T) {
+	rules := []HeaderRule{{Url: "/", Headers: []Header{
+		{Name: "X-Frame-Options", Value: "DENY"},
+		{Name: "X-Host", Value: "{host}"},
+		{Name: "-Server"},
+	}}}
+
+	for i, test := range []struct {
+		next           middleware.HandlerFunc
+		expectedStatus int
+	}{
+		// A response written by the handlers
+		{func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+			w.Header().Set("Server", "backend")
+			w.Write([]byte("page"))
+			return http.StatusOK, nil
+		}, http.StatusOK},
+		// An error, whose page is written after the handlers return
+		{func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("Server", "backend")
+			return http.StatusNotFound, nil
+		}, http.StatusNotFound},
+	} {
+		h := Headers{Next: test.next, Rules: rules}
+		r := httptest.NewRequest("GET", "/page", nil)
+		r.Host = "example.com"
+		w := httptest.NewRecorder()
+
+		status, err := h.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status >= 400 {
+			// As the server does when no middleware handled the error
+			w.WriteHeader(status)
+		}
+		if w.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, w.Code)
+		}
+
+		for name, expected := range map[string]string{"X-Frame-Options": "DENY", "X-Host": "example.com", "Server": ""} {
+			if actual := w.Header().Get(name); actual != expected {
+				t.Errorf("Test %d: Expected %s header %q, got %q", i, name, expected, actual)
+			}
+		}
+	}
+}
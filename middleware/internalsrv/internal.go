@@ -0,0 +1,61 @@
+// Package internalsrv is middleware that hides paths from clients,
+// such as template fragments that are only meant to be included
+// by other middleware.
+package internalsrv
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of internal middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	paths, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Internal{Next: next, Paths: paths}
+	}, nil
+}
+
+// Internal is middleware that responds with 404 Not Found to
+// requests for paths under any of Paths. Middleware further
+// down the chain, such as rewrite, may still route requests
+// to those paths, and files there may still be read directly
+// (e.g. included by templates).
+type Internal struct {
+	Next  middleware.Handler
+	Paths []string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (i Internal) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// Clean the path so that "/a/../includes" is blocked too
+	upath := path.Clean("/" + r.URL.Path)
+	for _, prefix := range i.Paths {
+		if middleware.Path(upath).Matches(prefix) {
+			return http.StatusNotFound, nil
+		}
+	}
+	return i.Next.ServeHTTP(w, r)
+}
+
+// parse gets the internal paths from the tokens
+// of the directive(s).
+func parse(c middleware.Controller) ([]string, error) {
+	var paths []string
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return paths, c.ArgErr()
+		}
+		paths = append(paths, args...)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,205 @@
+// Package jsonp is middleware that serves .json files as
+// application/json, and as JSONP (the JSON wrapped in a call
+// to a function named by the callback query parameter) for
+// scripts of other origins that ask for it.
+package jsonp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of jsonp middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	paths, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return JSONP{Next: next, Paths: paths}
+	}, nil
+}
+
+// JSONP is middleware that sets the Content-Type of responses
+// for .json files under Paths to application/json, whatever
+// the extension would otherwise map to. If the request has a
+// callback query parameter that is a JavaScript function name
+// (like "handle" or "app.handle"), a successful response is
+// wrapped in a call to it instead, as application/javascript.
+// Requests with a callback that isn't a valid name get 400 Bad
+// Request, so that the response can't be made into a script
+// of the client's choosing.
+type JSONP struct {
+	Next  middleware.Handler
+	Paths []string
+}
+
+// CallbackParam is the query parameter that names
+// the function to wrap the JSON in a call to.
+const CallbackParam = "callback"
+
+// callbackName matches the names of JavaScript functions,
+// possibly properties of objects, allowed as callbacks.
+var callbackName = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// ServeHTTP implements the middleware.Handler interface.
+func (j JSONP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if path.Ext(r.URL.Path) != ".json" || !j.appliesTo(r.URL.Path) {
+		return j.Next.ServeHTTP(w, r)
+	}
+
+	callback := r.URL.Query().Get(CallbackParam)
+	if callback == "" {
+		w.Header().Set("Content-Type", "application/json")
+		status, err := j.Next.ServeHTTP(w, r)
+		if status >= 400 {
+			w.Header().Del("Content-Type") // for the error page written above
+		}
+		return status, err
+	}
+	if !callbackName.MatchString(callback) {
+		return http.StatusBadRequest, nil
+	}
+
+	// A range of the JSON wouldn't be wrapped
+	r.Header.Del("Range")
+
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The comment keeps the response from starting with bytes
+	// that the client chose, which plugins may misread
+	cw := &callbackWriter{ResponseWriter: w, prefix: "/**/" + callback + "(", suffix: ");"}
+	status, err := j.Next.ServeHTTP(cw, r)
+	if status >= 400 && !cw.started {
+		cw.clearHeaders() // for the error page written above
+	}
+	cw.finish()
+	return status, err
+}
+
+// appliesTo returns whether upath is under any of j.Paths.
+func (j JSONP) appliesTo(upath string) bool {
+	for _, p := range j.Paths {
+		if middleware.Path(upath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// callbackWriter is a ResponseWriter that writes prefix
+// before the body of a successful response and suffix
+// after it, adding their length to its Content-Length.
+type callbackWriter struct {
+	http.ResponseWriter
+	prefix, suffix string
+	started        bool // whether the status has been written
+	wrapped        bool // whether the body is being wrapped
+	prefixed       bool // whether prefix has been written
+}
+
+// WriteHeader writes the status code, with the Content-Length
+// adjusted if the body is to be wrapped.
+func (w *callbackWriter) WriteHeader(status int) {
+	if w.started || status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.started = true
+	if status == http.StatusOK {
+		w.wrapped = true
+		if n, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil {
+			w.Header().Set("Content-Length", strconv.Itoa(n+len(w.prefix)+len(w.suffix)))
+		}
+	} else {
+		w.clearHeaders()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// clearHeaders removes the headers of a script from a
+// response that isn't wrapped, such as an error page,
+// unless the handler replaced them.
+func (w *callbackWriter) clearHeaders() {
+	if w.Header().Get("Content-Type") == "application/javascript" {
+		w.Header().Del("Content-Type")
+		w.Header().Del("X-Content-Type-Options")
+	}
+}
+
+// Write writes b, after the prefix if it is the first
+// write of a body that is being wrapped.
+func (w *callbackWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.wrapped && !w.prefixed {
+		w.prefixed = true
+		_, err := io.WriteString(w.ResponseWriter, w.prefix)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, if the underlying
+// ResponseWriter does, for streamed responses.
+func (w *callbackWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker so that WebSocket
+// connections still work beneath this middleware.
+func (w *callbackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("ResponseWriter does not implement http.Hijacker")
+}
+
+// finish writes the end of a wrapped body once the
+// handlers are done with the response.
+func (w *callbackWriter) finish() {
+	if !w.wrapped {
+		return
+	}
+	if !w.prefixed {
+		w.prefixed = true
+		io.WriteString(w.ResponseWriter, w.prefix)
+	}
+	io.WriteString(w.ResponseWriter, w.suffix)
+}
+
+// parse gets the paths from the tokens of the directive(s).
+// Each is a path, which defaults to "/", under which .json
+// files are served as JSON or JSONP:
+//
+//	jsonp [path]
+func parse(c middleware.Controller) ([]string, error) {
+	var paths []string
+
+	for c.Next() {
+		switch args := c.RemainingArgs(); len(args) {
+		case 0:
+			paths = append(paths, "/")
+		case 1:
+			paths = append(paths, args[0])
+		default:
+			return paths, c.ArgErr()
+		}
+	}
+
+	return paths, nil
+}
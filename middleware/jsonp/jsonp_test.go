@@ -0,0 +1,116 @@
+package jsonp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{"jsonp", false, []string{"/"}},
+		{"jsonp /api\njsonp /data", false, []string{"/api", "/data"}},
+		{"jsonp /api /data", true, nil},
+	} {
+		paths, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("Test %d: Expected paths %v, got %v", i, test.expected, paths)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	const data = `{"a": 1}`
+
+	j := JSONP{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/api/missing.json" {
+				return http.StatusNotFound, nil // written by the errors middleware
+			}
+			if r.URL.Path == "/api/gone.json" {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusGone)
+				io.WriteString(w, "Gone")
+				return 0, nil
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, data)
+			return http.StatusOK, nil
+		}),
+		Paths: []string{"/api"},
+	}
+
+	for i, test := range []struct {
+		path                string
+		callback            string
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+	}{
+		{"/api/data.json", "", http.StatusOK, data, "application/json"},
+		{"/api/data.json", "handle", http.StatusOK, "/**/handle(" + data + ");", "application/javascript"},
+		{"/api/data.json", "app.handle", http.StatusOK, "/**/app.handle(" + data + ");", "application/javascript"},
+		{"/api/data.json", "alert(1)//", http.StatusBadRequest, "", ""},
+		{"/api/data.json", "a.", http.StatusBadRequest, "", ""},
+		{"/api/missing.json", "handle", http.StatusNotFound, "", ""},
+		{"/api/missing.json", "", http.StatusNotFound, "", ""},
+		{"/api/gone.json", "handle", http.StatusGone, "Gone", "text/plain"},
+		{"/api/data.txt", "handle", http.StatusOK, data, ""},
+		{"/other/data.json", "handle", http.StatusOK, data, ""},
+	} {
+		target := test.path
+		if test.callback != "" {
+			target += "?" + CallbackParam + "=" + url.QueryEscape(test.callback)
+		}
+		r := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+
+		status, err := j.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if actual := w.Header().Get("Content-Type"); actual != test.expectedContentType {
+			t.Errorf("Test %d: Expected Content-Type %q, got %q", i, test.expectedContentType, actual)
+		}
+		if length := w.Header().Get("Content-Length"); length != "" && length != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("Test %d: Expected Content-Length %d, got %s", i, w.Body.Len(), length)
+		}
+		if test.expectedContentType == "application/javascript" && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("Test %d: Expected X-Content-Type-Options nosniff, but it isn't", i)
+		}
+		if test.expectedStatus >= 400 && test.expectedContentType == "" && w.Header().Get("X-Content-Type-Options") != "" {
+			t.Errorf("Test %d: Expected no X-Content-Type-Options on an error, but got some", i)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package languages is middleware that serves the version of
+// a file in the language the client prefers, as told by the
+// Accept-Language header, such as /index.fr.html for /index.html.
+package languages
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of languages middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.FileSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Languages{Next: next, Root: root, Rules: rules, IndexFiles: c.IndexFiles()}
+	}, nil
+}
+
+// Languages is middleware that rewrites the path of requests
+// for a file to that of its version in the language of the
+// client, if it exists in Root: the file name with the language
+// before the extension, like "index.fr.html". The language is
+// picked from those of the rule for the path by the lookup of
+// RFC 4647 (so "fr-CA" gets "fr" if there is no "fr-CA"), or the
+// first of them if the client accepts none. Requests for a
+// directory get the version of its index file. The response
+// says which language it is in, if any.
+type Languages struct {
+	Next       middleware.Handler
+	Root       http.FileSystem
+	Rules      []Rule
+	IndexFiles []string
+}
+
+// Rule is the languages that files under Path are
+// available in, the first being the default.
+type Rule struct {
+	Path      string
+	Languages []string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (l Languages) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	i := middleware.LongestMatch(r.URL.Path, len(l.Rules), func(i int) string { return l.Rules[i].Path })
+	if i < 0 {
+		return l.Next.ServeHTTP(w, r)
+	}
+	rule := l.Rules[i]
+
+	// The response depends on the header even if there
+	// is no version of this file in the language
+	w.Header().Add("Vary", "Accept-Language")
+
+	lang := rule.match(r.Header.Get("Accept-Language"))
+	upath := path.Clean("/" + r.URL.Path)
+	candidates := []string{upath}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		candidates = nil
+		for _, index := range l.IndexFiles {
+			candidates = append(candidates, path.Join(upath, index))
+		}
+	}
+
+	for _, candidate := range candidates {
+		localized := localize(candidate, lang)
+		if l.exists(localized) {
+			r.URL.Path = localized
+			w.Header().Set("Content-Language", lang)
+			break
+		}
+	}
+
+	return l.Next.ServeHTTP(w, r)
+}
+
+// exists returns whether name is a regular file in l.Root.
+func (l Languages) exists(name string) bool {
+	f, err := l.Root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// match returns the language of the rule that best matches
+// the language ranges of an Accept-Language header, by the
+// lookup of RFC 4647: each range in order of preference,
+// then with its last subtag removed, and so on, is compared
+// to the languages. "*" matches the default language, as
+// does a header with no match.
+func (rule Rule) match(header string) string {
+	for _, lang := range acceptedLanguages(header) {
+		if lang == "*" {
+			break
+		}
+		for lang != "" {
+			for _, available := range rule.Languages {
+				if strings.EqualFold(available, lang) {
+					return available
+				}
+			}
+			if i := strings.LastIndex(lang, "-"); i > 0 {
+				lang = lang[:i]
+				// A single letter or digit subtag can't stand at the end
+				if j := strings.LastIndex(lang, "-"); j >= 0 && j == len(lang)-2 {
+					lang = lang[:j]
+				}
+			} else {
+				lang = ""
+			}
+		}
+	}
+	return rule.Languages[0]
+}
+
+// acceptedLanguages returns the language ranges of an
+// Accept-Language header, most preferred first. Those
+// with a quality of 0 are left out.
+func acceptedLanguages(header string) []string {
+	type languageRange struct {
+		lang    string
+		quality float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		lang := strings.TrimSpace(fields[0])
+		if lang == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, languageRange{lang, quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	langs := make([]string, len(ranges))
+	for i, r := range ranges {
+		langs[i] = r.lang
+	}
+	return langs
+}
+
+// localize returns the name of the version of the file
+// name in lang: with lang before the extension, if any.
+func localize(name, lang string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + lang + ext
+}
+
+// parse gets the rules from the tokens of the directive(s).
+// Each is a path, which defaults to "/", and the languages
+// that files under it are available in, the default first:
+//
+//	languages [path] lang...
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			rule.Path, args = args[0], args[1:]
+		}
+		if len(args) == 0 {
+			return rules, c.ArgErr()
+		}
+		for _, lang := range args {
+			if lang == "*" || strings.ContainsAny(lang, "/.") {
+				return rules, c.Err("Invalid language '" + lang + "'; expected a tag like en or pt-BR")
+			}
+		}
+		rule.Languages = args
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,122 @@
+package languages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"languages en fr", false, []Rule{{Path: "/", Languages: []string{"en", "fr"}}}},
+		{"languages /docs en pt-BR", false, []Rule{{Path: "/docs", Languages: []string{"en", "pt-BR"}}}},
+		{"languages", true, nil},
+		{"languages /docs", true, nil},
+		{"languages en *", true, nil},
+		{"languages en.html", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rule := Rule{Languages: []string{"en", "fr", "zh-Hant", "pt-BR"}}
+
+	for i, test := range []struct {
+		header   string
+		expected string
+	}{
+		{"", "en"},
+		{"fr", "fr"},
+		{"FR", "fr"},
+		{"fr-CA", "fr"},                  // with the last subtag removed
+		{"zh-Hant-TW", "zh-Hant"},        // and so on
+		{"zh-Hant-x-private", "zh-Hant"}, // with the single letter subtag too
+		{"pt", "en"},                     // a range doesn't match a longer tag
+		{"de, fr;q=0.5", "fr"},
+		{"fr;q=0.5, pt-BR;q=0.8", "pt-BR"},
+		{"fr;q=0, de", "en"},
+		{"*", "en"},
+		{"de, *, fr", "en"},
+	} {
+		if actual := rule.match(test.header); actual != test.expected {
+			t.Errorf("Test %d: Expected %q to match %s, got %s", i, test.header, test.expected, actual)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	c := middlewaretest.NewController("languages /docs en fr")
+	c.Indexes = []string{"index.html"}
+	c.Files = http.FS(fstest.MapFS{
+		"docs/page.en.html":  {},
+		"docs/page.fr.html":  {},
+		"docs/index.fr.html": {},
+		"docs/only.html":     {},
+	})
+	mid, err := New(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var served string
+	h := mid(middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		served = r.URL.Path
+		return http.StatusOK, nil
+	}))
+
+	for i, test := range []struct {
+		path             string
+		acceptLanguage   string
+		expectedServed   string
+		expectedLanguage string
+		expectedVary     string
+	}{
+		{"/docs/page.html", "fr-CA, en;q=0.5", "/docs/page.fr.html", "fr", "Accept-Language"},
+		{"/docs/page.html", "de", "/docs/page.en.html", "en", "Accept-Language"},
+		{"/docs/", "fr", "/docs/index.fr.html", "fr", "Accept-Language"},
+		{"/docs/", "en", "/docs/", "", "Accept-Language"},
+		{"/docs/only.html", "fr", "/docs/only.html", "", "Accept-Language"},
+		{"/other/page.html", "fr", "/other/page.html", "", ""},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept-Language", test.acceptLanguage)
+		w := httptest.NewRecorder()
+
+		_, err := h.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if served != test.expectedServed {
+			t.Errorf("Test %d: Expected %s to be served, got %s", i, test.expectedServed, served)
+		}
+		if lang := w.Header().Get("Content-Language"); lang != test.expectedLanguage {
+			t.Errorf("Test %d: Expected Content-Language %q, got %q", i, test.expectedLanguage, lang)
+		}
+		if vary := w.Header().Get("Vary"); vary != test.expectedVary {
+			t.Errorf("Test %d: Expected Vary %q, got %q", i, test.expectedVary, vary)
+		}
+	}
+}
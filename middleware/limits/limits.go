@@ -0,0 +1,111 @@
+// Package limits is middleware for limiting the size of request
+// bodies, such as uploads.
+package limits
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of limit middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Limit{Next: next, Rules: rules}
+	}, nil
+}
+
+// Limit is middleware that limits the size of request bodies.
+// Requests whose body is larger than allowed get a response of
+// 413 Request Entity Too Large: right away if they say how long
+// the body is, otherwise as soon as the limit is read past.
+type Limit struct {
+	Next  middleware.Handler
+	Rules []Rule
+}
+
+// Rule is the largest size of request bodies, in bytes,
+// allowed for requests under Path.
+type Rule struct {
+	Path string
+	Size int64
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (l Limit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	i := middleware.LongestMatch(r.URL.Path, len(l.Rules), func(i int) string { return l.Rules[i].Path })
+	if i < 0 || r.Body == nil {
+		return l.Next.ServeHTTP(w, r)
+	}
+	rule := l.Rules[i]
+
+	if r.ContentLength > rule.Size {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, rule.Size)}
+	r.Body = body
+
+	status, err := l.Next.ServeHTTP(w, r)
+	if body.exceeded && (status >= 400 || err != nil) {
+		// Whatever failed, it was because the body was cut off
+		return http.StatusRequestEntityTooLarge, nil
+	}
+	return status, err
+}
+
+// limitedBody is a request body that remembers whether
+// reading it failed because it is over the limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// parse gets the limit rules from the tokens of the
+// directive(s). Each is a path, which defaults to "/",
+// and a size.
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+		var size string
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 1:
+			size = args[0]
+		case 2:
+			rule.Path, size = args[0], args[1]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		var err error
+		rule.Size, err = middleware.ParseSize(size)
+		if err != nil {
+			return rules, c.Err(err.Error())
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
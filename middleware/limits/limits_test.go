@@ -0,0 +1,88 @@
+package limits
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"limits 1kb", false, []Rule{{Path: "/", Size: 1024}}},
+		{"limits /upload 10mb\nlimits 100", false, []Rule{{Path: "/upload", Size: 10 << 20}, {Path: "/", Size: 100}}},
+		{"limits", true, nil},
+		{"limits /upload 1kb extra", true, nil},
+		{"limits lots", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	var reached bool
+	l := Limit{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			reached = true
+			if _, err := io.ReadAll(r.Body); err != nil {
+				return http.StatusBadRequest, err
+			}
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{{Path: "/", Size: 100}, {Path: "/upload", Size: 10}},
+	}
+
+	for i, test := range []struct {
+		path            string
+		body            string
+		knownLength     bool
+		expectedStatus  int
+		expectedReached bool
+	}{
+		{"/upload", "small", true, http.StatusOK, true},
+		{"/upload", "far too large", true, http.StatusRequestEntityTooLarge, false},
+		{"/upload", "far too large", false, http.StatusRequestEntityTooLarge, true},
+		{"/upload", "0123456789", false, http.StatusOK, true},
+		{"/", "far too large", true, http.StatusOK, true},
+	} {
+		reached = false
+		r := httptest.NewRequest("POST", test.path, strings.NewReader(test.body))
+		if !test.knownLength {
+			r.ContentLength = -1
+			r.Body = io.NopCloser(strings.NewReader(test.body))
+		}
+
+		status, err := l.ServeHTTP(httptest.NewRecorder(), r)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d (error %v)", i, test.expectedStatus, status, err)
+		}
+		if status != http.StatusOK && err != nil {
+			t.Errorf("Test %d: Expected no error along with the status, got %v", i, err)
+		}
+		if reached != test.expectedReached {
+			t.Errorf("Test %d: Expected the next handler to be reached: %v, but it was: %v", i, test.expectedReached, reached)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package log
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -16,28 +17,44 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
-	// Open the log files for writing when the server starts
-	c.Startup(func() error {
+	// Open the log files for writing when the server starts,
+	// and close them when it quits
+	startup, shutdown := middleware.ShareHooks(func() error {
 		for i := 0; i < len(rules); i++ {
-			var err error
-			var file *os.File
+			var out io.Writer
 
 			if rules[i].OutputFile == "stdout" {
-				file = os.Stdout
+				out = os.Stdout
 			} else if rules[i].OutputFile == "stderr" {
-				file = os.Stderr
+				out = os.Stderr
 			} else {
-				file, err = os.OpenFile(rules[i].OutputFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+				file, err := middleware.OpenLogFile(rules[i].OutputFile)
 				if err != nil {
 					return err
 				}
+				rules[i].file = file
+				out = file
 			}
 
-			rules[i].Log = log.New(file, "", 0)
+			rules[i].Log = log.New(out, "", 0)
 		}
 
+		return nil
+	}, func() error {
+		for i := 0; i < len(rules); i++ {
+			if rules[i].file == nil {
+				continue
+			}
+			err := rules[i].file.Close()
+			rules[i].file = nil
+			if err != nil {
+				return err
+			}
+		}
 		return nil
 	})
+	c.Startup(startup)
+	c.Shutdown(shutdown)
 
 	return func(next middleware.Handler) middleware.Handler {
 		return Logger{Next: next, Rules: rules}
@@ -49,7 +66,7 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 		if middleware.Path(r.URL.Path).Matches(rule.PathScope) {
 			responseRecorder := middleware.NewResponseRecorder(w)
 			status, err := l.Next.ServeHTTP(responseRecorder, r)
-			rep := middleware.NewReplacer(r, responseRecorder)
+			rep := middleware.NewReplacer(r, responseRecorder, middleware.EmptyStringReplacer)
 			rule.Log.Println(rep.Replace(rule.Format))
 			return status, err
 		}
@@ -104,16 +121,22 @@ func parse(c middleware.Controller) ([]LogRule, error) {
 	return rules, nil
 }
 
+// Logger is middleware that writes a line to a log for each
+// request, formatted according to the first matching rule.
 type Logger struct {
 	Next  middleware.Handler
 	Rules []LogRule
 }
 
+// LogRule configures logging of requests for paths under
+// PathScope to OutputFile, which may be "stdout" or "stderr".
+// Format may use any placeholders of middleware.NewReplacer.
 type LogRule struct {
 	PathScope  string
 	OutputFile string
 	Format     string
 	Log        *log.Logger
+	file       *middleware.LogFile // the opened OutputFile, if not stdout or stderr
 }
 
 const (
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"os"
+	"sync"
+)
+
+// LogFile is a file that middleware write logs to, which can be
+// reopened at the same path without the loggers writing to it
+// noticing; log rotation tools like logrotate rename the file
+// and then signal the server to start a new one.
+type LogFile struct {
+	path   string
+	mu     sync.Mutex // protects file, which Reopen replaces, and closed
+	file   *os.File
+	closed bool
+}
+
+var (
+	logFiles   = make(map[*LogFile]struct{}) // the log files open now
+	logFilesMu sync.Mutex
+)
+
+// OpenLogFile opens the file at path for appending log lines
+// to, creating it if need be, and registers it to be reopened
+// by ReopenLogFiles until it is closed.
+func OpenLogFile(path string) (*LogFile, error) {
+	file, err := openLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &LogFile{path: path, file: file}
+	logFilesMu.Lock()
+	logFiles[f] = struct{}{}
+	logFilesMu.Unlock()
+	return f, nil
+}
+
+// openLog opens the file at path for appending.
+func openLog(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// Write writes p to the file. Writes aren't buffered, so each
+// one is in the file, whichever one that is, when it returns.
+func (f *LogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen opens the file at the path of f again, such as after the
+// file that was there has been moved, and closes the old one once
+// writes go to the new one. If the path can't be opened, f keeps
+// writing to the old file.
+func (f *LogFile) Reopen() error {
+	file, err := openLog(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return file.Close()
+	}
+	old := f.file
+	f.file = file
+	f.mu.Unlock()
+
+	return old.Close()
+}
+
+// Close closes the file, which is no longer reopened by
+// ReopenLogFiles.
+func (f *LogFile) Close() error {
+	logFilesMu.Lock()
+	delete(logFiles, f)
+	logFilesMu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return f.file.Close()
+}
+
+// ReopenLogFiles reopens every log file that is open (see
+// LogFile.Reopen), returning the first error, if any, after
+// trying all of them.
+func ReopenLogFiles() error {
+	logFilesMu.Lock()
+	files := make([]*LogFile, 0, len(logFiles))
+	for f := range logFiles {
+		files = append(files, f)
+	}
+	logFilesMu.Unlock()
+
+	var firstErr error
+	for _, f := range files {
+		if err := f.Reopen(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ShareHooks returns startup and shutdown functions to register
+// in place of startup and shutdown, which open and close what a
+// middleware shares among the sites of a server block. Each site
+// (each address of the block) gets a copy of the functions, so
+// they are run once per site: the ones returned run startup only
+// the first time, and shutdown only once they have been run as
+// many times as startup succeeded, so that files are opened once
+// and closed when no site uses them anymore.
+func ShareHooks(startup, shutdown func() error) (func() error, func() error) {
+	var mu sync.Mutex
+	var users int
+
+	shared := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if users == 0 {
+			err := startup()
+			if err != nil {
+				return err
+			}
+		}
+		users++
+		return nil
+	}
+	unshared := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if users == 0 {
+			return nil
+		}
+		users--
+		if users > 0 {
+			return nil
+		}
+		return shutdown()
+	}
+	return shared, unshared
+}
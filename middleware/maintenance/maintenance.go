@@ -0,0 +1,144 @@
+// Package maintenance is middleware that takes a site down
+// for maintenance while a marker file exists, responding to
+// requests with 503 Service Unavailable and a page that says
+// so, except for those from allowed addresses.
+package maintenance
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of maintenance middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	m, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		m.Next = next
+		return m
+	}, nil
+}
+
+// Maintenance is middleware that, while the Marker file exists,
+// responds to requests from clients outside of Allowed with
+// 503 Service Unavailable, a Retry-After header, and the Page
+// file; if Page is empty, the error page for 503 is served,
+// as by the errors middleware. The marker is checked for each
+// request, so creating and removing it (such as in a deploy
+// script) turns maintenance on and off without a restart, and
+// the page is read each time it is served. Requests from
+// Allowed clients, such as the developers, are served as usual.
+type Maintenance struct {
+	Next       middleware.Handler
+	Marker     string
+	Page       string
+	Allowed    []*net.IPNet
+	RetryAfter time.Duration
+}
+
+// DefaultRetryAfter is how long clients are told to wait
+// before trying again if the directive doesn't say.
+const DefaultRetryAfter = 5 * time.Minute
+
+// ServeHTTP implements the middleware.Handler interface.
+func (m Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if _, err := os.Stat(m.Marker); err != nil || m.allows(r) {
+		return m.Next.ServeHTTP(w, r)
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(m.RetryAfter.Seconds())))
+	w.Header().Set("Cache-Control", "no-store")
+	if m.Page == "" {
+		return http.StatusServiceUnavailable, nil
+	}
+
+	page, err := os.ReadFile(m.Page)
+	if err != nil {
+		return http.StatusServiceUnavailable, err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(page)
+	return 0, nil // status < 400 signals that a response has been written
+}
+
+// allows returns whether r is from an allowed client.
+func (m Maintenance) allows(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, network := range m.Allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse gets the maintenance configuration from the tokens
+// of the directive, which look like:
+//
+//	maintenance marker [page] {
+//		allow       cidr...
+//		retry_after duration
+//	}
+//
+// where the addresses to allow are CIDRs, like 10.0.0.0/8, or
+// single IP addresses, and the time to retry after defaults to
+// DefaultRetryAfter.
+func parse(c middleware.Controller) (Maintenance, error) {
+	m := Maintenance{RetryAfter: DefaultRetryAfter}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 2:
+			m.Page = args[1]
+			fallthrough
+		case 1:
+			m.Marker = args[0]
+		default:
+			return m, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "allow":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return m, c.ArgErr()
+				}
+				for _, arg := range args {
+					network, err := middleware.ParseNetwork(arg)
+					if err != nil {
+						return m, c.Err("Invalid address '" + arg + "' to allow; expected an IP address or CIDR")
+					}
+					m.Allowed = append(m.Allowed, network)
+				}
+			case "retry_after":
+				if !c.NextArg() {
+					return m, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil || dur < time.Second {
+					return m, c.Err("Invalid retry_after '" + c.Val() + "'; expected a duration of at least 1s")
+				}
+				m.RetryAfter = dur
+			default:
+				return m, c.Err("Expected valid maintenance configuration property")
+			}
+		}
+	}
+
+	return m, nil
+}
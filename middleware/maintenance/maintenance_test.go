@@ -0,0 +1,121 @@
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input              string
+		shouldErr          bool
+		expectedMarker     string
+		expectedPage       string
+		expectedAllowed    int
+		expectedRetryAfter time.Duration
+	}{
+		{"maintenance /tmp/down", false, "/tmp/down", "", 0, DefaultRetryAfter},
+		{"maintenance /tmp/down down.html", false, "/tmp/down", "down.html", 0, DefaultRetryAfter},
+		{"maintenance /tmp/down {\nallow 10.0.0.0/8 192.0.2.1 ::1\nretry_after 1h\n}", false, "/tmp/down", "", 3, time.Hour},
+		{"maintenance", true, "", "", 0, 0},
+		{"maintenance a b c", true, "", "", 0, 0},
+		{"maintenance /tmp/down {\nallow\n}", true, "", "", 0, 0},
+		{"maintenance /tmp/down {\nallow nonsense\n}", true, "", "", 0, 0},
+		{"maintenance /tmp/down {\nretry_after 10ms\n}", true, "", "", 0, 0},
+		{"maintenance /tmp/down {\nretry_after\n}", true, "", "", 0, 0},
+		{"maintenance /tmp/down {\nunknown\n}", true, "", "", 0, 0},
+	} {
+		m, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if m.Marker != test.expectedMarker || m.Page != test.expectedPage || m.RetryAfter != test.expectedRetryAfter {
+			t.Errorf("Test %d: Expected marker %s, page %q and retry after %s, got %s, %q and %s", i,
+				test.expectedMarker, test.expectedPage, test.expectedRetryAfter, m.Marker, m.Page, m.RetryAfter)
+		}
+		if len(m.Allowed) != test.expectedAllowed {
+			t.Errorf("Test %d: Expected %d allowed networks, got %d", i, test.expectedAllowed, len(m.Allowed))
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	dir := t.TempDir()
+	marker, page := filepath.Join(dir, "down"), filepath.Join(dir, "down.html")
+	err := os.WriteFile(page, []byte("<h1>Back soon</h1>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := parse(middlewaretest.NewController("maintenance " + marker + " {\nallow 10.0.0.0/8\nretry_after 2m\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	serve := func(remoteAddr string) (int, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		status, err := m.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return status, w
+	}
+
+	for i, test := range []struct {
+		markerExists       bool
+		page               string
+		remoteAddr         string
+		expectedStatus     int
+		expectedRetryAfter string
+		expectedBody       string
+	}{
+		{false, "", "192.0.2.1:1234", http.StatusOK, "", ""},
+		{true, "", "192.0.2.1:1234", http.StatusServiceUnavailable, "120", ""},
+		{true, "", "10.1.2.3:1234", http.StatusOK, "", ""},
+		{true, page, "192.0.2.1:1234", 0, "120", "<h1>Back soon</h1>"},
+		{false, page, "192.0.2.1:1234", http.StatusOK, "", ""},
+	} {
+		if test.markerExists {
+			err = os.WriteFile(marker, nil, 0644)
+		} else {
+			err = os.Remove(marker)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		m.Page = test.page
+
+		status, w := serve(test.remoteAddr)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status == 0 && w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Test %d: Expected response status %d, got %d", i, http.StatusServiceUnavailable, w.Code)
+		}
+		if actual := w.Header().Get("Retry-After"); actual != test.expectedRetryAfter {
+			t.Errorf("Test %d: Expected Retry-After %q, got %q", i, test.expectedRetryAfter, actual)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
@@ -4,10 +4,12 @@ package markdown
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"regexp"
 	"strings"
 
 	"github.com/mholt/caddy/middleware"
@@ -15,7 +17,8 @@ import (
 )
 
 // Markdown implements a layer of middleware that serves
-// markdown as HTML.
+// markdown as HTML. The page is sent as it is rendered, a
+// section (from one heading to the next) at a time.
 type Markdown struct {
 	// Server root
 	Root string
@@ -43,6 +46,11 @@ type MarkdownConfig struct {
 
 	// List of JavaScript files to load for each markdown file
 	Scripts []string
+
+	// The HTML page to put rendered markdown in, with the
+	// same {{title}}, {{css}}, {{js}}, and {{body}}
+	// placeholders as the default page
+	Template string
 }
 
 // New creates a new instance of Markdown middleware that
@@ -83,7 +91,7 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 					return http.StatusNotFound, nil
 				}
 
-				content := blackfriday.Markdown(body, m.Renderer, 0)
+				metadata, body := frontMatter(body)
 
 				var scripts, styles string
 				for _, style := range m.Styles {
@@ -93,10 +101,12 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 					scripts += strings.Replace(jsTemplate, "{{url}}", script, 1) + "\r\n"
 				}
 
-				// Title is first line (length-limited), otherwise filename
+				// Title is from front matter, or first line (length-limited), otherwise filename
 				title := path.Base(fpath)
 				newline := bytes.Index(body, []byte("\n"))
-				if newline > -1 {
+				if metadata["title"] != "" {
+					title = metadata["title"]
+				} else if newline > -1 {
 					firstline := body[:newline]
 					newTitle := strings.TrimSpace(string(firstline))
 					if len(newTitle) > 1 {
@@ -108,15 +118,33 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 					}
 				}
 
-				html := htmlTemplate
+				html := m.Template
 				html = strings.Replace(html, "{{title}}", title, 1)
 				html = strings.Replace(html, "{{css}}", styles, 1)
 				html = strings.Replace(html, "{{js}}", scripts, 1)
-				html = strings.Replace(html, "{{body}}", string(content), 1)
 
-				w.Write([]byte(html))
+				// Render the content a section at a time into the
+				// page, sending the output as it is rendered
+				out := middleware.NewStreamWriter(w, streamChunkSize)
+				before, after, found := strings.Cut(html, "{{body}}")
+				io.WriteString(out, before)
+				if found {
+					for i, section := range sections(body) {
+						if i > 0 {
+							io.WriteString(out, "\n")
+						}
+						out.Write(blackfriday.Markdown(section, m.Renderer, 0))
+					}
+					io.WriteString(out, after)
+				}
 
-				return http.StatusOK, nil
+				err = out.Flush()
+				if err != nil && !out.Started() {
+					return http.StatusInternalServerError, err
+				}
+				// Once part of the page is sent, it's too late for
+				// an error page; the error can still be logged
+				return http.StatusOK, err
 			}
 		}
 	}
@@ -125,6 +153,80 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	return md.Next.ServeHTTP(w, r)
 }
 
+// streamChunkSize is how much of a rendered page is
+// buffered before it is sent to the client.
+const streamChunkSize = 32 << 10
+
+var (
+	// referenceLine matches the definitions of reference links,
+	// which may be used anywhere in the document.
+	referenceLine = regexp.MustCompile(`(?m)^ {0,3}\[[^\]]+\]:`)
+
+	// htmlLine matches lines that may start HTML blocks,
+	// which may go on past blank lines and headings.
+	htmlLine = regexp.MustCompile(`(?m)^ {0,3}<`)
+)
+
+// sections splits body into the parts of the document that
+// can be rendered on their own, so that a long one isn't
+// rendered all at once: each starts at a heading after a
+// blank line, which ends any block before it. Documents with
+// reference links or HTML blocks aren't split, since parts of
+// them may depend on each other.
+func sections(body []byte) [][]byte {
+	if referenceLine.Match(body) || htmlLine.Match(body) {
+		return [][]byte{body}
+	}
+
+	var parts [][]byte
+	start, blank := 0, false
+	for offset := 0; offset < len(body); {
+		end := bytes.IndexByte(body[offset:], '\n') + 1
+		if end == 0 {
+			end = len(body) - offset
+		}
+		line := body[offset : offset+end]
+
+		if blank && offset > start && line[0] == '#' {
+			parts = append(parts, body[start:offset])
+			start = offset
+		}
+		blank = len(bytes.TrimSpace(line)) == 0
+
+		offset += end
+	}
+	return append(parts, body[start:])
+}
+
+// frontMatter splits body into the key/value pairs of its front
+// matter and the rest of the document. Front matter is a block of
+// "key: value" lines at the very beginning of the file, starting
+// and ending with a line of "---". If there is no front matter,
+// body is returned unchanged.
+func frontMatter(body []byte) (map[string]string, []byte) {
+	metadata := make(map[string]string)
+
+	lines := strings.SplitAfter(string(body), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return metadata, body
+	}
+
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		offset += len(line)
+		if strings.TrimSpace(line) == "---" {
+			return metadata, body[offset:]
+		}
+		if colon := strings.Index(line, ":"); colon > -1 {
+			key := strings.TrimSpace(line[:colon])
+			metadata[key] = strings.Trim(strings.TrimSpace(line[colon+1:]), `"`)
+		}
+	}
+
+	// No closing line, so it wasn't front matter after all
+	return make(map[string]string), body
+}
+
 // parse creates new instances of Markdown middleware.
 func parse(c middleware.Controller) ([]MarkdownConfig, error) {
 	var mdconfigs []MarkdownConfig
@@ -132,6 +234,7 @@ func parse(c middleware.Controller) ([]MarkdownConfig, error) {
 	for c.Next() {
 		md := MarkdownConfig{
 			Renderer: blackfriday.HtmlRenderer(0, "", ""),
+			Template: htmlTemplate,
 		}
 
 		// Get the path scope
@@ -159,6 +262,15 @@ func parse(c middleware.Controller) ([]MarkdownConfig, error) {
 					return mdconfigs, c.ArgErr()
 				}
 				md.Scripts = append(md.Scripts, c.Val())
+			case "template":
+				if !c.NextArg() {
+					return mdconfigs, c.ArgErr()
+				}
+				tpl, err := ioutil.ReadFile(c.Val())
+				if err != nil {
+					return mdconfigs, c.Err("Unable to read markdown template '" + c.Val() + "': " + err.Error())
+				}
+				md.Template = string(tpl)
 			default:
 				return mdconfigs, c.Err("Expected valid markdown configuration property")
 			}
@@ -0,0 +1,95 @@
+// Package methods is middleware that only allows some
+// request methods for paths, such as to keep a static
+// site read-only.
+package methods
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of methods middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Methods{Next: next, Rules: rules}
+	}, nil
+}
+
+// Methods is middleware that responds with 405 Method Not
+// Allowed, and an Allow header listing the allowed methods,
+// to requests with a method that isn't allowed for their path.
+// Requests for paths without a rule are allowed any method.
+type Methods struct {
+	Next  middleware.Handler
+	Rules []Rule
+}
+
+// Rule is the request methods allowed for requests under
+// Path. HEAD is allowed wherever GET is.
+type Rule struct {
+	Path    string
+	Methods []string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (m Methods) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	i := middleware.LongestMatch(r.URL.Path, len(m.Rules), func(i int) string { return m.Rules[i].Path })
+	if i < 0 || m.Rules[i].allows(r.Method) {
+		return m.Next.ServeHTTP(w, r)
+	}
+
+	w.Header().Set("Allow", strings.Join(m.Rules[i].Methods, ", "))
+	return http.StatusMethodNotAllowed, nil
+}
+
+// allows returns whether the rule allows method.
+func (r Rule) allows(method string) bool {
+	for _, m := range r.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// parse gets the rules from the tokens of the directive(s).
+// Each is a path, which defaults to "/", and the methods
+// allowed under it:
+//
+//	methods [path] method...
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			rule.Path, args = args[0], args[1:]
+		}
+		if len(args) == 0 {
+			return rules, c.ArgErr()
+		}
+
+		for _, method := range args {
+			method = strings.ToUpper(method)
+			if !rule.allows(method) {
+				rule.Methods = append(rule.Methods, method)
+			}
+		}
+		if rule.allows("GET") && !rule.allows("HEAD") {
+			rule.Methods = append(rule.Methods, "HEAD")
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
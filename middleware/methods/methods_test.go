@@ -0,0 +1,78 @@
+package methods
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"methods get", false, []Rule{{Path: "/", Methods: []string{"GET", "HEAD"}}}},
+		{"methods /api GET POST post", false, []Rule{{Path: "/api", Methods: []string{"GET", "POST", "HEAD"}}}},
+		{"methods /upload PUT", false, []Rule{{Path: "/upload", Methods: []string{"PUT"}}}},
+		{"methods HEAD GET", false, []Rule{{Path: "/", Methods: []string{"HEAD", "GET"}}}},
+		{"methods", true, nil},
+		{"methods /api", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	m := Methods{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Rules: []Rule{
+			{Path: "/", Methods: []string{"GET", "HEAD"}},
+			{Path: "/api", Methods: []string{"GET", "POST", "HEAD"}},
+		},
+	}
+
+	for i, test := range []struct {
+		method         string
+		path           string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{"GET", "/page", http.StatusOK, ""},
+		{"HEAD", "/page", http.StatusOK, ""},
+		{"POST", "/page", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"POST", "/api/users", http.StatusOK, ""},
+		{"DELETE", "/api/users", http.StatusMethodNotAllowed, "GET, POST, HEAD"},
+	} {
+		w := httptest.NewRecorder()
+		status, err := m.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if allow := w.Header().Get("Allow"); allow != test.expectedAllow {
+			t.Errorf("Test %d: Expected Allow %q, got %q", i, test.expectedAllow, allow)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package metrics is middleware that counts the requests to a
+// site and serves the counts at a path, for monitoring.
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of metrics middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	m, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		m.Next = next
+		return m
+	}, nil
+}
+
+// Metrics is middleware that counts requests by the status code
+// of their responses and keeps the total time taken to serve
+// them. The counts are served as plain text at Path, and if
+// Username is set, only to clients with Username and Password.
+// Requests for Path itself are not counted.
+type Metrics struct {
+	Next     middleware.Handler
+	Path     string
+	Username string
+	Password string
+
+	counts *counts
+}
+
+// DefaultPath is the path at which metrics are
+// served if the directive doesn't have one.
+const DefaultPath = "/metrics"
+
+// counts are the requests counted so far.
+type counts struct {
+	mu       sync.Mutex
+	requests int64
+	statuses map[int]int64
+	duration time.Duration
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (m Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.URL.Path == m.Path {
+		return m.serveMetrics(w, r)
+	}
+
+	start := time.Now()
+	rec := &recorder{ResponseWriter: w}
+	status, err := m.Next.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.status = status // not written yet; the errors middleware will
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	m.counts.add(rec.status, time.Since(start))
+
+	return status, err
+}
+
+// serveMetrics writes the counts to w, one per line, like:
+//
+//	requests 120
+//	requests{status="200"} 118
+//	requests{status="404"} 2
+//	request_duration_seconds_average 0.0042
+func (m Metrics) serveMetrics(w http.ResponseWriter, r *http.Request) (int, error) {
+	if m.Username != "" {
+		username, password, ok := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(username), []byte(m.Username))
+		passOK := subtle.ConstantTimeCompare([]byte(password), []byte(m.Password))
+		if !ok || userOK&passOK != 1 {
+			w.Header().Set("WWW-Authenticate", "Basic")
+			return http.StatusUnauthorized, nil
+		}
+	}
+
+	m.counts.mu.Lock()
+	requests, duration := m.counts.requests, m.counts.duration
+	var codes []int
+	statuses := make(map[int]int64, len(m.counts.statuses))
+	for code, n := range m.counts.statuses {
+		codes = append(codes, code)
+		statuses[code] = n
+	}
+	m.counts.mu.Unlock()
+	sort.Ints(codes)
+
+	var average float64
+	if requests > 0 {
+		average = duration.Seconds() / float64(requests)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "requests %d\n", requests)
+	for _, code := range codes {
+		fmt.Fprintf(w, "requests{status=\"%d\"} %d\n", code, statuses[code])
+	}
+	fmt.Fprintf(w, "request_duration_seconds_average %g\n", average)
+
+	return http.StatusOK, nil
+}
+
+// add counts a request that got a response with
+// status and took duration to serve.
+func (c *counts) add(status int, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests++
+	c.statuses[status]++
+	c.duration += duration
+}
+
+// recorder is a ResponseWriter that records the
+// status code written to it, if any.
+type recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and calls the
+// underlying ResponseWriter's WriteHeader method.
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records a status of 200 if no status code
+// was written before, and writes buf.
+func (r *recorder) Write(buf []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher, if the underlying
+// ResponseWriter does, for streamed responses.
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// parse gets the metrics configuration from the tokens
+// of the directive, which look like:
+//
+//	metrics [path] {
+//		basicauth username password
+//	}
+//
+// where the path defaults to DefaultPath.
+func parse(c middleware.Controller) (Metrics, error) {
+	m := Metrics{Path: DefaultPath, counts: &counts{statuses: make(map[int]int64)}}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			m.Path = args[0]
+		default:
+			return m, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "basicauth":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return m, c.ArgErr()
+				}
+				m.Username, m.Password = args[0], args[1]
+			default:
+				return m, c.Err("Expected valid metrics configuration property")
+			}
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input            string
+		shouldErr        bool
+		expectedPath     string
+		expectedUsername string
+		expectedPassword string
+	}{
+		{"metrics", false, DefaultPath, "", ""},
+		{"metrics /stats", false, "/stats", "", ""},
+		{"metrics /stats {\nbasicauth admin secret\n}", false, "/stats", "admin", "secret"},
+		{"metrics /a /b", true, "", "", ""},
+		{"metrics {\nbasicauth admin\n}", true, "", "", ""},
+		{"metrics {\nunknown\n}", true, "", "", ""},
+	} {
+		m, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if m.Path != test.expectedPath || m.Username != test.expectedUsername || m.Password != test.expectedPassword {
+			t.Errorf("Test %d: Expected path %s and credentials %s:%s, got %s and %s:%s", i,
+				test.expectedPath, test.expectedUsername, test.expectedPassword, m.Path, m.Username, m.Password)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	m, err := parse(middlewaretest.NewController("metrics {\nbasicauth admin secret\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		switch r.URL.Path {
+		case "/missing":
+			return http.StatusNotFound, nil // written by the errors middleware
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			return 0, nil
+		}
+		w.Write([]byte("Hello"))
+		return http.StatusOK, nil
+	})
+
+	for _, path := range []string{"/", "/page", "/missing", "/created"} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	get := func(username, password string) (int, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", DefaultPath, nil)
+		if username != "" {
+			r.SetBasicAuth(username, password)
+		}
+		w := httptest.NewRecorder()
+		status, err := m.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return status, w
+	}
+
+	for i, test := range []struct {
+		username, password string
+	}{
+		{"", ""},
+		{"admin", "wrong"},
+		{"other", "secret"},
+	} {
+		status, w := get(test.username, test.password)
+		if status != http.StatusUnauthorized {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusUnauthorized, status)
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Test %d: Expected a WWW-Authenticate header, but got none", i)
+		}
+	}
+
+	// Twice, to see that neither the metrics path nor the
+	// unauthorized requests for it are counted
+	for i := 0; i < 2; i++ {
+		status, w := get("admin", "secret")
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		if actual := w.Header().Get("Content-Type"); actual != "text/plain; charset=utf-8" {
+			t.Errorf("Expected Content-Type text/plain, got %s", actual)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+		expected := []string{
+			"requests 4",
+			`requests{status="200"} 2`,
+			`requests{status="201"} 1`,
+			`requests{status="404"} 1`,
+		}
+		if len(lines) != len(expected)+1 {
+			t.Fatalf("Expected %d lines, got %q", len(expected)+1, lines)
+		}
+		for j, line := range expected {
+			if lines[j] != line {
+				t.Errorf("Line %d: Expected %q, got %q", j, line, lines[j])
+			}
+		}
+		if !strings.HasPrefix(lines[len(expected)], "request_duration_seconds_average ") {
+			t.Errorf("Expected the average duration last, got %q", lines[len(expected)])
+		}
+	}
+}
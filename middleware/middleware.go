@@ -59,6 +59,15 @@ type (
 		// Root returns the file path from which the server is serving.
 		Root() string
 
+		// FileSystem returns the files of Root: the file system
+		// given in the config if there is one, the files in the
+		// archive if Root is one, or else the directory on disk.
+		FileSystem() (http.FileSystem, error)
+
+		// IndexFiles returns the names of the files that the server
+		// serves for a directory, in order of preference.
+		IndexFiles() []string
+
 		// Context returns the path scope that the Controller is in.
 		// Note: This is not currently used, but may be in the future.
 		Context() Path
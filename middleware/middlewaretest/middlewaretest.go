@@ -0,0 +1,234 @@
+// Package middlewaretest provides a middleware.Controller for
+// tests of the parsing and setup of middleware, which can't use
+// the one of the config package since it imports the middleware:
+//
+//	c := middlewaretest.NewController("gzip /images")
+//	rules, err := parse(c)
+package middlewaretest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Controller is a middleware.Controller that dispenses the
+// tokens of an input string like those of a Caddyfile, and
+// records the functions registered with it.
+type Controller struct {
+	// The root and index files to give middleware; the
+	// root defaults to "."
+	RootPath string
+	Indexes  []string
+
+	// The file system to give middleware; if nil, it is the
+	// directory at RootPath
+	Files http.FileSystem
+
+	// The path scope of the directive
+	PathScope string
+
+	// The functions registered with Startup and Shutdown
+	StartupFuncs  []func() error
+	ShutdownFuncs []func() error
+
+	tokens  []token
+	cursor  int
+	nesting int
+}
+
+// token is a word of the input and where it is.
+type token struct {
+	line, column int
+	text         string
+}
+
+// NewController returns a Controller that dispenses the tokens
+// of input, which are separated by whitespace unless they are in
+// quotes. Lines starting with "#" are comments.
+func NewController(input string) *Controller {
+	c := &Controller{RootPath: ".", cursor: -1}
+	for i, line := range strings.Split(input, "\n") {
+		c.tokens = append(c.tokens, tokenize(line, i+1)...)
+	}
+	return c
+}
+
+// tokenize returns the tokens of line, the number n line
+// of the input.
+func tokenize(line string, n int) []token {
+	var tokens []token
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		if unicode.IsSpace(runes[i]) {
+			continue
+		}
+		if runes[i] == '#' {
+			break
+		}
+		start := i
+		var text []rune
+		if runes[i] == '"' {
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == '"' {
+					i++
+				}
+				text = append(text, runes[i])
+			}
+		} else {
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+				text = append(text, runes[i])
+			}
+		}
+		tokens = append(tokens, token{line: n, column: start + 1, text: string(text)})
+	}
+	return tokens
+}
+
+// Next loads the next token. Returns true if a token
+// was loaded; false otherwise.
+func (c *Controller) Next() bool {
+	if c.cursor < len(c.tokens)-1 {
+		c.cursor++
+		return true
+	}
+	return false
+}
+
+// NextArg loads the next token if it is on the same line.
+func (c *Controller) NextArg() bool {
+	if c.cursor < 0 {
+		c.cursor++
+		return true
+	}
+	if c.cursor < len(c.tokens)-1 && c.tokens[c.cursor].line == c.tokens[c.cursor+1].line {
+		c.cursor++
+		return true
+	}
+	return false
+}
+
+// NextLine loads the next token only if it is not on the
+// same line as the current token.
+func (c *Controller) NextLine() bool {
+	if c.cursor < 0 {
+		c.cursor++
+		return true
+	}
+	if c.cursor < len(c.tokens)-1 && c.tokens[c.cursor].line < c.tokens[c.cursor+1].line {
+		c.cursor++
+		return true
+	}
+	return false
+}
+
+// NextBlock loads the next token as long as it opens a
+// block or is already in a block.
+func (c *Controller) NextBlock() bool {
+	if c.nesting > 0 {
+		c.Next()
+		if c.Val() == "}" {
+			c.nesting--
+			return false
+		}
+		return true
+	}
+	if !c.NextArg() {
+		return false
+	}
+	if c.Val() != "{" {
+		c.cursor--
+		return false
+	}
+	c.Next()
+	c.nesting++
+	return true
+}
+
+// Val gets the text of the current token.
+func (c *Controller) Val() string {
+	if c.cursor < 0 || c.cursor >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.cursor].text
+}
+
+// Args loads the next arguments into targets, and returns
+// false if there weren't enough.
+func (c *Controller) Args(targets ...*string) bool {
+	for _, target := range targets {
+		if !c.NextArg() {
+			return false
+		}
+		*target = c.Val()
+	}
+	return true
+}
+
+// RemainingArgs loads the rest of the arguments on the line,
+// up to an open curly brace.
+func (c *Controller) RemainingArgs() []string {
+	var args []string
+	for c.NextArg() {
+		if c.Val() == "{" {
+			c.cursor--
+			break
+		}
+		args = append(args, c.Val())
+	}
+	return args
+}
+
+// ArgErr returns an error about the wrong number of arguments.
+func (c *Controller) ArgErr() error {
+	if c.Val() == "{" {
+		return c.Err("Unexpected token '{', expecting argument")
+	}
+	return c.Err("Wrong argument count or unexpected line ending after '" + c.Val() + "'")
+}
+
+// Err returns an error with msg and the position of the
+// current token.
+func (c *Controller) Err(msg string) error {
+	if c.cursor < 0 || c.cursor >= len(c.tokens) {
+		return fmt.Errorf("Testfile - Parse error: %s", msg)
+	}
+	tok := c.tokens[c.cursor]
+	return fmt.Errorf("Testfile:%d:%d - Parse error: %s", tok.line, tok.column, msg)
+}
+
+// Startup records fn in c.StartupFuncs.
+func (c *Controller) Startup(fn func() error) {
+	c.StartupFuncs = append(c.StartupFuncs, fn)
+}
+
+// Shutdown records fn in c.ShutdownFuncs.
+func (c *Controller) Shutdown(fn func() error) {
+	c.ShutdownFuncs = append(c.ShutdownFuncs, fn)
+}
+
+// Root returns c.RootPath.
+func (c *Controller) Root() string {
+	return c.RootPath
+}
+
+// FileSystem returns c.Files, or the directory at c.RootPath.
+func (c *Controller) FileSystem() (http.FileSystem, error) {
+	if c.Files != nil {
+		return c.Files, nil
+	}
+	return http.Dir(c.RootPath), nil
+}
+
+// IndexFiles returns c.Indexes.
+func (c *Controller) IndexFiles() []string {
+	return c.Indexes
+}
+
+// Context returns the path scope of c.
+func (c *Controller) Context() middleware.Path {
+	return middleware.Path(c.PathScope)
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseNetwork parses a CIDR range, like "10.0.0.0/8", or a
+// single IP address as the range of just that address, such
+// as for the trusted proxies or allowed clients of a directive.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, &net.ParseError{Type: "IP address", Text: s}
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -11,3 +11,18 @@ type Path string
 func (p Path) Matches(other string) bool {
 	return strings.HasPrefix(string(p), other)
 }
+
+// LongestMatch returns the index of the longest of n paths,
+// given by path(i), that upath is under, or -1 if there is
+// none; of paths of the same length, the first wins. It is
+// how middleware picks which of its rules applies to the
+// path of a request.
+func LongestMatch(upath string, n int, path func(i int) string) int {
+	match := -1
+	for i := 0; i < n; i++ {
+		if Path(upath).Matches(path(i)) && (match < 0 || len(path(i)) > len(path(match))) {
+			match = i
+		}
+	}
+	return match
+}
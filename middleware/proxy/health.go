@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream is a backend host to which requests can be proxied.
+type Upstream struct {
+	Host string
+	down int32 // nonzero while the upstream fails health checks
+}
+
+// Down returns whether the upstream failed its last health check.
+func (u *Upstream) Down() bool {
+	return atomic.LoadInt32(&u.down) != 0
+}
+
+// HealthCheck periodically requests Path from each upstream
+// and marks it down if it does not respond with a 2xx status
+// within Interval. An upstream is up again once it passes.
+type HealthCheck struct {
+	Path     string
+	Interval time.Duration
+
+	stop      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// Start begins checking upstreams in the background. It
+// only has an effect the first time it is called, since
+// every host sharing the configuration will call it.
+func (hc *HealthCheck) Start(upstreams []*Upstream) {
+	hc.startOnce.Do(func() {
+		hc.stop = make(chan struct{})
+		go hc.run(upstreams)
+	})
+}
+
+// Stop stops the checks begun by Start.
+func (hc *HealthCheck) Stop() {
+	hc.stopOnce.Do(func() {
+		if hc.stop != nil {
+			close(hc.stop)
+		}
+	})
+}
+
+// run checks upstreams every interval until stopped.
+func (hc *HealthCheck) run(upstreams []*Upstream) {
+	client := &http.Client{Timeout: hc.Interval}
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, upstream := range upstreams {
+			hc.check(client, upstream)
+		}
+		select {
+		case <-ticker.C:
+		case <-hc.stop:
+			return
+		}
+	}
+}
+
+// check probes a single upstream and records the result.
+func (hc *HealthCheck) check(client *http.Client, upstream *Upstream) {
+	var down int32 = 1
+
+	resp, err := client.Get(baseURL(upstream.Host, "http") + hc.Path)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			down = 0
+		}
+	}
+
+	atomic.StoreInt32(&upstream.down, down)
+}
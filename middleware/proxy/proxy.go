@@ -2,10 +2,14 @@
 package proxy
 
 import (
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -21,38 +25,87 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 
 	for _, rule := range p.Rules {
 		if middleware.Path(r.URL.Path).Matches(rule.From) {
-			var base string
-
-			if strings.HasPrefix(rule.To, "http") { // includes https
-				// destination includes a scheme! no need to guess
-				base = rule.To
-			} else {
-				// no scheme specified; assume same as request
-				var scheme string
-				if r.TLS == nil {
-					scheme = "http"
-				} else {
-					scheme = "https"
+			// Take turns among the upstreams, skipping those that
+			// failed health checks and trying the next one if an
+			// upstream can't be reached
+			start := atomic.AddUint32(rule.next, 1)
+			err := errors.New("All upstreams for " + rule.From + " are down")
+
+			for i := 0; i < len(rule.Upstreams); i++ {
+				upstream := rule.Upstreams[(start+uint32(i))%uint32(len(rule.Upstreams))]
+				if upstream.Down() {
+					continue
 				}
-				base = scheme + "://" + rule.To
-			}
 
-			baseUrl, err := url.Parse(base)
-			if err != nil {
-				return http.StatusInternalServerError, err
+				var status int
+				status, err = proxyTo(upstream.Host, w, r)
+				if err == nil {
+					return status, nil
+				}
+				if !isDialError(err) || r.Context().Err() != nil {
+					// Don't try another upstream if this one got the
+					// request, or if the client has gone away
+					return status, err
+				}
 			}
-			r.Host = baseUrl.Host
 
-			// TODO: Construct this before; not during every request, if possible
-			proxy := httputil.NewSingleHostReverseProxy(baseUrl)
-			proxy.ServeHTTP(w, r)
-			return 0, nil
+			return http.StatusBadGateway, err
 		}
 	}
 
 	return p.Next.ServeHTTP(w, r)
 }
 
+// proxyTo proxies r to the upstream host and streams back the
+// response. If an error is returned, nothing has been written
+// to w. The upstream request is made with the context of r, so
+// it is canceled, and its connection closed, if the client goes
+// away before the response is done.
+func proxyTo(upstream string, w http.ResponseWriter, r *http.Request) (int, error) {
+	// If no scheme is specified, assume same as request
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	baseUrl, err := url.Parse(baseURL(upstream, scheme))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	r.Host = baseUrl.Host
+
+	// TODO: Construct this before; not during every request, if possible
+	var proxyErr error
+	proxy := httputil.NewSingleHostReverseProxy(baseUrl)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		proxyErr = err // leave the response to the caller
+	}
+	proxy.ServeHTTP(w, r)
+
+	if proxyErr != nil {
+		return http.StatusBadGateway, proxyErr
+	}
+	return 0, nil
+}
+
+// baseURL returns the URL of the upstream host, using
+// scheme if the host doesn't include one.
+func baseURL(upstream, scheme string) string {
+	if strings.HasPrefix(upstream, "http") { // includes https
+		// destination includes a scheme! no need to guess
+		return upstream
+	}
+	return scheme + "://" + upstream
+}
+
+// isDialError returns whether err happened while connecting
+// to an upstream, in which case the request was not sent
+// and may be retried elsewhere.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
 // New creates a new instance of proxy middleware.
 func New(c middleware.Controller) (middleware.Middleware, error) {
 	rules, err := parse(c)
@@ -69,16 +122,59 @@ func parse(c middleware.Controller) ([]Rule, error) {
 	var rules []Rule
 
 	for c.Next() {
-		var rule Rule
-		if !c.Args(&rule.From, &rule.To) {
+		rule := Rule{next: new(uint32)}
+		if !c.NextArg() {
+			return rules, c.ArgErr()
+		}
+		rule.From = c.Val()
+
+		for _, host := range c.RemainingArgs() {
+			rule.Upstreams = append(rule.Upstreams, &Upstream{Host: host})
+		}
+		if len(rule.Upstreams) == 0 {
 			return rules, c.ArgErr()
 		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "health_check":
+				var path, interval string
+				if !c.Args(&path, &interval) {
+					return rules, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(interval)
+				if err != nil || dur <= 0 {
+					return rules, c.Err("Invalid health check interval '" + interval + "'")
+				}
+				rule.HealthCheck = &HealthCheck{Path: path, Interval: dur}
+			default:
+				return rules, c.Err("Expected valid proxy configuration property")
+			}
+		}
+
+		if rule.HealthCheck != nil {
+			hc, upstreams := rule.HealthCheck, rule.Upstreams
+			c.Startup(func() error {
+				hc.Start(upstreams)
+				return nil
+			})
+			c.Shutdown(func() error {
+				hc.Stop()
+				return nil
+			})
+		}
+
 		rules = append(rules, rule)
 	}
 
 	return rules, nil
 }
 
+// Rule proxies requests for paths matching From
+// to its Upstreams, taking turns among them.
 type Rule struct {
-	From, To string
+	From        string
+	Upstreams   []*Upstream
+	HealthCheck *HealthCheck // nil if upstreams are not checked
+	next        *uint32      // counts requests to pick the next upstream
 }
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeHTTPClientGone(t *testing.T) {
+	// An upstream that reads the request but never responds
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan struct{})
+	closed := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		if _, err := http.ReadRequest(br); err != nil {
+			return
+		}
+		close(received)
+		io.Copy(io.Discard, br) // until the proxy closes the connection
+		close(closed)
+	}()
+
+	p := Proxy{Rules: []Rule{{
+		From:      "/",
+		Upstreams: []*Upstream{{Host: listener.Addr().String()}},
+		next:      new(uint32),
+	}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := http.NewRequestWithContext(ctx, "GET", "/page", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request: %v", err)
+	}
+
+	returned := make(chan int)
+	go func() {
+		status, _ := p.ServeHTTP(httptest.NewRecorder(), r)
+		returned <- status
+	}()
+
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the upstream to get the request, but it didn't")
+	}
+	cancel()
+
+	select {
+	case status := <-returned:
+		if status != http.StatusBadGateway {
+			t.Errorf("Expected status %d when the client went away, got %d", http.StatusBadGateway, status)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected ServeHTTP to return when the client went away, but it didn't")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the connection to the upstream to be closed, but it wasn't")
+	}
+}
+
+func TestServeHTTPCounterWraps(t *testing.T) {
+	var hits [2]int
+	var upstreams []*Upstream
+	for i := range hits {
+		i := i
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+		}))
+		defer backend.Close()
+		upstreams = append(upstreams, &Upstream{Host: backend.URL})
+	}
+
+	// Past 2^31, where an int would be negative on 32-bit
+	// platforms, and then around to 0
+	next := uint32(math.MaxUint32 - 2)
+	p := Proxy{Rules: []Rule{{From: "/", Upstreams: upstreams, next: &next}}}
+
+	for i := 0; i < 4; i++ {
+		_, err := p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatalf("Request %d: Expected no error, got %v", i, err)
+		}
+	}
+	if hits[0] != 2 || hits[1] != 2 {
+		t.Errorf("Expected the upstreams to take turns, got %v requests each", hits)
+	}
+}
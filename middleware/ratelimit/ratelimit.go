@@ -0,0 +1,223 @@
+// Package ratelimit is middleware for limiting the rate of
+// requests from each client.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of rate limiting middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return RateLimit{Next: next, Rules: rules}
+	}, nil
+}
+
+// RateLimit is middleware that limits how many requests each
+// client may make in a period of time. Requests over the limit
+// get a response of 429 Too Many Requests with a Retry-After
+// header saying how many seconds to wait.
+type RateLimit struct {
+	Next  middleware.Handler
+	Rules []*Rule
+}
+
+// Rule allows each client Rate requests per Window to paths
+// under Path, using a token bucket: a client may make Rate
+// requests at once, and then one more each Window/Rate.
+//
+// Clients are told apart by the IP address of the connection,
+// unless it is one of TrustedProxies, in which case the client
+// is the last address in the X-Forwarded-For header which is
+// not a trusted proxy.
+type Rule struct {
+	Path           string
+	Rate           int
+	Window         time.Duration
+	TrustedProxies []*net.IPNet
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the tokens a client has left as of last.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (rl RateLimit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	i := middleware.LongestMatch(r.URL.Path, len(rl.Rules), func(i int) string { return rl.Rules[i].Path })
+	if i < 0 {
+		return rl.Next.ServeHTTP(w, r)
+	}
+	rule := rl.Rules[i]
+
+	if wait, ok := rule.take(rule.client(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return http.StatusTooManyRequests, nil
+	}
+
+	return rl.Next.ServeHTTP(w, r)
+}
+
+// client returns the IP address of the client making r.
+func (rule *Rule) client(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !rule.trusted(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break // can't trust anything before a malformed entry
+		}
+		ip = addr
+		if !rule.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted returns whether ip is one of rule's trusted proxies.
+func (rule *Rule) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range rule.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// take takes a token from the bucket of client at time now.
+// If there are none left, it returns false and how long
+// until there will be one.
+func (rule *Rule) take(client string, now time.Time) (time.Duration, bool) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	if rule.buckets == nil {
+		rule.buckets = make(map[string]*bucket)
+		rule.lastSweep = now
+	}
+	rule.sweep(now)
+
+	perToken := rule.Window / time.Duration(rule.Rate)
+
+	b, ok := rule.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Rate)}
+		rule.buckets[client] = b
+	} else {
+		b.tokens = math.Min(float64(rule.Rate), b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) * float64(perToken)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep evicts the buckets that have been refilled by now,
+// since they are the same as new buckets, so that memory does
+// not grow with every client ever seen. It does so at most
+// once per window. rule.mu must be locked.
+func (rule *Rule) sweep(now time.Time) {
+	if now.Sub(rule.lastSweep) < rule.Window {
+		return
+	}
+	for client, b := range rule.buckets {
+		if now.Sub(b.last) >= rule.Window {
+			delete(rule.buckets, client)
+		}
+	}
+	rule.lastSweep = now
+}
+
+// parse gets the rate limiting rules from the tokens of the
+// directive(s), which look like:
+//
+//	ratelimit [path] rate window {
+//		trusted_proxies cidr...
+//	}
+//
+// where the path defaults to "/" and window is a duration
+// like "1m".
+func parse(c middleware.Controller) ([]*Rule, error) {
+	var rules []*Rule
+
+	for c.Next() {
+		rule := &Rule{Path: "/"}
+		var rate, window string
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 2:
+			rate, window = args[0], args[1]
+		case 3:
+			rule.Path, rate, window = args[0], args[1], args[2]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		var err error
+		rule.Rate, err = strconv.Atoi(rate)
+		if err != nil || rule.Rate < 1 {
+			return rules, c.Err("Invalid rate '" + rate + "'; expected a positive number of requests")
+		}
+		rule.Window, err = time.ParseDuration(window)
+		if err != nil || rule.Window <= 0 {
+			return rules, c.Err("Invalid window '" + window + "'; expected a duration like 1m")
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "trusted_proxies":
+				cidrs := c.RemainingArgs()
+				if len(cidrs) == 0 {
+					return rules, c.ArgErr()
+				}
+				for _, cidr := range cidrs {
+					network, err := middleware.ParseNetwork(cidr)
+					if err != nil {
+						return rules, c.Err("Invalid trusted proxy '" + cidr + "'; expected an IP address or CIDR range")
+					}
+					rule.TrustedProxies = append(rule.TrustedProxies, network)
+				}
+			default:
+				return rules, c.Err("Expected valid ratelimit configuration property")
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
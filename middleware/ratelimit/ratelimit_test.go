@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectedPath   string
+		expectedRate   int
+		expectedWindow time.Duration
+		expectedTrust  int
+	}{
+		{"ratelimit 10 1m", false, "/", 10, time.Minute, 0},
+		{"ratelimit /api 5 1s", false, "/api", 5, time.Second, 0},
+		{"ratelimit 10 1m {\ntrusted_proxies 10.0.0.0/8 ::1\n}", false, "/", 10, time.Minute, 2},
+		{"ratelimit 10", true, "", 0, 0, 0},
+		{"ratelimit 0 1m", true, "", 0, 0, 0},
+		{"ratelimit 10 soon", true, "", 0, 0, 0},
+		{"ratelimit 10 1m {\ntrusted_proxies\n}", true, "", 0, 0, 0},
+		{"ratelimit 10 1m {\ntrusted_proxies nonsense\n}", true, "", 0, 0, 0},
+		{"ratelimit 10 1m {\nunknown\n}", true, "", 0, 0, 0},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if len(rules) != 1 {
+			t.Fatalf("Test %d: Expected 1 rule, got %d", i, len(rules))
+		}
+		rule := rules[0]
+		if rule.Path != test.expectedPath || rule.Rate != test.expectedRate || rule.Window != test.expectedWindow {
+			t.Errorf("Test %d: Expected %s %d %s, got %s %d %s", i,
+				test.expectedPath, test.expectedRate, test.expectedWindow, rule.Path, rule.Rate, rule.Window)
+		}
+		if len(rule.TrustedProxies) != test.expectedTrust {
+			t.Errorf("Test %d: Expected %d trusted proxies, got %d", i, test.expectedTrust, len(rule.TrustedProxies))
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	rl := RateLimit{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Rules: []*Rule{{Path: "/api", Rate: 2, Window: time.Hour}},
+	}
+
+	for i, test := range []struct {
+		path               string
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{"/api/a", http.StatusOK, ""},
+		{"/api/b", http.StatusOK, ""},
+		{"/api/c", http.StatusTooManyRequests, "1800"}, // half an hour for each of 2 tokens
+		{"/other", http.StatusOK, ""},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+
+		status, err := rl.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if actual := w.Header().Get("Retry-After"); actual != test.expectedRetryAfter {
+			t.Errorf("Test %d: Expected Retry-After %q, got %q", i, test.expectedRetryAfter, actual)
+		}
+	}
+}
+
+func TestTakeRefills(t *testing.T) {
+	rule := &Rule{Rate: 2, Window: time.Minute}
+	start := time.Unix(1000, 0)
+
+	for i, test := range []struct {
+		after        time.Duration
+		expectedOK   bool
+		expectedWait time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 30 * time.Second},
+		{10 * time.Second, false, 20 * time.Second},
+		{30 * time.Second, true, 0},
+		{30 * time.Second, false, 30 * time.Second},
+		{2 * time.Minute, true, 0}, // full again, but no more than Rate
+		{2 * time.Minute, true, 0},
+		{2 * time.Minute, false, 30 * time.Second},
+	} {
+		wait, ok := rule.take("client", start.Add(test.after))
+		if ok != test.expectedOK || wait != test.expectedWait {
+			t.Errorf("Test %d: Expected %v and a wait of %s, got %v and %s", i, test.expectedOK, test.expectedWait, ok, wait)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	rule := &Rule{Rate: 1, Window: time.Minute}
+	start := time.Unix(1000, 0)
+
+	rule.take("early", start)
+	rule.take("late", start.Add(30*time.Second))
+	if len(rule.buckets) != 2 {
+		t.Fatalf("Expected 2 buckets, got %d", len(rule.buckets))
+	}
+
+	// A window after the first, only its bucket is full again
+	rule.take("new", start.Add(time.Minute))
+	if _, ok := rule.buckets["early"]; ok {
+		t.Error("Expected the refilled bucket to be evicted, but it wasn't")
+	}
+	if _, ok := rule.buckets["late"]; !ok {
+		t.Error("Expected the bucket still refilling to be kept, but it wasn't")
+	}
+
+	// A sweep happens at most once per window
+	rule.take("other", start.Add(time.Minute+40*time.Second))
+	if _, ok := rule.buckets["late"]; !ok {
+		t.Error("Expected no sweep within a window of the last one, but the bucket was evicted")
+	}
+}
+
+func TestClient(t *testing.T) {
+	trusted, err := middleware.ParseNetwork("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := &Rule{TrustedProxies: []*net.IPNet{trusted}}
+
+	for i, test := range []struct {
+		remoteAddr     string
+		forwardedFor   string
+		expectedClient string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.7", "192.0.2.1"}, // not from a trusted proxy
+		{"10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"10.0.0.1:1234", "198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"10.0.0.1:1234", "203.0.113.9, 198.51.100.7", "198.51.100.7"}, // the first can be spoofed
+		{"10.0.0.1:1234", "198.51.100.7, bogus", "10.0.0.1"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if actual := rule.client(r); actual != test.expectedClient {
+			t.Errorf("Test %d: Expected client %s, got %s", i, test.expectedClient, actual)
+		}
+	}
+}
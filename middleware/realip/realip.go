@@ -0,0 +1,109 @@
+// Package realip is middleware that sets the remote address
+// of requests to that of the client, as told by a trusted proxy
+// (such as a load balancer) in front of the server.
+package realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of realip middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	trusted, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return RealIP{Next: next, Trusted: trusted}
+	}, nil
+}
+
+// RealIP is middleware that replaces the IP address in the
+// RemoteAddr of requests from Trusted proxies with that of
+// the client they forwarded it for: the last address in the
+// X-Forwarded-For header that isn't of a trusted proxy too,
+// or else the X-Real-IP header. The port is left as it is.
+// The headers of requests from other peers are ignored, since
+// anyone could send them.
+type RealIP struct {
+	Next    middleware.Handler
+	Trusted []*net.IPNet
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (rip RealIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !rip.trusts(net.ParseIP(host)) {
+		return rip.Next.ServeHTTP(w, r)
+	}
+
+	if client := rip.clientIP(r); client != nil {
+		r.RemoteAddr = net.JoinHostPort(client.String(), port)
+	}
+	return rip.Next.ServeHTTP(w, r)
+}
+
+// clientIP returns the address of the client that the
+// trusted proxy which sent r forwarded it for, or nil
+// if the headers don't have a valid one.
+func (rip RealIP) clientIP(r *http.Request) net.IP {
+	// Each proxy appends the address it got the request
+	// from, so the ones before the last proxy we trust
+	// may have been made up by the client
+	var forwarded []string
+	for _, header := range r.Header["X-Forwarded-For"] {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			return nil
+		}
+		if i == 0 || !rip.trusts(ip) {
+			return ip
+		}
+	}
+
+	return net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+}
+
+// trusts returns whether ip is of a trusted proxy.
+func (rip RealIP) trusts(ip net.IP) bool {
+	for _, network := range rip.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse gets the trusted networks from the tokens of the
+// directive(s). Each is a CIDR, like 10.0.0.0/8, or a
+// single IP address:
+//
+//	realip cidr...
+func parse(c middleware.Controller) ([]*net.IPNet, error) {
+	var trusted []*net.IPNet
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return trusted, c.ArgErr()
+		}
+
+		for _, arg := range args {
+			network, err := middleware.ParseNetwork(arg)
+			if err != nil {
+				return trusted, c.Err("Invalid trusted proxy '" + arg + "'; expected an IP address or CIDR")
+			}
+			trusted = append(trusted, network)
+		}
+	}
+
+	return trusted, nil
+}
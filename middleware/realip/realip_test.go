@@ -0,0 +1,92 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input           string
+		shouldErr       bool
+		expectedTrusted []string
+	}{
+		{"realip 10.0.0.0/8", false, []string{"10.0.0.0/8"}},
+		{"realip 192.0.2.1 ::1\nrealip 172.16.0.0/12", false, []string{"192.0.2.1/32", "::1/128", "172.16.0.0/12"}},
+		{"realip", true, nil},
+		{"realip nonsense", true, nil},
+		{"realip 10.0.0.0/33", true, nil},
+	} {
+		trusted, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if len(trusted) != len(test.expectedTrusted) {
+			t.Fatalf("Test %d: Expected %d networks, got %v", i, len(test.expectedTrusted), trusted)
+		}
+		for j, network := range trusted {
+			if network.String() != test.expectedTrusted[j] {
+				t.Errorf("Test %d: Expected network %d to be %s, got %s", i, j, test.expectedTrusted[j], network)
+			}
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	trusted, err := parse(middlewaretest.NewController("realip 10.0.0.0/8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remoteAddr string
+	rip := RealIP{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			remoteAddr = r.RemoteAddr
+			return http.StatusOK, nil
+		}),
+		Trusted: trusted,
+	}
+
+	for i, test := range []struct {
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expected     string
+	}{
+		{"192.0.2.1:1234", "198.51.100.7", "", "192.0.2.1:1234"}, // not a trusted proxy
+		{"10.0.0.1:1234", "198.51.100.7", "", "198.51.100.7:1234"},
+		{"10.0.0.1:1234", "203.0.113.9, 198.51.100.7, 10.0.0.2", "", "198.51.100.7:1234"},
+		{"10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "", "10.0.0.3:1234"},
+		{"10.0.0.1:1234", "bogus, 10.0.0.2", "", "10.0.0.1:1234"},
+		{"10.0.0.1:1234", "", "198.51.100.7", "198.51.100.7:1234"},
+		{"10.0.0.1:1234", "", "", "10.0.0.1:1234"},
+		{"10.0.0.1:1234", "2001:db8::1", "", "[2001:db8::1]:1234"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		_, err := rip.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if remoteAddr != test.expected {
+			t.Errorf("Test %d: Expected remote address %s, got %s", i, test.expected, remoteAddr)
+		}
+	}
+}
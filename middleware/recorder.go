@@ -48,3 +48,11 @@ func (r *responseRecorder) Write(buf []byte) (int, error) {
 	}
 	return n, err
 }
+
+// Flush implements http.Flusher, if the underlying
+// ResponseWriter does, for streamed responses.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
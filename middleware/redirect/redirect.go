@@ -4,6 +4,7 @@ package redirect
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy/middleware"
@@ -32,17 +33,28 @@ func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	for _, rule := range rd.Rules {
 		if rule.From == "/" {
 			// Catchall redirect preserves path (TODO: Standardize/formalize this behavior)
-			http.Redirect(w, r, strings.TrimSuffix(rule.To, "/")+r.URL.Path, rule.Code)
+			to := middleware.NewReplacer(r, nil, "").Replace(rule.To)
+			http.Redirect(w, r, withQuery(strings.TrimSuffix(to, "/")+r.URL.Path, r), rule.Code)
 			return 0, nil
 		}
 		if r.URL.Path == rule.From {
-			http.Redirect(w, r, rule.To, rule.Code)
+			to := middleware.NewReplacer(r, nil, "").Replace(rule.To)
+			http.Redirect(w, r, withQuery(to, r), rule.Code)
 			return 0, nil
 		}
 	}
 	return rd.Next.ServeHTTP(w, r)
 }
 
+// withQuery appends the query string of r to the redirect
+// target to, unless to already has a query string.
+func withQuery(to string, r *http.Request) string {
+	if r.URL.RawQuery == "" || strings.Contains(to, "?") {
+		return to
+	}
+	return to + "?" + r.URL.RawQuery
+}
+
 func parse(c middleware.Controller) ([]Rule, error) {
 	var redirects []Rule
 
@@ -55,15 +67,19 @@ func parse(c middleware.Controller) ([]Rule, error) {
 			// To specified
 			rule.From = "/"
 			rule.To = args[0]
-			rule.Code = http.StatusMovedPermanently
+			rule.Code = http.StatusFound
 		case 2:
-			// To and Code specified
-			rule.From = "/"
-			rule.To = args[0]
-			if code, ok := httpRedirs[args[1]]; !ok {
+			// To and Code specified, or From and To specified
+			if code, ok := httpRedirs[args[1]]; ok {
+				rule.From = "/"
+				rule.To = args[0]
+				rule.Code = code
+			} else if _, err := strconv.Atoi(args[1]); err == nil {
 				return redirects, c.Err("Invalid redirect code '" + args[1] + "'")
 			} else {
-				rule.Code = code
+				rule.From = args[0]
+				rule.To = args[1]
+				rule.Code = http.StatusFound
 			}
 		case 3:
 			// From, To, and Code specified
@@ -88,7 +104,11 @@ func parse(c middleware.Controller) ([]Rule, error) {
 	return redirects, nil
 }
 
-// Rule describes an HTTP redirect rule.
+// Rule describes an HTTP redirect rule. To may contain
+// placeholders (see middleware.NewReplacer) such as
+// {hostname} and {uri}, so a catch-all
+// rule can redirect a whole site to HTTPS with the target
+// "https://{hostname}".
 type Rule struct {
 	From, To string
 	Code     int
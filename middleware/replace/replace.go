@@ -0,0 +1,271 @@
+// Package replace is middleware that replaces strings in the
+// bodies of text responses, such as the host of a backend in
+// the links of the pages proxied from it.
+package replace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of replace middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Replace{Next: next, Rules: rules}
+	}, nil
+}
+
+// Replace is middleware that replaces strings in the bodies
+// of responses to requests under the path of a rule. Only
+// successful (200) responses with a text content type (text/*,
+// JSON, JavaScript or XML) are changed, and not those with a
+// Content-Encoding, which would be corrupted by it. So that
+// backends send them uncompressed, requests are passed on
+// without their Accept-Encoding header; the gzip middleware
+// still compresses the responses for clients that accept it.
+// Since a string may be split between writes, the responses
+// are buffered in full and sent once they are complete, with
+// a new Content-Length and without the ETag of the original.
+type Replace struct {
+	Next  middleware.Handler
+	Rules []Rule
+}
+
+// Rule is the strings to replace in responses for requests
+// under Path: pairs of a string and its replacement, in the
+// order of strings.NewReplacer.
+type Rule struct {
+	Path  string
+	Pairs []string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (rep Replace) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	i := middleware.LongestMatch(r.URL.Path, len(rep.Rules), func(i int) string { return rep.Rules[i].Path })
+	if i < 0 {
+		return rep.Next.ServeHTTP(w, r)
+	}
+	rule := rep.Rules[i]
+
+	if r.Header.Get("Accept-Encoding") != "" {
+		plain := new(http.Request)
+		*plain = *r
+		plain.Header = r.Header.Clone()
+		plain.Header.Del("Accept-Encoding")
+		r = plain
+	}
+
+	rw := &replaceWriter{ResponseWriter: w, replacer: strings.NewReplacer(rule.Pairs...)}
+	status, err := rep.Next.ServeHTTP(rw, r)
+	rw.finish()
+	return status, err
+}
+
+// replaceWriter is a ResponseWriter that holds back the
+// status until the first write, when it knows the content
+// type, and then either passes the response on as it is or
+// buffers the body to replace strings in it.
+type replaceWriter struct {
+	http.ResponseWriter
+	replacer  *strings.Replacer
+	status    int  // the status written, if it hasn't been passed on yet
+	decided   bool // whether the response is being passed on or buffered
+	buffering bool
+	buf       bytes.Buffer
+}
+
+// WriteHeader holds on to the status code until the
+// first write. Informational (1xx) ones are passed on.
+func (w *replaceWriter) WriteHeader(status int) {
+	if status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if !w.decided && w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write buffers the body if its strings are to be replaced,
+// and otherwise writes it.
+func (w *replaceWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decide(b)
+	}
+	if w.buffering {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, if the underlying
+// ResponseWriter does, for responses that are passed on;
+// those being buffered are only sent once complete.
+func (w *replaceWriter) Flush() {
+	if !w.decided || w.buffering {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker so that WebSocket
+// connections still work beneath this middleware.
+func (w *replaceWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("ResponseWriter does not implement http.Hijacker")
+}
+
+// decide decides, given the first bytes of the body, whether
+// to buffer the response, and if not, writes its status.
+func (w *replaceWriter) decide(b []byte) {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.Header().Get("Content-Type") == "" && w.Header().Get("Content-Encoding") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(b)) // as net/http would
+	}
+
+	w.buffering = w.replaceable()
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// replaceable returns whether the strings of the body of
+// the response are to be replaced, by its status and header.
+func (w *replaceWriter) replaceable() bool {
+	if w.status != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml":
+		return true
+	}
+	return false
+}
+
+// finish writes the response once the handlers are done
+// with it: the buffered body with its strings replaced, or
+// the status if nothing was written. The Content-Length and
+// ETag of a response without a body (as to a HEAD request)
+// are removed if its body would have been changed.
+func (w *replaceWriter) finish() {
+	if !w.decided {
+		if w.status != 0 {
+			if w.replaceable() {
+				w.Header().Del("Content-Length")
+				w.Header().Del("ETag")
+			}
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	if !w.buffering {
+		return
+	}
+
+	body := w.replacer.Replace(w.buf.String())
+	w.Header().Del("ETag")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	io.WriteString(w.ResponseWriter, body)
+}
+
+// parse gets the rules from the tokens of the directive(s).
+// Each is a path, which defaults to "/", and a string and
+// its replacement, or a block of them to replace many:
+//
+//	replace [path] string replacement
+//
+//	replace [path] {
+//		string replacement
+//		...
+//	}
+//
+// Two arguments are always a string and its replacement, so
+// "replace /api foo" replaces "/api" with "foo" in responses
+// for any path; a path with a single pair needs all three
+// arguments. Rules for the same path are combined.
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		rule := Rule{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			rule.Path = args[0]
+		case 2:
+			rule.Pairs = args
+		case 3:
+			rule.Path, rule.Pairs = args[0], args[1:]
+		default:
+			return rules, c.ArgErr()
+		}
+
+		if rule.Pairs == nil {
+			for c.NextBlock() {
+				from := c.Val()
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				rule.Pairs = append(rule.Pairs, from, c.Val())
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			}
+			if rule.Pairs == nil {
+				return rules, c.ArgErr()
+			}
+		}
+		for i := 0; i < len(rule.Pairs); i += 2 {
+			if rule.Pairs[i] == "" {
+				return rules, c.Err("The string to replace can't be empty")
+			}
+		}
+
+		merged := false
+		for i := range rules {
+			if rules[i].Path == rule.Path {
+				rules[i].Pairs = append(rules[i].Pairs, rule.Pairs...)
+				merged = true
+			}
+		}
+		if !merged {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
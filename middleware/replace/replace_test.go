@@ -0,0 +1,163 @@
+package replace
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"replace a b", false, []Rule{{Path: "/", Pairs: []string{"a", "b"}}}},
+		{"replace /api a b", false, []Rule{{Path: "/api", Pairs: []string{"a", "b"}}}},
+		// Two arguments are a pair, not a path and a string
+		{"replace /api foo", false, []Rule{{Path: "/", Pairs: []string{"/api", "foo"}}}},
+		{"replace /api {\na b\nc d\n}", false, []Rule{{Path: "/api", Pairs: []string{"a", "b", "c", "d"}}}},
+		{"replace a b\nreplace c d", false, []Rule{{Path: "/", Pairs: []string{"a", "b", "c", "d"}}}},
+		{"replace", true, nil},
+		{"replace /api", true, nil},
+		{"replace /api {\na\n}", true, nil},
+		{"replace /api {\na b c\n}", true, nil},
+		{`replace "" b`, true, nil},
+		{"replace /api a b c", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	for i, test := range []struct {
+		method          string
+		path            string
+		next            func(w http.ResponseWriter) int
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string // "" for a header that must be missing
+	}{
+		// Replaced, with a new Content-Length and no ETag
+		{"GET", "/page", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "25")
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, "Visit http://backend:8080")
+			return http.StatusOK
+		}, http.StatusOK, "Visit https://www.example.com", map[string]string{
+			"Content-Length": "29",
+			"ETag":           "",
+		}},
+		// A string split between writes
+		{"GET", "/page", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"url": "http://back`)
+			io.WriteString(w, `end:8080/a"}`)
+			return http.StatusOK
+		}, http.StatusOK, `{"url": "https://www.example.com/a"}`, nil},
+		// The content type is detected if not set
+		{"GET", "/page", func(w http.ResponseWriter) int {
+			io.WriteString(w, "<html>http://backend:8080</html>")
+			return http.StatusOK
+		}, http.StatusOK, "<html>https://www.example.com</html>", map[string]string{
+			"Content-Type": "text/html; charset=utf-8",
+		}},
+		// Not text
+		{"GET", "/image.png", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, "http://backend:8080")
+			return http.StatusOK
+		}, http.StatusOK, "http://backend:8080", map[string]string{
+			"ETag": `"abc"`,
+		}},
+		// Not a 200 response
+		{"GET", "/missing", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "http://backend:8080")
+			return http.StatusNotFound
+		}, http.StatusNotFound, "http://backend:8080", nil},
+		// Compressed
+		{"GET", "/page", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Encoding", "gzip")
+			io.WriteString(w, "http://backend:8080")
+			return http.StatusOK
+		}, http.StatusOK, "http://backend:8080", nil},
+		// A HEAD request, whose Content-Length would be wrong
+		{"HEAD", "/page", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "24")
+			w.Header().Set("ETag", `"abc"`)
+			w.WriteHeader(http.StatusOK)
+			return http.StatusOK
+		}, http.StatusOK, "", map[string]string{
+			"Content-Length": "",
+			"ETag":           "",
+		}},
+		// A HEAD request for a body that wouldn't be changed
+		{"HEAD", "/image.png", func(w http.ResponseWriter) int {
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Content-Length", "24")
+			w.WriteHeader(http.StatusOK)
+			return http.StatusOK
+		}, http.StatusOK, "", map[string]string{
+			"Content-Length": "24",
+		}},
+	} {
+		var acceptEncoding string
+		rep := Replace{
+			Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				return test.next(w), nil
+			}),
+			Rules: []Rule{{Path: "/", Pairs: []string{"http://backend:8080", "https://www.example.com"}}},
+		}
+
+		r := httptest.NewRequest(test.method, test.path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		_, err := rep.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if acceptEncoding != "" {
+			t.Errorf("Test %d: Expected the request to be passed on without Accept-Encoding, got %q", i, acceptEncoding)
+		}
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Test %d: Expected the original request to keep its Accept-Encoding", i)
+		}
+		if w.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, w.Code)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		for name, expected := range test.expectedHeaders {
+			if actual := w.Header().Get(name); actual != expected {
+				t.Errorf("Test %d: Expected %s header %q, got %q", i, name, expected, actual)
+			}
+		}
+	}
+}
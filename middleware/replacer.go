@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"bytes"
 	"net"
 	"net/http"
 	"strconv"
@@ -12,14 +13,43 @@ import (
 // substrings in a string with actual values from a
 // http.Request and responseRecorder. Always use
 // NewReplacer to get one of these.
-type replacer map[string]string
+type replacer struct {
+	values     map[string]string
+	headers    http.Header
+	emptyValue string // what placeholders with no value are replaced with
+}
 
 // NewReplacer makes a new replacer based on r and rr.
 // Do not create a new replacer until r and rr have all
 // the needed values, because this function copies those
-// values into the replacer.
-func NewReplacer(r *http.Request, rr *responseRecorder) replacer {
-	rep := replacer{
+// values into the replacer. If rr is nil, only the
+// placeholders about the request are available. Those
+// with no value, such as {query} without a query string,
+// are replaced with emptyValue; the log uses "-", like
+// the Common Log Format. Middleware that take placeholders
+// in their arguments all use these:
+//
+//	{method}    the request method, e.g. GET
+//	{scheme}    http or https
+//	{host}      the Host header, with the port if there is one
+//	{hostname}  the host, without the port
+//	{path}      the path of the URL
+//	{query}     the query string, without the "?"
+//	{fragment}  the fragment of the URL, without the "#"
+//	{uri}       the request URI: the path and query string
+//	{proto}     the protocol, e.g. HTTP/1.1
+//	{remote}    the IP address of the client
+//	{port}      the port of the client
+//	{when}      the time, e.g. 02/Jan/2006:15:04:05 -0700
+//	{>Name}     the value of the request header Name, in any case
+//
+// and, with rr, about the response:
+//
+//	{status}    the status code
+//	{size}      the number of bytes in the body
+//	{latency}   how long the response took, e.g. 1.5ms
+func NewReplacer(r *http.Request, rr *responseRecorder, emptyValue string) replacer {
+	values := map[string]string{
 		"{method}": r.Method,
 		"{scheme}": func() string {
 			if r.TLS != nil {
@@ -32,6 +62,13 @@ func NewReplacer(r *http.Request, rr *responseRecorder) replacer {
 		"{query}":    r.URL.RawQuery,
 		"{fragment}": r.URL.Fragment,
 		"{proto}":    r.Proto,
+		"{hostname}": func() string {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				return r.Host
+			}
+			return host
+		}(),
 		"{remote}": func() string {
 			host, _, err := net.SplitHostPort(r.RemoteAddr)
 			if err != nil {
@@ -50,41 +87,57 @@ func NewReplacer(r *http.Request, rr *responseRecorder) replacer {
 		"{when}": func() string {
 			return time.Now().Format(timeFormat)
 		}(),
-		"{status}":  strconv.Itoa(rr.status),
-		"{size}":    strconv.Itoa(rr.size),
-		"{latency}": time.Since(rr.start).String(),
 	}
 
-	// Header placeholders
-	for header, val := range r.Header {
-		rep[headerReplacer+header+"}"] = strings.Join(val, ",")
+	// Response placeholders
+	if rr != nil {
+		values["{status}"] = strconv.Itoa(rr.status)
+		values["{size}"] = strconv.Itoa(rr.size)
+		values["{latency}"] = time.Since(rr.start).String()
 	}
 
-	return rep
+	return replacer{values: values, headers: r.Header, emptyValue: emptyValue}
 }
 
 // Replace performs a replacement of values on s and returns
-// the string with the replaced values.
+// the string with the replaced values. The values put in are
+// not replaced again, so a request can't add placeholders
+// (e.g. in its path) to what it is replaced into. Text in
+// braces that isn't a placeholder is left as it is.
 func (r replacer) Replace(s string) string {
-	for placeholder, replacement := range r {
-		if replacement == "" {
-			replacement = EmptyStringReplacer
+	var buf bytes.Buffer
+	for {
+		start := strings.Index(s, "{")
+		if start < 0 {
+			break
 		}
-		s = strings.Replace(s, placeholder, replacement, -1)
-	}
-
-	// Replace any header placeholders that weren't found
-	for strings.Contains(s, headerReplacer) {
-		idxStart := strings.Index(s, headerReplacer)
-		endOffset := idxStart + len(headerReplacer)
-		idxEnd := strings.Index(s[endOffset:], "}")
-		if idxEnd > -1 {
-			s = s[:idxStart] + EmptyStringReplacer + s[endOffset+idxEnd+1:]
-		} else {
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
 			break
 		}
+		placeholder := s[start : start+end+1]
+
+		value, ok := r.values[placeholder]
+		if !ok && strings.HasPrefix(placeholder, headerReplacer) {
+			name := placeholder[len(headerReplacer) : len(placeholder)-1]
+			value, ok = strings.Join(r.headers[http.CanonicalHeaderKey(name)], ","), true
+		}
+		if !ok {
+			// Not a placeholder; look for one after the brace
+			buf.WriteString(s[:start+1])
+			s = s[start+1:]
+			continue
+		}
+
+		if value == "" {
+			value = r.emptyValue
+		}
+		buf.WriteString(s[:start])
+		buf.WriteString(value)
+		s = s[start+end+1:]
 	}
-	return s
+	buf.WriteString(s)
+	return buf.String()
 }
 
 const (
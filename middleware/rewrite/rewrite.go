@@ -4,6 +4,9 @@ package rewrite
 
 import (
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -26,11 +29,27 @@ type Rewrite struct {
 	Rules []RewriteRule
 }
 
-// ServeHTTP implements the middleware.Handler interface.
+// ServeHTTP implements the middleware.Handler interface. At most
+// one rule is applied to each request, and the rewritten location
+// is not matched against the rules again, so rewrites can't loop.
 func (rw Rewrite) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	// Placeholders are replaced along with the capture groups,
+	// so that a request can't add any in its path
+	replace := func(to string) string {
+		return middleware.NewReplacer(r, nil, "").Replace(to)
+	}
 	for _, rule := range rw.Rules {
-		if r.URL.Path == rule.From {
-			r.URL.Path = rule.To
+		if to, ok := rule.rewrite(r.URL.Path, replace); ok {
+
+			// The new location may have its own query string
+			if i := strings.Index(to, "?"); i > -1 {
+				query := to[i+1:]
+				if r.URL.RawQuery != "" {
+					query += "&" + r.URL.RawQuery
+				}
+				to, r.URL.RawQuery = to[:i], query
+			}
+			r.URL.Path = to
 			break
 		}
 	}
@@ -53,6 +72,15 @@ func parse(c middleware.Controller) ([]RewriteRule, error) {
 		}
 		rule.To = c.Val()
 
+		// A pattern anchored at the start is a regular expression
+		if strings.HasPrefix(rule.From, "^") {
+			re, err := regexp.Compile(rule.From)
+			if err != nil {
+				return rewrites, c.Err("Invalid regular expression '" + rule.From + "': " + err.Error())
+			}
+			rule.regexp = re
+		}
+
 		rewrites = append(rewrites, rule)
 	}
 
@@ -60,6 +88,54 @@ func parse(c middleware.Controller) ([]RewriteRule, error) {
 }
 
 // RewriteRule describes an internal location rewrite rule.
+// If From begins with "^", it is a regular expression and
+// To may refer to its capture groups as {1}, {2}, etc. To
+// may also have placeholders (see middleware.NewReplacer).
 type RewriteRule struct {
 	From, To string
+	regexp   *regexp.Regexp
 }
+
+// Rewrite returns the location that path is rewritten to
+// and true if the rule matches path; otherwise it returns
+// false.
+func (rule RewriteRule) Rewrite(path string) (string, bool) {
+	return rule.rewrite(path, nil)
+}
+
+// rewrite is like Rewrite, but if replace isn't nil, it is
+// applied to the placeholders of To other than those of the
+// capture groups.
+func (rule RewriteRule) rewrite(path string, replace func(string) string) (string, bool) {
+	var groups []string
+	if rule.regexp == nil {
+		if path != rule.From {
+			return "", false
+		}
+	} else {
+		groups = rule.regexp.FindStringSubmatch(path)
+		if groups == nil {
+			return "", false
+		}
+	}
+
+	// Both kinds of placeholders are put in with one scan of To,
+	// so that neither is looked for in the values of the other
+	to := placeholder.ReplaceAllStringFunc(rule.To, func(p string) string {
+		if i, err := strconv.Atoi(p[1 : len(p)-1]); err == nil {
+			if i < len(groups) {
+				return groups[i]
+			}
+			return p
+		}
+		if replace != nil {
+			return replace(p)
+		}
+		return p
+	})
+	return to, true
+}
+
+// placeholder matches placeholders, like {1} for a
+// capture group or {path}.
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
@@ -0,0 +1,58 @@
+package rewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestRewrite(t *testing.T) {
+	rw := Rewrite{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			location := r.URL.Path
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+			w.Write([]byte(location))
+			return http.StatusOK, nil
+		}),
+		Rules: []RewriteRule{
+			{From: "/from", To: "/to?host={hostname}"},
+			{From: "^/a/(.*)$", To: "/b/{1}?host={hostname}", regexp: regexp.MustCompile("^/a/(.*)$")},
+			{From: "^/c/(.*)/(.*)$", To: "/d/{2}/{1}", regexp: regexp.MustCompile("^/c/(.*)/(.*)$")},
+			{From: "^/e/(.*)$", To: "/f/{1}?from={path}", regexp: regexp.MustCompile("^/e/(.*)$")},
+		},
+	}
+
+	for i, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/from", "/to?host=example.com"},
+		{"/other", "/other"},
+		{"/a/page", "/b/page?host=example.com"},
+		// Placeholders in the path must not be replaced
+		{"/a/{host}", "/b/{host}?host=example.com"},
+		{"/a/{>X-Secret}", "/b/{>X-Secret}?host=example.com"},
+		// Nor capture groups in another capture group
+		{"/c/{2}/x", "/d/x/{2}"},
+		// Nor capture groups in the placeholders
+		{"/e/a{1}", "/f/a{1}?from=/e/a{1}"},
+	} {
+		r, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Unable to create request: %v", i, err)
+		}
+		r.Host = "example.com"
+		r.Header.Set("X-Secret", "secret")
+		w := httptest.NewRecorder()
+
+		rw.ServeHTTP(w, r)
+		if actual := w.Body.String(); actual != test.expected {
+			t.Errorf("Test %d: Expected %s to be rewritten to %s, got %s", i, test.path, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the multipliers of the units that
+// ParseSize accepts.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size like "10MB" into bytes. The unit
+// may be KB, MB, or GB (in powers of 1024) or B, in any case;
+// a number without a unit is also in bytes.
+func ParseSize(s string) (int64, error) {
+	number, multiplier := s, int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(s), unit.suffix) {
+			number, multiplier = s[:len(s)-len(unit.suffix)], unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("Invalid size '" + s + "'; expected a number of bytes with an optional unit of KB, MB, or GB")
+	}
+	if n > (1<<63-1)/multiplier {
+		return 0, errors.New("Size '" + s + "' is too large")
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,102 @@
+// Package status is middleware that responds to requests for
+// certain paths with a fixed status code and text, such as for
+// the health checks of a load balancer.
+package status
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of status middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	rules, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return Status{Next: next, Rules: rules}
+	}, nil
+}
+
+// Status is middleware that responds to requests for the path
+// of a rule with its code and text, as plain text, without
+// passing them on, so that they get the same response whatever
+// is (or isn't) in the site's root.
+type Status struct {
+	Next  middleware.Handler
+	Rules []Rule
+}
+
+// Rule is the response to requests for exactly Path.
+type Rule struct {
+	Path string
+	Code int
+	Text string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (s Status) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range s.Rules {
+		if r.URL.Path != rule.Path {
+			continue
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		if !bodyAllowed(rule.Code) {
+			w.WriteHeader(rule.Code)
+			return rule.Code, nil
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(rule.Text)))
+		w.WriteHeader(rule.Code)
+		io.WriteString(w, rule.Text)
+
+		if rule.Code >= 400 {
+			return 0, nil // the response is written, so no error page
+		}
+		return rule.Code, nil
+	}
+
+	return s.Next.ServeHTTP(w, r)
+}
+
+// bodyAllowed returns whether a response with code
+// may have a body.
+func bodyAllowed(code int) bool {
+	return code != http.StatusNoContent && code != http.StatusNotModified
+}
+
+// parse gets the rules from the tokens of the directive(s).
+// Each is a status code from 200 to 599, the path to respond
+// at, and the text to respond with, which defaults to that
+// of the code (like "OK"):
+//
+//	status code path [text]
+func parse(c middleware.Controller) ([]Rule, error) {
+	var rules []Rule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 2 || len(args) > 3 {
+			return rules, c.ArgErr()
+		}
+
+		code, err := strconv.Atoi(args[0])
+		if err != nil || code < 200 || code > 599 {
+			return rules, c.Err("Invalid status code '" + args[0] + "'; expected a number from 200 to 599")
+		}
+		rule := Rule{Path: args[1], Code: code, Text: http.StatusText(code)}
+		if len(args) == 3 {
+			rule.Text = args[2]
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,83 @@
+package status
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []Rule
+	}{
+		{"status 200 /health", false, []Rule{{Path: "/health", Code: 200, Text: "OK"}}},
+		{"status 503 /ready \"Not ready\"\nstatus 204 /ping", false,
+			[]Rule{{Path: "/ready", Code: 503, Text: "Not ready"}, {Path: "/ping", Code: 204, Text: "No Content"}}},
+		{"status 200", true, nil},
+		{"status 200 /health OK extra", true, nil},
+		{"status ok /health", true, nil},
+		{"status 199 /health", true, nil},
+		{"status 600 /health", true, nil},
+	} {
+		rules, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := Status{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusNotFound, nil
+		}),
+		Rules: []Rule{
+			{Path: "/health", Code: 200, Text: "OK"},
+			{Path: "/ready", Code: 503, Text: "Not ready"},
+			{Path: "/ping", Code: 204, Text: "No Content"},
+		},
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedCode   int
+		expectedBody   string
+	}{
+		{"/health", http.StatusOK, http.StatusOK, "OK"},
+		{"/ready", 0, http.StatusServiceUnavailable, "Not ready"},
+		{"/ping", http.StatusNoContent, http.StatusNoContent, ""},
+		{"/health/more", http.StatusNotFound, http.StatusOK, ""}, // only the exact path
+	} {
+		w := httptest.NewRecorder()
+		status, err := s.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if w.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected response status %d, got %d", i, test.expectedCode, w.Code)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"bufio"
+	"net/http"
+)
+
+// StreamWriter writes a response body to a ResponseWriter
+// in chunks as it is generated, instead of all at once when
+// it is done: it buffers up to a chunk of the body, then
+// writes and flushes it to the client, so the memory used
+// doesn't grow with the size of the body. Until the first
+// chunk is written, nothing has been sent, so the response
+// can still be replaced, such as by an error page.
+type StreamWriter struct {
+	buf     *bufio.Writer
+	flusher *responseFlusher
+}
+
+// NewStreamWriter returns a StreamWriter that writes to w
+// in chunks of size bytes.
+func NewStreamWriter(w http.ResponseWriter, size int) *StreamWriter {
+	f := &responseFlusher{ResponseWriter: w}
+	return &StreamWriter{buf: bufio.NewWriterSize(f, size), flusher: f}
+}
+
+// Write adds p to the body, writing the buffered chunk
+// to the client whenever it is full.
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+// Flush writes the rest of the body that is buffered
+// to the client. It must be called when the body is done.
+func (s *StreamWriter) Flush() error {
+	return s.buf.Flush()
+}
+
+// Started returns whether any of the body has been
+// written to the client, after which its status and
+// headers can't be changed.
+func (s *StreamWriter) Started() bool {
+	return s.flusher.started
+}
+
+// responseFlusher is a ResponseWriter that flushes each
+// write to the client, if it can.
+type responseFlusher struct {
+	http.ResponseWriter
+	started bool
+}
+
+// Write writes p to the client and flushes it.
+func (f *responseFlusher) Write(p []byte) (int, error) {
+	f.started = true
+	n, err := f.ResponseWriter.Write(p)
+	if flusher, ok := f.ResponseWriter.(http.Flusher); ok && err == nil {
+		flusher.Flush()
+	}
+	return n, err
+}
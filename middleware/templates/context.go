@@ -1,6 +1,7 @@
 package templates
 
 import (
+	"html/template"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -20,14 +21,16 @@ type context struct {
 	URL  *url.URL
 }
 
-// Include returns the contents of filename relative to the site root
-func (c context) Include(filename string) (string, error) {
+// Include returns the contents of filename relative to the site root.
+// The contents are trusted, so they are not escaped.
+func (c context) Include(filename string) (template.HTML, error) {
 	file, err := c.root.Open(filename)
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
 	body, err := ioutil.ReadAll(file)
-	return string(body), err
+	return template.HTML(body), err
 }
 
 // Date returns the current timestamp in the specified format
@@ -2,10 +2,10 @@
 package templates
 
 import (
-	"bytes"
+	"html/template"
 	"net/http"
+	"os"
 	"path"
-	"text/template"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -43,20 +43,27 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 				ctx := context{root: http.Dir(t.Root), req: r, URL: r.URL}
 
 				// Build the template
-				tpl, err := template.ParseFiles(t.Root + r.URL.Path)
+				tpl, err := template.ParseFiles(t.Root + path.Clean("/"+r.URL.Path))
 				if err != nil {
+					if os.IsNotExist(err) {
+						return http.StatusNotFound, nil
+					}
 					return http.StatusInternalServerError, err
 				}
 
-				// Execute it
-				var buf bytes.Buffer
-				err = tpl.Execute(&buf, ctx)
+				// Execute it, sending the output as it is rendered
+				out := middleware.NewStreamWriter(w, streamChunkSize)
+				err = tpl.Execute(out, ctx)
 				if err != nil {
-					return http.StatusInternalServerError, err
+					if !out.Started() {
+						return http.StatusInternalServerError, err
+					}
+					// Part of the page is sent, so it's too late for
+					// an error page; the error can still be logged
+					return http.StatusOK, err
 				}
-				buf.WriteTo(w)
 
-				return http.StatusOK, nil
+				return http.StatusOK, out.Flush()
 			}
 		}
 	}
@@ -107,4 +114,8 @@ type Rule struct {
 
 const defaultPath = "/"
 
+// streamChunkSize is how much of a rendered template
+// is buffered before it is sent to the client.
+const streamChunkSize = 32 << 10
+
 var defaultExtensions = []string{".html", ".htm", ".txt"}
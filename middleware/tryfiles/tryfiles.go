@@ -0,0 +1,91 @@
+// Package tryfiles is middleware that serves the first of several
+// candidate files that exists, like the try_files directive of nginx.
+package tryfiles
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// New creates a new instance of try_files middleware.
+func New(c middleware.Controller) (middleware.Middleware, error) {
+	files, err := parse(c)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.FileSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return TryFiles{Next: next, Root: root, Files: files}
+	}, nil
+}
+
+// TryFiles is middleware that rewrites the path of a request
+// to the first of Files that exists in Root, and then lets Next
+// serve it. Files may have placeholders like {path}, which are
+// replaced with values from the request. A file ending in "/"
+// must be a directory; any other must be a regular file. If none
+// of them exist, the request goes to Next as it is.
+type TryFiles struct {
+	Next  middleware.Handler
+	Root  http.FileSystem
+	Files []string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (t TryFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	replacer := middleware.NewReplacer(r, nil, "")
+	for _, file := range t.Files {
+		candidate := replacer.Replace(file)
+		isDir := strings.HasSuffix(candidate, "/")
+		candidate = path.Clean("/" + candidate)
+		if t.exists(candidate, isDir) {
+			if isDir && candidate != "/" {
+				candidate += "/"
+			}
+			r.URL.Path = candidate
+			break
+		}
+	}
+	return t.Next.ServeHTTP(w, r)
+}
+
+// exists returns whether name is a directory in
+// t.Root if isDir is true, or a regular file if not.
+func (t TryFiles) exists(name string, isDir bool) bool {
+	f, err := t.Root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if isDir {
+		return info.IsDir()
+	}
+	return info.Mode().IsRegular()
+}
+
+// parse gets the candidate files from the tokens of
+// the directive.
+func parse(c middleware.Controller) ([]string, error) {
+	var files []string
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return files, c.ArgErr()
+		}
+		files = append(files, args...)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,82 @@
+package tryfiles
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/middlewaretest"
+)
+
+func TestParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{"try_files {path} /index.html", false, []string{"{path}", "/index.html"}},
+		{"try_files {path}\ntry_files {path}/ /index.html", false, []string{"{path}", "{path}/", "/index.html"}},
+		{"try_files", true, nil},
+	} {
+		files, err := parse(middlewaretest.NewController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected an error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(files, test.expected) {
+			t.Errorf("Test %d: Expected files %v, got %v", i, test.expected, files)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	c := middlewaretest.NewController("try_files {path} {path}.html {path}/ /index.php")
+	c.Files = http.FS(fstest.MapFS{
+		"about.html":      {},
+		"about":           {Mode: 0755 | fs.ModeDir},
+		"docs/index.html": {},
+		"blog.html":       {},
+		"index.php":       {},
+		"style.css":       {},
+	})
+	mid, err := New(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var served string
+	h := mid(middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		served = r.URL.Path
+		return http.StatusOK, nil
+	}))
+
+	for i, test := range []struct {
+		path           string
+		expectedServed string
+	}{
+		{"/style.css", "/style.css"},
+		{"/blog", "/blog.html"},
+		{"/about", "/about.html"}, // the file, before the directory of the same name
+		{"/docs", "/docs/"},
+		{"/users/42", "/index.php"},
+		{"/../style.css", "/style.css"},
+	} {
+		_, err := h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if served != test.expectedServed {
+			t.Errorf("Test %d: Expected %s to be served, got %s", i, test.expectedServed, served)
+		}
+	}
+}
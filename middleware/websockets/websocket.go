@@ -1,6 +1,7 @@
 package websockets
 
 import (
+	"log"
 	"net"
 	"net/http"
 	"os/exec"
@@ -28,14 +29,15 @@ func (ws WebSocket) Handle(conn *websocket.Conn) {
 
 	metavars, err := ws.buildEnv(cmd.Path)
 	if err != nil {
-		panic(err) // TODO
+		log.Printf("[ERROR] WebSocket %s: %v", ws.URL.Path, err)
+		return // connection is closed when the handler returns
 	}
 
 	cmd.Env = metavars
 
 	err = cmd.Run()
 	if err != nil {
-		panic(err)
+		log.Printf("[ERROR] WebSocket %s: %v", ws.URL.Path, err)
 	}
 }
 
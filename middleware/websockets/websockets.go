@@ -4,7 +4,12 @@
 package websockets
 
 import (
+	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/mholt/caddy/middleware"
 	"golang.org/x/net/websocket"
@@ -28,7 +33,8 @@ type (
 		Path      string
 		Command   string
 		Arguments []string
-		Respawn   bool // TODO: Not used, but parser supports it until we decide on it
+		Respawn   bool   // TODO: Not used, but parser supports it until we decide on it
+		Upstream  string // if not empty, connections are proxied to this host:port instead of a command
 	}
 )
 
@@ -36,6 +42,18 @@ type (
 func (ws WebSockets) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	for _, sockconfig := range ws.Sockets {
 		if middleware.Path(r.URL.Path).Matches(sockconfig.Path) {
+			if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				return http.StatusBadRequest, nil
+			}
+
+			if sockconfig.Upstream != "" {
+				// The reverse proxy handles the upgrade and closes
+				// each end of the connection when the other closes
+				target := &url.URL{Scheme: "http", Host: sockconfig.Upstream}
+				httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+				return 0, nil
+			}
+
 			socket := WebSocket{
 				WSConfig: sockconfig,
 				Request:  r,
@@ -98,6 +116,15 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 			}
 		}
 
+		// A backend address instead of a command means proxying
+		if upstream, ok := upstreamAddress(command); ok {
+			websocks = append(websocks, WSConfig{
+				Path:     path,
+				Upstream: upstream,
+			})
+			continue
+		}
+
 		// Split command into the actual command and its arguments
 		cmd, args, err := middleware.SplitCommandAndArgs(command)
 		if err != nil {
@@ -120,6 +147,24 @@ func New(c middleware.Controller) (middleware.Middleware, error) {
 	}, nil
 }
 
+// upstreamAddress returns the host:port of a backend WebSocket
+// server and true if val is such an address (optionally with a
+// ws:// scheme) rather than a command.
+func upstreamAddress(val string) (string, bool) {
+	val = strings.TrimPrefix(val, "ws://")
+	if strings.ContainsAny(val, " \t") {
+		return "", false
+	}
+	_, port, err := net.SplitHostPort(val)
+	if err != nil {
+		return "", false
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", false
+	}
+	return val, true
+}
+
 var (
 	// See CGI spec, 4.1.4
 	GatewayInterface string
@@ -1,17 +1,22 @@
 package server
 
 import (
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path"
 	"strings"
 
 	"github.com/mholt/caddy/middleware"
-	"github.com/mholt/caddy/middleware/browse"
 )
 
 // This FileServer is adapted from the one in net/http by
 // the Go authors. Significant modifications have been made.
+// Files with an extension in mimeTypes (in lower case) are
+// served with that content type, unless a middleware has
+// already set the Content-Type of the response.
 //
 //
 // License:
@@ -19,13 +24,15 @@ import (
 // Copyright 2009 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
-func FileServer(root http.FileSystem, hide []string) middleware.Handler {
-	return &fileHandler{root: root, hide: hide}
+func FileServer(root http.FileSystem, hide []string, indexPages []string, mimeTypes map[string]string) middleware.Handler {
+	return &fileHandler{root: root, hide: hide, indexPages: indexPages, mimeTypes: mimeTypes}
 }
 
 type fileHandler struct {
-	root http.FileSystem
-	hide []string // list of files to treat as "Not Found"
+	root       http.FileSystem
+	hide       []string          // list of files to treat as "Not Found"
+	indexPages []string          // list of files to serve for a directory, in order
+	mimeTypes  map[string]string // content types by extension, before mime.TypeByExtension
 }
 
 func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -74,7 +81,7 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name st
 
 	// use contents of an index file, if present, for directory
 	if d.IsDir() {
-		for _, indexPage := range browse.IndexPages {
+		for _, indexPage := range fh.indexPages {
 			index := strings.TrimSuffix(name, "/") + "/" + indexPage
 			ff, err := fh.root.Open(index)
 			if err == nil {
@@ -110,13 +117,77 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name st
 		}
 	}
 
+	// Serve the file compressed ahead of time instead, if there is
+	// one; it has the content type of the file itself
+	if gz, gzInfo, ok := fh.precompressed(r, name); ok {
+		defer gz.Close()
+		ctype := w.Header().Get("Content-Type")
+		if ctype == "" {
+			ctype = fh.mimeTypes[strings.ToLower(path.Ext(name))]
+		}
+		if ctype == "" {
+			ctype = mime.TypeByExtension(path.Ext(name))
+		}
+		if ctype == "" {
+			var buf [512]byte
+			n, _ := io.ReadFull(f, buf[:])
+			ctype = http.DetectContentType(buf[:n])
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", "gzip")
+		if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		setETag(w, gzInfo)
+		http.ServeContent(w, r, d.Name(), gzInfo.ModTime(), gz)
+		return http.StatusOK, nil
+	}
+
+	// ServeContent answers conditional requests (If-None-Match,
+	// If-Modified-Since, and so on) with 304 Not Modified or 412
+	// Precondition Failed, going by the ETag and the modified time.
 	// Note: Errors generated by ServeContent are written immediately
 	// to the response. This usually only happens if seeking fails (rare).
+	if ctype, ok := fh.mimeTypes[strings.ToLower(path.Ext(name))]; ok && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	setETag(w, d)
 	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
 
 	return http.StatusOK, nil
 }
 
+// setETag sets the ETag header for a response with the contents
+// of the file described by info, unless it has one already. The
+// ETag is made of the modified time (in seconds since the Unix
+// epoch) and the size, in hex, such as "55a3e4f1-1c8"; so the
+// gzipped version of a file, being another file, has another.
+func setETag(w http.ResponseWriter, info os.FileInfo) {
+	if w.Header().Get("ETag") != "" {
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size()))
+}
+
+// precompressed opens the gzipped version of the file name,
+// which is name with ".gz" appended, if the client accepts
+// gzip and there is one. The caller must close it.
+func (fh *fileHandler) precompressed(r *http.Request, name string) (http.File, os.FileInfo, bool) {
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		return nil, nil, false
+	}
+	gz, err := fh.root.Open(name + ".gz")
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := gz.Stat()
+	if err != nil || info.IsDir() {
+		gz.Close()
+		return nil, nil, false
+	}
+	return gz, info, true
+}
+
 // redirect is taken from http.localRedirect of the std lib. It
 // sends an HTTP redirect to the client but will preserve the
 // query string for the new path.
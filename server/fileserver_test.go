@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/mholt/caddy/config"
+)
+
+func TestFileServerETag(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	err := os.WriteFile(file, []byte("Hello, world!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Unix(0x55a3e4f1, 0)
+	err = os.Chtimes(file, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := FileServer(http.Dir(dir), nil, nil, nil)
+	etag := `"55a3e4f1-d"` // modified time and size, in hex
+
+	for i, test := range []struct {
+		ifNoneMatch    string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"", http.StatusOK, "Hello, world!"},
+		{etag, http.StatusNotModified, ""},
+		{`"other", ` + etag, http.StatusNotModified, ""},
+		{"*", http.StatusNotModified, ""},
+		{`"55a3e4f1-e"`, http.StatusOK, "Hello, world!"},
+		{`"other"`, http.StatusOK, "Hello, world!"},
+	} {
+		r := httptest.NewRequest("GET", "/file.txt", nil)
+		if test.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+
+		status, err := fs.ServeHTTP(w, r)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != http.StatusOK {
+			t.Errorf("Test %d: Expected ServeHTTP to return %d, got %d", i, http.StatusOK, status)
+		}
+		if w.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected response status %d, got %d", i, test.expectedStatus, w.Code)
+		}
+		if actual := w.Header().Get("ETag"); actual != etag {
+			t.Errorf("Test %d: Expected ETag %s, got %s", i, etag, actual)
+		}
+		if body := w.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestFileServerETagPrecompressed(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{"file.txt": "Hello, world!", "file.txt.gz": "gzipped"} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := FileServer(http.Dir(dir), nil, nil, nil)
+	etag := func(acceptEncoding string) string {
+		r := httptest.NewRequest("GET", "/file.txt", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, r)
+		return w.Header().Get("ETag")
+	}
+
+	plain, gzipped := etag(""), etag("gzip")
+	if plain == "" || gzipped == "" {
+		t.Fatalf("Expected ETags for both versions of the file, got %q and %q", plain, gzipped)
+	}
+	if plain == gzipped {
+		t.Errorf("Expected the gzipped version of the file to have another ETag than %s", plain)
+	}
+}
+
+func TestFileServerFileSystem(t *testing.T) {
+	conf, err := config.New().Root("/nonexistent").Build()
+	if err != nil {
+		t.Fatalf("Unable to build the config: %v", err)
+	}
+	conf.FileSystem = http.FS(fstest.MapFS{
+		"file.txt":       {Data: []byte("Hello, world!")},
+		"dir/index.html": {Data: []byte("<h1>Index</h1>")},
+	})
+	vh, err := newVirtualHost(conf)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/file.txt", http.StatusOK, "Hello, world!"},
+		{"/dir/", http.StatusOK, "<h1>Index</h1>"},
+		{"/missing.txt", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		status, _ := vh.stack.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if body := w.Body.String(); test.expectedBody != "" && body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/config"
+)
+
+// Group is a set of servers, one for each address, that sites
+// can be added to and removed from one at a time while the
+// others keep serving, such as by a program that serves a site
+// for each of its users. A site is added to the server for its
+// address if there is one; otherwise a new server is started
+// for it, and stopped again once its last site is removed.
+type Group struct {
+	HTTP2       bool          // passed on to new servers
+	GracePeriod time.Duration // passed on to new servers, if set
+	Verbose     bool          // passed on to new servers
+	mu          sync.Mutex
+	servers     map[string]*Server // by address
+}
+
+// Add starts serving the site configured in conf, running its
+// startup functions first. It returns once the site is being
+// served, or with the error that kept it from being served.
+func (g *Group) Add(conf config.Config) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	addr, s, err := g.serverFor(conf)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		return s.AddSite(conf)
+	}
+
+	s, err = New(addr, []config.Config{conf}, conf.TLS.Enabled)
+	if err != nil {
+		return err
+	}
+	s.HTTP2 = g.HTTP2
+	s.Verbose = g.Verbose
+	if g.GracePeriod > 0 {
+		s.GracePeriod = g.GracePeriod
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve()
+	}()
+	if s.ListenAddr() == nil {
+		return <-served
+	}
+	go func() {
+		err := <-served
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if g.servers == nil {
+		g.servers = make(map[string]*Server)
+	}
+	g.servers[addr] = s
+	return nil
+}
+
+// Remove stops serving the site configured in conf, which was
+// added with Add, like Server.RemoveSite does. If it was the
+// last site of its server, the server is stopped instead, which
+// closes its listener.
+func (g *Group) Remove(conf config.Config) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	addr, s, err := g.serverFor(conf)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("Cannot remove %s - nothing is served at its address", conf.Address())
+	}
+
+	s.vhostsMu.RLock()
+	_, ok := s.vhosts[conf.Host]
+	s.vhostsMu.RUnlock()
+	if ok && s.sites() == 1 {
+		delete(g.servers, addr)
+		return s.Stop()
+	}
+	return s.RemoveSite(conf.Host)
+}
+
+// ListenAddr returns the address that the server serving the
+// site configured in conf is bound to, or nil if there is none.
+func (g *Group) ListenAddr(conf config.Config) net.Addr {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, s, err := g.serverFor(conf)
+	if err != nil || s == nil {
+		return nil
+	}
+	return s.ListenAddr()
+}
+
+// Stop stops all the servers of g, like Server.Stop, and
+// returns the first error, if any.
+func (g *Group) Stop() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var firstErr error
+	for addr, s := range g.servers {
+		err := s.Stop()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(g.servers, addr)
+	}
+	return firstErr
+}
+
+// serverFor returns the address to serve the site configured
+// in conf on, arranged like config.ArrangeBindings does, and
+// the server of g already listening there, if any. A site on
+// one interface is served by a server on all interfaces of its
+// port, if there is one. The reverse needs the servers on that
+// port to be replaced, which is an error.
+func (g *Group) serverFor(conf config.Config) (string, *Server, error) {
+	bindings, err := config.ArrangeBindings([]config.Config{conf})
+	if err != nil {
+		return "", nil, err
+	}
+	var addr string
+	for a := range bindings {
+		addr = a
+	}
+	if s, ok := g.servers[addr]; ok {
+		return addr, s, nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, nil, nil // Unix socket
+	}
+	for other, s := range g.servers {
+		otherHost, otherPort, err := net.SplitHostPort(other)
+		if err != nil || otherPort != port {
+			continue
+		}
+		if config.IsCatchAllHost(otherHost) {
+			return other, s, nil
+		}
+		if config.IsCatchAllHost(host) {
+			return "", nil, fmt.Errorf("Cannot serve %s on all interfaces of port %s - %s is already listening on one of them",
+				conf.Address(), port, other)
+		}
+	}
+	return addr, nil, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/mholt/caddy/config"
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestGroupAddRemove(t *testing.T) {
+	// Each site responds with its own name
+	site := func(host string) config.Config {
+		conf, err := config.New().Host(host).Port("0").Bind("127.0.0.1").Use(func(next middleware.Handler) middleware.Handler {
+			return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				io.WriteString(w, host)
+				return http.StatusOK, nil
+			})
+		}).Build()
+		if err != nil {
+			t.Fatalf("Unable to build the config of %s: %v", host, err)
+		}
+		return conf
+	}
+	first, second := site("first.test"), site("second.test")
+
+	var g Group
+	defer g.Stop()
+
+	err := g.Add(first)
+	if err != nil {
+		t.Fatalf("Expected no error adding %s, got %v", first.Host, err)
+	}
+	addr := g.ListenAddr(first)
+	if addr == nil {
+		t.Fatalf("Expected %s to be listening, but it isn't", first.Host)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "tcp", addr.String())
+		},
+	}}
+	defer client.CloseIdleConnections()
+	get := func(host string) (int, string) {
+		resp, err := client.Get("http://" + host + "/")
+		if err != nil {
+			t.Fatalf("Unable to get %s: %v", host, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Unable to read the response of %s: %v", host, err)
+		}
+		return resp.StatusCode, string(body)
+	}
+	expect := func(step, host string, expectedStatus int, expectedBody string) {
+		status, body := get(host)
+		if status != expectedStatus {
+			t.Errorf("%s: Expected status %d from %s, got %d", step, expectedStatus, host, status)
+		}
+		if expectedBody != "" && body != expectedBody {
+			t.Errorf("%s: Expected body %q from %s, got %q", step, expectedBody, host, body)
+		}
+	}
+
+	expect("Before adding", first.Host, http.StatusOK, first.Host)
+	expect("Before adding", second.Host, http.StatusNotFound, "")
+
+	err = g.Add(second)
+	if err != nil {
+		t.Fatalf("Expected no error adding %s, got %v", second.Host, err)
+	}
+	if a := g.ListenAddr(second); a == nil || a.String() != addr.String() {
+		t.Fatalf("Expected %s to be served by the same server at %s, got %v", second.Host, addr, a)
+	}
+	expect("After adding", first.Host, http.StatusOK, first.Host)
+	expect("After adding", second.Host, http.StatusOK, second.Host)
+
+	err = g.Remove(first)
+	if err != nil {
+		t.Fatalf("Expected no error removing %s, got %v", first.Host, err)
+	}
+	expect("After removing", first.Host, http.StatusNotFound, "")
+	expect("After removing", second.Host, http.StatusOK, second.Host)
+
+	err = g.Remove(first)
+	if err == nil {
+		t.Errorf("Expected an error removing %s again, but got none", first.Host)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/mholt/caddy/config"
+)
+
+// beforeRequest calls the BeforeRequest functions of conf
+// in order, and returns the request to handle: r, or the
+// last one that they returned instead.
+func beforeRequest(conf config.Config, r *http.Request) *http.Request {
+	for _, fn := range conf.BeforeRequest {
+		func() {
+			defer recoverHook(conf, "before request")
+			if next := fn(r); next != nil {
+				r = next
+			}
+		}()
+	}
+	return r
+}
+
+// afterRequest calls the AfterRequest functions of conf
+// in order, with r and the status of its response.
+func afterRequest(conf config.Config, r *http.Request, status int) {
+	for _, fn := range conf.AfterRequest {
+		func() {
+			defer recoverHook(conf, "after request")
+			fn(r, status)
+		}()
+	}
+}
+
+// recoverHook logs the panic of a request hook (kind) of
+// conf, if there is one, so that it can't take the server
+// or the request down with it.
+func recoverHook(conf config.Config, kind string) {
+	if rec := recover(); rec != nil {
+		log.Printf("%s: %s function panicked: %v", conf.Address(), kind, rec)
+	}
+}
+
+// statusRecorder is a ResponseWriter that records the
+// status of the response, for the AfterRequest functions.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the first status written and
+// calls the underlying ResponseWriter's WriteHeader.
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes buf, with status 200 if no other
+// has been written.
+func (w *statusRecorder) Write(buf []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher, if the underlying
+// ResponseWriter does, for streamed responses.
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, if the underlying
+// ResponseWriter does, for websockets.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("the response can't be hijacked")
+}
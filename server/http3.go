@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTP3Server serves HTTP/3 over QUIC on a UDP socket.
+type HTTP3Server interface {
+	// Serve accepts QUIC connections on conn and serves their
+	// requests until Close is called.
+	Serve(conn net.PacketConn) error
+
+	// Close stops serving, closing the open connections.
+	Close() error
+}
+
+// NewHTTP3Server creates the HTTP/3 server for the sites of a
+// server with TLS that turn on the experimental_http3 option of
+// the tls directive, serving handler with tlsConfig. There is no
+// QUIC implementation in the standard library, so this is nil
+// unless a build of the server that includes one sets it, such
+// as in an init function; until then, those sites are served
+// over TCP only, with a warning.
+var NewHTTP3Server func(handler http.Handler, tlsConfig *tls.Config) HTTP3Server
+
+// http3Enabled returns whether any site served by s
+// turns on HTTP/3.
+func (s *Server) http3Enabled() bool {
+	for _, vh := range s.vhosts {
+		if vh.config.TLS.HTTP3 {
+			return true
+		}
+	}
+	return false
+}
+
+// startHTTP3 starts serving HTTP/3 over UDP on the port that
+// ln (not yet wrapped in TLS) is bound to, with tlsConfig, if
+// a site of s turns it on, and advertises it in the responses
+// served over TCP from then on.
+func (s *Server) startHTTP3(ln net.Listener, tlsConfig *tls.Config) error {
+	if !s.tls || !s.http3Enabled() {
+		return nil
+	}
+	if NewHTTP3Server == nil {
+		log.Printf("Warning: %s - this build has no QUIC implementation, so HTTP/3 is not served", s.address)
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(s.address)
+	if err != nil {
+		return err
+	}
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(host, port)
+	conn, err := net.ListenPacket(strings.Replace(s.network, "tcp", "udp", 1), addr)
+	if err != nil {
+		return s.listenError(err)
+	}
+
+	// QUIC requires TLS 1.3 and negotiates HTTP/3 as "h3"
+	quicConfig := tlsConfig.Clone()
+	quicConfig.MinVersion = tls.VersionTLS13
+	quicConfig.NextProtos = []string{"h3"}
+
+	s.h3 = NewHTTP3Server(s, quicConfig)
+	s.h3Conn = conn
+	s.altSvc = `h3=":` + port + `"; ma=86400`
+	go func() {
+		err := s.h3.Serve(conn)
+		if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s: HTTP/3: %v", addr, err)
+		}
+	}()
+
+	return nil
+}
+
+// stopHTTP3 stops serving HTTP/3, if s is.
+func (s *Server) stopHTTP3() {
+	if s.h3 != nil {
+		s.h3.Close()
+		s.h3Conn.Close()
+	}
+}
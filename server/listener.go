@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net"
+	"sync"
+)
+
+// limitListener is a net.Listener that has at most
+// cap(sem) connections open at once. Accept waits for
+// one of them to close before accepting another.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{} // holds a value for each open connection
+	done      chan struct{} // closed when the listener is
+	closeOnce sync.Once
+}
+
+// newLimitListener returns ln with at most n
+// connections open at once.
+func newLimitListener(ln net.Listener, n int) *limitListener {
+	return &limitListener{
+		Listener: ln,
+		sem:      make(chan struct{}, n),
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept waits until there are fewer than the most
+// connections allowed, then accepts the next one.
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return l.Listener.Accept() // fails, since it is closed
+	}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+// Close closes the listener, and stops Accept
+// from waiting for connections to close.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn is a connection accepted by a limitListener,
+// which makes room for another when it is closed.
+type limitConn struct {
+	net.Conn
+	release     func()
+	releaseOnce sync.Once
+}
+
+// Close closes the connection and makes room for another.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -4,13 +4,20 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/bradfitz/http2"
 	"github.com/mholt/caddy/config"
@@ -19,88 +26,564 @@ import (
 // Server represents an instance of a server, which serves
 // static content at a particular address (host and port).
 type Server struct {
-	HTTP2   bool                   // temporary while http2 is not in std lib (TODO: remove flag when part of std lib)
-	address string                 // the actual address for net.Listen to listen on
-	tls     bool                   // whether this server is serving all HTTPS hosts or not
-	vhosts  map[string]virtualHost // virtual hosts keyed by their address
+	HTTP2       bool                   // temporary while http2 is not in std lib (TODO: remove flag when part of std lib)
+	GracePeriod time.Duration          // how long Stop waits for requests in flight to finish
+	Verbose     bool                   // whether to log each startup and shutdown function as it runs
+	address     string                 // the actual address for net.Listen to listen on
+	listenAddr  net.Addr               // the address the listener is bound to, once listening
+	listening   chan struct{}          // closed once Listen has created the listener, or failed to
+	listenOnce  sync.Once              // makes sure Listen only takes effect once
+	listenErr   error                  // the error of Listen, if it failed
+	ln          net.Listener           // the listener to serve on, once Listen has created it
+	network     string                 // the network for net.Listen: tcp, tcp4, tcp6, or unix
+	tls         bool                   // whether this server is serving all HTTPS hosts or not
+	maxConns    int                    // the most connections to have open at once; 0 for no limit
+	vhosts      map[string]virtualHost // virtual hosts keyed by their address
+	vhostsMu    sync.RWMutex           // protects vhosts, which may be replaced by Reload
+	server      *http.Server           // the underlying server, which can be shut down
+	h3          HTTP3Server            // the experimental HTTP/3 server, if a site turns it on
+	h3Conn      net.PacketConn         // the UDP socket h3 serves on
+	altSvc      string                 // the Alt-Svc header advertising h3 to clients
+	stopOnce    sync.Once              // makes sure Stop only takes effect once
+	stopped     chan struct{}          // closed when Stop is done
 }
 
+// DefaultGracePeriod is the default time to wait for requests
+// in flight to finish when stopping a server.
+const DefaultGracePeriod = 5 * time.Second
+
 // New creates a new Server which will bind to addr and serve
 // the sites/hosts configured in configs. This function does
 // not start serving.
 func New(addr string, configs []config.Config, tls bool) (*Server, error) {
 	s := &Server{
-		address: addr,
-		tls:     tls,
-		vhosts:  make(map[string]virtualHost),
+		GracePeriod: DefaultGracePeriod,
+		address:     addr,
+		tls:         tls,
+		listening:   make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	if len(configs) > 0 {
+		s.network = configs[0].ListenNetwork()
+	}
+	for _, conf := range configs {
+		if conf.TLS.DisableHTTP2 && !conf.TLS.Enabled {
+			log.Printf("Warning: %s - HTTP/2 can only be turned off for sites with TLS, so this has no effect", conf.Address())
+		}
+		if conf.TLS.HTTP3 && !conf.TLS.Enabled {
+			log.Printf("Warning: %s - HTTP/3 can only be served for sites with TLS, so this has no effect", conf.Address())
+		}
+		if conf.ListenNetwork() != s.network {
+			return nil, fmt.Errorf("Cannot serve %s over %s - another site on address %s is served over %s",
+				conf.Address(), conf.ListenNetwork(), s.address, s.network)
+		}
+	}
+	for _, conf := range configs {
+		if n := conf.MaxConns; n > 0 && (s.maxConns == 0 || n < s.maxConns) {
+			s.maxConns = n
+		}
+	}
+	s.server = &http.Server{
+		Addr:         s.address,
+		Handler:      s,
+		ReadTimeout:  shortestTimeout(configs, func(c config.Config) time.Duration { return c.ReadTimeout }),
+		WriteTimeout: shortestTimeout(configs, func(c config.Config) time.Duration { return c.WriteTimeout }),
+		IdleTimeout:  shortestTimeout(configs, func(c config.Config) time.Duration { return c.IdleTimeout }),
+	}
+
+	vhosts, err := s.virtualHosts(configs)
+	if err != nil {
+		return nil, err
 	}
+	s.vhosts = vhosts
+
+	return s, nil
+}
 
+// shortestTimeout returns the shortest non-zero timeout
+// that timeout gets from configs, which share a listener,
+// or zero if none of them have one.
+func shortestTimeout(configs []config.Config, timeout func(config.Config) time.Duration) time.Duration {
+	var shortest time.Duration
 	for _, conf := range configs {
-		if _, exists := s.vhosts[conf.Host]; exists {
-			return nil, fmt.Errorf("Cannot serve %s - host already defined for address %s", conf.Address(), s.address)
+		if t := timeout(conf); t > 0 && (shortest == 0 || t < shortest) {
+			shortest = t
 		}
+	}
+	return shortest
+}
+
+// virtualHosts creates the virtual hosts, keyed by host,
+// for the sites configured in configs.
+func (s *Server) virtualHosts(configs []config.Config) (map[string]virtualHost, error) {
+	vhosts := make(map[string]virtualHost)
 
-		vh := virtualHost{config: conf}
+	for _, conf := range configs {
+		err := s.checkHost(vhosts, conf)
+		if err != nil {
+			return nil, err
+		}
 
-		// Build middleware stack
-		err := vh.buildStack()
+		vh, err := newVirtualHost(conf)
 		if err != nil {
 			return nil, err
 		}
 
-		s.vhosts[conf.Host] = vh
+		vhosts[conf.Host] = vh
 	}
 
-	return s, nil
+	return vhosts, nil
 }
 
-// Serve starts the server. It blocks until the server quits.
-func (s *Server) Serve() error {
-	server := &http.Server{
-		Addr:    s.address,
-		Handler: s,
+// newVirtualHost creates the virtual host for the site
+// configured in conf, with its middleware stack. It keeps
+// a clone of conf, so that changing conf afterward, such as
+// to make the config of another site from it, doesn't change
+// the site being served.
+func newVirtualHost(conf config.Config) (virtualHost, error) {
+	vh := virtualHost{config: conf.Clone(), requests: new(sync.WaitGroup)}
+	err := vh.buildStack()
+	return vh, err
+}
+
+// checkHost returns an error if the site configured in conf
+// can't be served along with vhosts: if one of them has the
+// same host, or both conf and one of them are catch-all hosts.
+func (s *Server) checkHost(vhosts map[string]virtualHost, conf config.Config) error {
+	if _, exists := vhosts[conf.Host]; exists {
+		return fmt.Errorf("Cannot serve %s - host already defined for address %s", conf.Address(), s.address)
 	}
+	if config.IsCatchAllHost(conf.Host) {
+		for host := range vhosts {
+			if config.IsCatchAllHost(host) {
+				return fmt.Errorf("Cannot serve %s - catch-all host already defined for address %s", conf.Address(), s.address)
+			}
+		}
+	}
+	return nil
+}
 
-	if s.HTTP2 {
+// Address returns the address the server listens on.
+func (s *Server) Address() string {
+	return s.address
+}
+
+// ListenAddr returns the address the listener of s is bound
+// to, waiting for Listen (or Serve) to create it if it hasn't
+// yet. If the port of s is 0, it has the port the system
+// chose. It returns nil if Listen failed.
+func (s *Server) ListenAddr() net.Addr {
+	<-s.listening
+	return s.listenAddr
+}
+
+// Listen runs the startup functions of s and creates its
+// listener, without serving any requests yet, so that the
+// process can do what it must after binding its ports and
+// before serving, such as dropping root privileges. Anything
+// that may need those privileges, like reading the TLS
+// certificates, is done here too. Serve calls Listen if
+// it hasn't been called; it only takes effect once.
+func (s *Server) Listen() error {
+	s.listenOnce.Do(func() {
+		defer close(s.listening)
+		s.ln, s.listenErr = s.startListening()
+		if s.listenErr == nil {
+			s.listenAddr = s.ln.Addr()
+		}
+	})
+	return s.listenErr
+}
+
+// startListening does the work of Listen, returning the
+// listener to serve on.
+func (s *Server) startListening() (net.Listener, error) {
+	if s.tls && s.http2Disabled() {
+		// A non-nil, empty map keeps net/http from enabling it too
+		s.server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	} else if s.HTTP2 {
 		// TODO: This call may not be necessary after HTTP/2 is merged into std lib
-		http2.ConfigureServer(server, nil)
+		http2.ConfigureServer(s.server, nil)
+	}
+
+	// Execute startup functions now
+	err := s.startup(s.vhosts)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := s.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.maxConns > 0 {
+		ln = newLimitListener(ln, s.maxConns)
+	}
+
+	if s.tls {
+		var tlsConfigs []config.TLSConfig
+		for _, vh := range s.vhosts {
+			tlsConfigs = append(tlsConfigs, vh.config.TLS)
+		}
+		tlsConfig, err := newTLSConfig(s.server, tlsConfigs)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		if s.HTTP2 && !s.http2Disabled() && !hasProto(tlsConfig.NextProtos, "h2") {
+			// net/http only adds h2 to the TLS config it serves
+			// with itself, not to the one of our listener
+			tlsConfig.NextProtos = append([]string{"h2"}, tlsConfig.NextProtos...)
+		}
+		err = s.startHTTP3(ln, tlsConfig)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	return ln, nil
+}
+
+// Serve starts the server, first calling Listen if it
+// hasn't been called. It blocks until the server quits,
+// which includes waiting for Stop to finish if it is called.
+func (s *Server) Serve() error {
+	err := s.Listen()
+	if err != nil {
+		return err
+	}
+
+	err = s.server.Serve(s.ln)
+	if err == http.ErrServerClosed {
+		<-s.stopped
+		return nil
+	}
+	return err
+}
+
+// http2Disabled returns whether any site served by s
+// turns off HTTP/2.
+func (s *Server) http2Disabled() bool {
+	for _, vh := range s.vhosts {
+		if vh.config.TLS.DisableHTTP2 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasProto returns whether protos has proto in it.
+func hasProto(protos []string, proto string) bool {
+	for _, p := range protos {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// listen creates the listener of s. For a Unix socket, it
+// replaces a socket file left there by a server that didn't
+// shut down cleanly, and sets its permissions if a site asks
+// for them.
+func (s *Server) listen() (net.Listener, error) {
+	if s.network != "unix" {
+		ln, err := net.Listen(s.network, s.address)
+		if err != nil {
+			return nil, s.listenError(err)
+		}
+		return ln, nil
+	}
+
+	path := strings.TrimPrefix(s.address, "unix:")
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, s.listenError(err)
 	}
 
 	for _, vh := range s.vhosts {
-		// Execute startup functions now
-		for _, start := range vh.config.Startup {
-			err := start()
+		if mode := vh.config.SocketMode; mode != 0 {
+			err = os.Chmod(path, mode)
 			if err != nil {
-				return err
+				ln.Close()
+				return nil, err
 			}
+			break
 		}
+	}
 
-		// Execute shutdown commands on exit
-		if len(vh.config.Shutdown) > 0 {
-			go func() {
-				interrupt := make(chan os.Signal, 1)
-				signal.Notify(interrupt, os.Interrupt, os.Kill) // TODO: syscall.SIGQUIT? (Ctrl+\, Unix-only)
-				<-interrupt
-				for _, shutdownFunc := range vh.config.Shutdown {
-					err := shutdownFunc()
-					if err != nil {
-						log.Fatal(err)
-					}
-				}
-				os.Exit(0)
-			}()
+	return ln, nil
+}
+
+// listenError returns err, from listening on the address of
+// s, with a message that says which address and sites it was
+// for, and what to do about it if the cause is a common one.
+func (s *Server) listenError(err error) error {
+	var sites []string
+	for _, vh := range s.vhosts {
+		sites = append(sites, vh.config.Address())
+	}
+	sort.Strings(sites)
+	msg := fmt.Sprintf("Cannot listen on %s for %s", s.address, strings.Join(sites, ", "))
+
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return fmt.Errorf("%s - the address is already in use, probably by another web server "+
+			"or another instance of this one; stop it or choose another port: %w", msg, err)
+	case errors.Is(err, os.ErrPermission) && s.network != "unix":
+		return fmt.Errorf("%s - permission denied; ports below 1024 usually require root, "+
+			"after which the user directive can drop privileges: %w", msg, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// Reload replaces the sites served by s with those configured in
+// configs without closing the listener. The startup functions of
+// the new sites are run before they start serving, and then the
+// shutdown functions of the old sites are run. If the new sites
+// can't be set up, the old ones keep serving and an error is
+// returned. TLS settings, timeouts, and the network of the
+// listener are not changed.
+func (s *Server) Reload(configs []config.Config) error {
+	for _, conf := range configs {
+		if conf.TLS.Enabled != s.tls {
+			return fmt.Errorf("Cannot reload %s - changing between HTTP and HTTPS requires a restart", conf.Address())
+		}
+		if conf.ListenNetwork() != s.network {
+			return fmt.Errorf("Cannot reload %s - changing the network requires a restart", conf.Address())
 		}
 	}
 
-	if s.tls {
-		var tlsConfigs []config.TLSConfig
-		for _, vh := range s.vhosts {
-			tlsConfigs = append(tlsConfigs, vh.config.TLS)
+	vhosts, err := s.virtualHosts(configs)
+	if err != nil {
+		return err
+	}
+	err = s.startup(vhosts)
+	if err != nil {
+		return err
+	}
+
+	s.vhostsMu.Lock()
+	old := s.vhosts
+	s.vhosts = vhosts
+	s.vhostsMu.Unlock()
+
+	s.shutdown(old)
+	return nil
+}
+
+// AddSite adds the site configured in conf to those served by s,
+// without closing the listener or changing the other sites. The
+// startup functions of the site are run before it starts serving.
+// As with Reload, the TLS settings, timeouts, and network of the
+// listener are not changed, so a site with TLS can't be added.
+func (s *Server) AddSite(conf config.Config) error {
+	if conf.TLS.Enabled || s.tls {
+		return fmt.Errorf("Cannot add %s - sites with TLS can only be served by a new listener", conf.Address())
+	}
+	if conf.ListenNetwork() != s.network {
+		return fmt.Errorf("Cannot add %s - address %s is served over %s", conf.Address(), s.address, s.network)
+	}
+
+	s.vhostsMu.RLock()
+	err := s.checkHost(s.vhosts, conf)
+	s.vhostsMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	vh, err := newVirtualHost(conf)
+	if err != nil {
+		return err
+	}
+	vhosts := map[string]virtualHost{conf.Host: vh}
+	err = s.startup(vhosts)
+	if err != nil {
+		return err
+	}
+
+	s.vhostsMu.Lock()
+	defer s.vhostsMu.Unlock()
+
+	// Another site may have been added while this one started
+	err = s.checkHost(s.vhosts, conf)
+	if err != nil {
+		s.shutdown(vhosts)
+		return err
+	}
+
+	// Replace the map rather than change it, since Serve
+	// reads it without the lock while it starts
+	added := make(map[string]virtualHost, len(s.vhosts)+1)
+	for host, vh := range s.vhosts {
+		added[host] = vh
+	}
+	added[conf.Host] = vh
+	s.vhosts = added
+	return nil
+}
+
+// RemoveSite stops serving the site for host, without closing
+// the listener or changing the other sites. It waits up to
+// s.GracePeriod for requests to the site in flight to finish,
+// then runs the shutdown functions of the site. Requests for
+// host then get whichever site would serve them if it had never
+// been there, such as a catch-all one.
+func (s *Server) RemoveSite(host string) error {
+	s.vhostsMu.Lock()
+	vh, ok := s.vhosts[host]
+	if !ok {
+		s.vhostsMu.Unlock()
+		return fmt.Errorf("Cannot remove %s - no such host at address %s", host, s.address)
+	}
+	removed := make(map[string]virtualHost, len(s.vhosts))
+	for h, other := range s.vhosts {
+		if h != host {
+			removed[h] = other
+		}
+	}
+	s.vhosts = removed
+	s.vhostsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		vh.requests.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(s.GracePeriod):
+	}
+
+	s.shutdown(map[string]virtualHost{host: vh})
+	return nil
+}
+
+// sites returns how many sites s serves.
+func (s *Server) sites() int {
+	s.vhostsMu.RLock()
+	defer s.vhostsMu.RUnlock()
+	return len(s.vhosts)
+}
+
+// Stop stops the server from accepting new connections, waits
+// up to s.GracePeriod for requests in flight to finish, then
+// runs the shutdown functions of each virtual host. Requests
+// still running after the grace period are cut off. Errors
+// from shutdown functions are logged so that the rest still run.
+func (s *Server) Stop() error {
+	var err error
+
+	s.stopOnce.Do(func() {
+		defer close(s.stopped)
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.GracePeriod)
+		defer cancel()
+
+		err = s.server.Shutdown(ctx)
+		if err != nil {
+			s.server.Close()
 		}
-		return ListenAndServeTLSWithSNI(server, tlsConfigs)
+		s.stopHTTP3()
+
+		s.vhostsMu.RLock()
+		defer s.vhostsMu.RUnlock()
+		s.shutdown(s.vhosts)
+	})
+
+	return err
+}
+
+// virtualHostFor returns the virtual host in vhosts that serves
+// requests for host: the one for exactly that host if there is
+// one, otherwise the one with the longest pattern matching host
+// (like "*.example.com"), otherwise a catch-all one (see
+// config.IsCatchAllHost).
+func virtualHostFor(vhosts map[string]virtualHost, host string) (virtualHost, bool) {
+	if vh, ok := vhosts[host]; ok {
+		return vh, true
+	}
+
+	var match string
+	var catchAll *virtualHost
+	for pattern := range vhosts {
+		if config.IsCatchAllHost(pattern) {
+			vh := vhosts[pattern]
+			catchAll = &vh
+		} else if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) &&
+			len(pattern) > len(match) {
+			match = pattern
+		}
+	}
+
+	if match != "" {
+		return vhosts[match], true
+	}
+	if catchAll != nil {
+		return *catchAll, true
+	}
+	return virtualHost{}, false
+}
+
+// startup executes the startup functions of vhosts,
+// stopping at the first error.
+func (s *Server) startup(vhosts map[string]virtualHost) error {
+	for _, vh := range vhosts {
+		for i, start := range vh.config.Startup {
+			err := s.runHook(vh.config, "startup", hookName(vh.config.StartupNames, i), start)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// shutdown executes the shutdown functions of vhosts,
+// logging any errors so that the rest still run.
+func (s *Server) shutdown(vhosts map[string]virtualHost) {
+	for _, vh := range vhosts {
+		for i, shutdownFunc := range vh.config.Shutdown {
+			err := s.runHook(vh.config, "shutdown", hookName(vh.config.ShutdownNames, i), shutdownFunc)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// runHook runs fn, the startup or shutdown function (kind)
+// of conf named name. If s.Verbose is set, it logs when fn
+// starts and how long it took, and its error if it fails.
+func (s *Server) runHook(conf config.Config, kind, name string, fn func() error) error {
+	if !s.Verbose {
+		return fn()
+	}
+
+	log.Printf("%s: running %s function %s", conf.Address(), kind, name)
+	start := time.Now()
+	err := fn()
+	if err != nil {
+		log.Printf("%s: %s function %s failed after %v: %v", conf.Address(), kind, name, time.Since(start), err)
 	} else {
-		return server.ListenAndServe()
+		log.Printf("%s: %s function %s finished in %v", conf.Address(), kind, name, time.Since(start))
 	}
+	return err
+}
+
+// hookName returns the name of the function at index i
+// given names, in quotes, or its number if it has none.
+func hookName(names []string, i int) string {
+	if i < len(names) && names[i] != "" {
+		return fmt.Sprintf("%q", names[i])
+	}
+	return fmt.Sprintf("#%d", i+1)
 }
 
 // ListenAndServeTLSWithSNI serves TLS with Server Name Indication (SNI) support, which allows
@@ -113,6 +596,24 @@ func ListenAndServeTLSWithSNI(srv *http.Server, tlsConfigs []config.TLSConfig) e
 		addr = ":https"
 	}
 
+	config, err := newTLSConfig(srv, tlsConfigs)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	tlsListener := tls.NewListener(conn, config)
+	return srv.Serve(tlsListener)
+}
+
+// newTLSConfig creates the TLS configuration for srv, which
+// serves the sites with tlsConfigs. It starts from srv.TLSConfig
+// if it has one.
+func newTLSConfig(srv *http.Server, tlsConfigs []config.TLSConfig) (*tls.Config, error) {
 	config := new(tls.Config)
 	if srv.TLSConfig != nil {
 		*config = *srv.TLSConfig
@@ -124,22 +625,123 @@ func ListenAndServeTLSWithSNI(srv *http.Server, tlsConfigs []config.TLSConfig) e
 	// Here we diverge from the stdlib a bit by loading multiple certs/key pairs
 	// then we map the server names to their certs
 	var err error
-	config.Certificates = make([]tls.Certificate, len(tlsConfigs))
-	for i, tlsConfig := range tlsConfigs {
-		config.Certificates[i], err = tls.LoadX509KeyPair(tlsConfig.Certificate, tlsConfig.Key)
+	for _, tlsConfig := range tlsConfigs {
+		certs, err := tlsConfig.LoadCertificates()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		config.Certificates = append(config.Certificates, certs...)
 	}
 	config.BuildNameToCertificate()
 
-	conn, err := net.Listen("tcp", addr)
+	config.MinVersion, config.MaxVersion, err = protocolRange(tlsConfigs)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	config.CipherSuites, err = cipherSuites(tlsConfigs)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientAuth, config.ClientCAs, err = clientAuth(tlsConfigs)
+	if err != nil {
+		return nil, err
 	}
 
-	tlsListener := tls.NewListener(conn, config)
-	return srv.Serve(tlsListener)
+	return config, nil
+}
+
+// protocolRange returns the narrowest range of TLS protocol
+// versions allowed by all of tlsConfigs, since sites sharing
+// a listener must share its protocol versions. A zero value
+// means the Go default is used.
+func protocolRange(tlsConfigs []config.TLSConfig) (min, max uint16, err error) {
+	for _, tlsConfig := range tlsConfigs {
+		if v, ok := config.SupportedProtocols[tlsConfig.ProtocolMinVersion]; ok && v > min {
+			min = v
+		}
+		if v, ok := config.SupportedProtocols[tlsConfig.ProtocolMaxVersion]; ok && (max == 0 || v < max) {
+			max = v
+		}
+	}
+	if max != 0 && min > max {
+		err = errors.New("TLS protocol versions of sites on the same address do not overlap")
+	}
+	return
+}
+
+// clientAuth returns the client authentication to use for
+// all of tlsConfigs, and the CAs to verify client certificates
+// against. Since the server name a client asks for needn't be
+// the host it then sends requests for, sites that share a
+// listener can't authenticate clients differently; a client
+// must get past the strictest of them. So a certificate is
+// required if any site requires one, and it is verified if
+// any site verifies (against the CAs of all of them).
+func clientAuth(tlsConfigs []config.TLSConfig) (tls.ClientAuthType, *x509.CertPool, error) {
+	var require, verify bool
+	var all config.TLSConfig
+
+	for _, tlsConfig := range tlsConfigs {
+		switch tlsConfig.ClientAuth {
+		case "request":
+			verify = true
+		case "require":
+			require = true
+		case "verify":
+			require, verify = true, true
+		}
+		all.ClientCAs = append(all.ClientCAs, tlsConfig.ClientCAs...)
+	}
+
+	if !verify {
+		if require {
+			return tls.RequireAnyClientCert, nil, nil
+		}
+		return tls.NoClientCert, nil, nil
+	}
+
+	pool, err := all.ClientCAPool()
+	if err != nil {
+		return tls.NoClientCert, nil, err
+	}
+	if require {
+		return tls.RequireAndVerifyClientCert, pool, nil
+	}
+	return tls.VerifyClientCertIfGiven, pool, nil
+}
+
+// cipherSuites returns the cipher suites allowed by every one
+// of tlsConfigs that restricts them, in the order listed by the
+// first such config. A nil slice means the Go defaults are used.
+func cipherSuites(tlsConfigs []config.TLSConfig) ([]uint16, error) {
+	var ciphers []uint16
+	var restricted bool
+
+	for _, tlsConfig := range tlsConfigs {
+		if len(tlsConfig.Ciphers) == 0 {
+			continue
+		}
+		if !restricted {
+			ciphers = append(ciphers, tlsConfig.Ciphers...)
+			restricted = true
+			continue
+		}
+		var common []uint16
+		for _, cipher := range ciphers {
+			for _, other := range tlsConfig.Ciphers {
+				if cipher == other {
+					common = append(common, cipher)
+					break
+				}
+			}
+		}
+		ciphers = common
+	}
+
+	if restricted && len(ciphers) == 0 {
+		return nil, errors.New("Cipher suites of sites on the same address have nothing in common")
+	}
+	return ciphers, nil
 }
 
 // ServeHTTP is the entry point for every request to the address that s
@@ -147,6 +749,7 @@ func ListenAndServeTLSWithSNI(srv *http.Server, tlsConfigs []config.TLSConfig) e
 // defined in the Host header so that the correct virtualhost
 // (configuration and middleware stack) will handle the request.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var after func() // calls the AfterRequest functions of the site, if any
 	defer func() {
 		// In case the user doesn't enable error middleware, we still
 		// need to make sure that we stay alive up here
@@ -154,14 +757,46 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, http.StatusText(http.StatusInternalServerError),
 				http.StatusInternalServerError)
 		}
+		if after != nil {
+			after()
+		}
 	}()
 
+	if s.altSvc != "" && r.TLS != nil && r.ProtoMajor < 3 {
+		w.Header().Set("Alt-Svc", s.altSvc)
+	}
+
 	host, _, err := net.SplitHostPort(r.Host)
 	if err != nil {
-		host = r.Host // oh well
+		host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]") // no port, maybe IPv6
+	}
+
+	s.vhostsMu.RLock()
+	vh, ok := virtualHostFor(s.vhosts, host)
+	if ok {
+		vh.requests.Add(1) // while locked, so RemoveSite waits for it
 	}
+	s.vhostsMu.RUnlock()
+
+	if ok {
+		defer vh.requests.Done()
+
+		if timeouts, ok := vh.config.TimeoutsFor(r.URL.Path); ok {
+			setTimeouts(w, timeouts)
+		}
+
+		if len(vh.config.BeforeRequest) > 0 || len(vh.config.AfterRequest) > 0 {
+			rec := &statusRecorder{ResponseWriter: w}
+			w = rec
+			r = beforeRequest(vh.config, r)
+			after = func() {
+				if rec.status == 0 {
+					rec.status = http.StatusOK // nothing written
+				}
+				afterRequest(vh.config, r, rec.status)
+			}
+		}
 
-	if vh, ok := s.vhosts[host]; ok {
 		w.Header().Set("Server", "Caddy")
 
 		status, _ := vh.stack.ServeHTTP(w, r)
@@ -176,3 +811,19 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "No such host at %s", s.address)
 	}
 }
+
+// setTimeouts sets the read and write deadlines of the
+// connection of a request, which w writes the response to, to
+// those of timeouts from now, for the ones that are set; see
+// config.Timeouts. If the connection doesn't support changing
+// them, they are left as they are.
+func setTimeouts(w http.ResponseWriter, timeouts config.Timeouts) {
+	rc := http.NewResponseController(w)
+	now := time.Now()
+	if timeouts.Read > 0 {
+		rc.SetReadDeadline(now.Add(timeouts.Read))
+	}
+	if timeouts.Write > 0 {
+		rc.SetWriteDeadline(now.Add(timeouts.Write))
+	}
+}
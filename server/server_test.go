@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/config"
+)
+
+func TestServerHTTP2(t *testing.T) {
+	for i, test := range []struct {
+		disableHTTP2 bool
+		expectedALPN string
+	}{
+		{false, "h2"},
+		{true, "http/1.1"},
+	} {
+		conf, err := config.New().Host("localhost").Port("0").Bind("127.0.0.1").
+			TLS("../config/tls_cert_test.pem", "../config/tls_key_test.pem").Build()
+		if err != nil {
+			t.Fatalf("Test %d: Unable to build the config: %v", i, err)
+		}
+		conf.TLS.DisableHTTP2 = test.disableHTTP2
+
+		s, err := New(conf.Address(), []config.Config{conf}, true)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		s.HTTP2 = true
+		err = s.Listen()
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error listening, got %v", i, err)
+		}
+		go s.Serve()
+
+		nextProto := s.server.TLSNextProto
+		if test.disableHTTP2 && (nextProto == nil || len(nextProto) != 0) {
+			t.Errorf("Test %d: Expected TLSNextProto to be a non-nil, empty map, got %v", i, nextProto)
+		}
+		if !test.disableHTTP2 && nextProto != nil && nextProto["h2"] == nil {
+			t.Errorf("Test %d: Expected TLSNextProto to leave HTTP/2 on, got %v", i, nextProto)
+		}
+
+		conn, err := tls.Dial("tcp", s.ListenAddr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		if err != nil {
+			s.Stop()
+			t.Fatalf("Test %d: Unable to connect: %v", i, err)
+		}
+		if actual := conn.ConnectionState().NegotiatedProtocol; actual != test.expectedALPN {
+			t.Errorf("Test %d: Expected the server to pick protocol %q, got %q", i, test.expectedALPN, actual)
+		}
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestServerHTTP2WithoutTLS(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	conf, err := config.New().Host("localhost").Port("0").Bind("127.0.0.1").Build()
+	if err != nil {
+		t.Fatalf("Unable to build the config: %v", err)
+	}
+	conf.TLS.DisableHTTP2 = true
+
+	_, err = New(conf.Address(), []config.Config{conf}, false)
+	if err != nil {
+		t.Fatalf("Expected only a warning, got error %v", err)
+	}
+	if !strings.Contains(buf.String(), "HTTP/2 can only be turned off for sites with TLS") {
+		t.Errorf("Expected a warning that turning off HTTP/2 has no effect, got %q", buf.String())
+	}
+}
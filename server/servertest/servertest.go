@@ -0,0 +1,102 @@
+// Package servertest starts sites for end-to-end tests of
+// middleware and the server, like net/http/httptest does for
+// plain handlers:
+//
+//	cfg, _ := config.New().Host("example.com").Use(myMiddleware).Build()
+//	s, err := servertest.Start(cfg)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//	resp, err := s.Client.Get(s.URL + "/page")
+package servertest
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/config"
+	"github.com/mholt/caddy/server"
+)
+
+// Server is a site being served for a test.
+type Server struct {
+	// The base URL of the site, with its host and the port
+	// it is served on, like "http://example.com:54321"
+	URL string
+
+	// A client that connects to the site for each request,
+	// whatever the host in the URL, so that requests for the
+	// host of the site reach it without name resolution; it
+	// trusts any certificate of a site with TLS
+	Client *http.Client
+
+	server *server.Server
+}
+
+// Start serves the site configured in conf on a free port of
+// the loopback interface, or on its Unix socket if it has one,
+// and returns once it is listening. Its startup functions are
+// run first. The caller must call Close when done with it.
+func Start(conf config.Config) (*Server, error) {
+	conf = conf.Clone()
+	if conf.Socket == "" {
+		conf.Port = "0"
+		if conf.BindAddress == "" {
+			conf.BindAddress = "127.0.0.1"
+		}
+	}
+
+	srv, err := server.New(conf.ListenAddress(), []config.Config{conf}, conf.TLS.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	err = srv.Listen()
+	if err != nil {
+		return nil, err
+	}
+	go srv.Serve()
+
+	addr := srv.ListenAddr()
+	scheme := "http"
+	if conf.TLS.Enabled {
+		scheme = "https"
+	}
+	host := conf.Host
+	if config.IsCatchAllHost(host) {
+		host = "localhost"
+	} else if strings.HasPrefix(host, "*.") {
+		host = "www" + host[1:] // any name the pattern matches
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	url := scheme + "://" + host
+	if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+		url += ":" + port
+	}
+
+	var dialer net.Dialer
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, addr.Network(), addr.String())
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	return &Server{
+		URL:    url,
+		Client: &http.Client{Transport: transport},
+		server: srv,
+	}, nil
+}
+
+// Close closes the connections of s.Client and stops the
+// server, which closes its listener (and removes its Unix
+// socket) and runs the shutdown functions of the site.
+func (s *Server) Close() error {
+	s.Client.CloseIdleConnections()
+	return s.server.Stop()
+}
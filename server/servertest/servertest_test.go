@@ -0,0 +1,53 @@
+package servertest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/config"
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestStart(t *testing.T) {
+	for i, host := range []string{"example.com", "", "*.example.com", "::1"} {
+		conf, err := config.New().Host(host).Use(func(next middleware.Handler) middleware.Handler {
+			return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				io.WriteString(w, r.Host+r.URL.Path)
+				return http.StatusOK, nil
+			})
+		}).Build()
+		if err != nil {
+			t.Fatalf("Test %d: Unable to build the config: %v", i, err)
+		}
+
+		s, err := Start(conf)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error starting %q, got %v", i, host, err)
+		}
+
+		resp, err := s.Client.Get(s.URL + "/page")
+		if err != nil {
+			s.Close()
+			t.Fatalf("Test %d: Unable to get %s: %v", i, s.URL, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusOK, resp.StatusCode)
+		}
+		if expected := strings.TrimPrefix(s.URL, "http://") + "/page"; string(body) != expected {
+			t.Errorf("Test %d: Expected body %q, got %q", i, expected, body)
+		}
+
+		err = s.Close()
+		if err != nil {
+			t.Errorf("Test %d: Expected no error closing, got %v", i, err)
+		}
+		if _, err := s.Client.Get(s.URL + "/page"); err == nil {
+			t.Errorf("Test %d: Expected an error once the server is closed, but got none", i)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// noSymlinksDir is like http.Dir, but refuses to open files
+// reached through a symbolic link, so nothing outside of the
+// directory is served even if a link inside points there.
+// Opening such a file fails with a permission error, which
+// the file server answers with 403 Forbidden. The directory
+// itself may be a link.
+type noSymlinksDir string
+
+// Open opens the file name in d, unless its real path,
+// with all symlinks resolved, isn't the path it is at.
+func (d noSymlinksDir) Open(name string) (http.File, error) {
+	dir := string(d)
+	if dir == "" {
+		dir = "."
+	}
+	rel := filepath.FromSlash(path.Clean("/" + name))
+
+	real, err := filepath.EvalSymlinks(filepath.Join(dir, rel))
+	if err == nil {
+		base, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return nil, err
+		}
+		if real != filepath.Join(base, rel) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+		}
+	}
+
+	return http.Dir(dir).Open(name)
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"net/http"
+	"sort"
+	"sync"
 
 	"github.com/mholt/caddy/config"
 	"github.com/mholt/caddy/middleware"
@@ -15,28 +17,106 @@ type virtualHost struct {
 	config     config.Config
 	fileServer middleware.Handler
 	stack      middleware.Handler
+	scopes     []string                      // path scopes, each before the scopes it extends
+	stacks     map[string]middleware.Handler // the middleware stack of each path scope
+	requests   *sync.WaitGroup               // requests in flight, so RemoveSite can wait for them
 }
 
 // buildStack builds the server's middleware stack based
 // on its config. This method should be called last before
 // ListenAndServe begins.
 func (vh *virtualHost) buildStack() error {
-	vh.fileServer = FileServer(http.Dir(vh.config.Root), []string{vh.config.ConfigFile})
+	// A file system given in the config replaces the disk, path
+	// scopes with their own root get their own file server, and
+	// roots that depend on the host get one for each request
+	if vh.config.FileSystem != nil {
+		vh.fileServer = vh.newFileServer(vh.config.FileSystem)
+	} else {
+		rootFS, err := vh.fileSystem(vh.config.Root)
+		if err != nil {
+			return err
+		}
+		vh.fileServer = vh.newFileServer(rootFS)
+	}
+	if vh.config.FileSystem == nil && (len(vh.config.PathRoots) > 0 || config.IsHostRoot(vh.config.Root)) {
+		fileServers := map[string]middleware.Handler{vh.config.Root: vh.fileServer}
+		for _, root := range vh.config.PathRoots {
+			if _, ok := fileServers[root]; !ok {
+				fs, err := vh.fileSystem(root)
+				if err != nil {
+					return err
+				}
+				fileServers[root] = vh.newFileServer(fs)
+			}
+		}
+		vh.fileServer = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			root := vh.config.RootFor(r.URL.Path)
+			if config.IsHostRoot(root) {
+				dir, ok := config.HostRoot(root, r.Host)
+				if !ok {
+					return http.StatusBadRequest, nil
+				}
+				return vh.newFileServer(vh.dir(dir)).ServeHTTP(w, r)
+			}
+			return fileServers[root].ServeHTTP(w, r)
+		})
+	}
+
+	// Requests get the stack of the longest path scope they
+	// are in, which includes the middleware of every scope
+	// that contains that one
+	vh.scopes = nil
+	vh.stacks = make(map[string]middleware.Handler)
+	for scope := range vh.config.Middleware {
+		vh.scopes = append(vh.scopes, scope)
+		vh.stacks[scope] = vh.compile(vh.config.MiddlewareChain(scope))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(vh.scopes)))
 
-	// TODO: We only compile middleware for the "/" scope.
-	// Partial support for multiple location contexts already
-	// exists at the parser and config levels, but until full
-	// support is implemented, this is all we do right here.
-	vh.compile(vh.config.Middleware["/"])
+	vh.stack = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		for _, scope := range vh.scopes {
+			if middleware.Path(r.URL.Path).Matches(scope) {
+				return vh.stacks[scope].ServeHTTP(w, r)
+			}
+		}
+		return vh.fileServer.ServeHTTP(w, r)
+	})
 
 	return nil
 }
 
+// fileSystem returns the file system of root: the files
+// in the archive if root is one (see middleware.IsArchive),
+// or else the directory on disk.
+func (vh *virtualHost) fileSystem(root string) (http.FileSystem, error) {
+	if middleware.IsArchive(root) {
+		return middleware.OpenArchive(root)
+	}
+	return vh.dir(root), nil
+}
+
+// dir returns the file system of the directory on disk at
+// root, which doesn't follow symlinks if the config says so.
+func (vh *virtualHost) dir(root string) http.FileSystem {
+	if vh.config.DisableSymlinks {
+		return noSymlinksDir(root)
+	}
+	return http.Dir(root)
+}
+
+// newFileServer returns a file server for the files in root,
+// which hides the configuration file, serves the index files
+// of the config for directories, and uses its content types.
+func (vh *virtualHost) newFileServer(root http.FileSystem) middleware.Handler {
+	return FileServer(root, []string{vh.config.ConfigFile}, vh.config.Indexes(), vh.config.MIMETypes)
+}
+
 // compile is an elegant alternative to nesting middleware function
 // calls like handler1(handler2(handler3(finalHandler))).
-func (vh *virtualHost) compile(layers []middleware.Middleware) {
-	vh.stack = vh.fileServer // core app layer
+func (vh *virtualHost) compile(layers []middleware.Middleware) middleware.Handler {
+	stack := vh.fileServer // core app layer
 	for i := len(layers) - 1; i >= 0; i-- {
-		vh.stack = layers[i](vh.stack)
+		stack = layers[i](stack)
 	}
+	return stack
 }
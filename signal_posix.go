@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/server"
+)
+
+// reloadOnSignal reloads the configuration of servers
+// each time the process receives SIGUSR1.
+func reloadOnSignal(servers []*server.Server) {
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGUSR1)
+
+	for range reloadSignal {
+		err := reload(servers)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Println("Configuration reloaded")
+	}
+}
+
+// reopenLogsOnSignal reopens the log files of the middleware
+// each time the process receives SIGHUP, such as after they
+// have been rotated.
+func reopenLogsOnSignal() {
+	reopenSignal := make(chan os.Signal, 1)
+	signal.Notify(reopenSignal, syscall.SIGHUP)
+
+	for range reopenSignal {
+		err := middleware.ReopenLogFiles()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Println("Log files reopened")
+	}
+}
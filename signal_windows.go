@@ -0,0 +1,11 @@
+package main
+
+import "github.com/mholt/caddy/server"
+
+// reloadOnSignal does nothing on Windows, which
+// has no SIGUSR1 to reload the configuration with.
+func reloadOnSignal(servers []*server.Server) {}
+
+// reopenLogsOnSignal does nothing on Windows, which
+// has no SIGHUP to reopen the log files with.
+func reopenLogsOnSignal() {}
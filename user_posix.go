@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges makes the process run as the user and group
+// named (by name or ID) userName and groupName, such as after
+// binding ports below 1024 as root. If only the user is given,
+// the group is the user's primary group. The supplementary
+// groups are cleared too. Nothing is changed if both are
+// empty or already those of the process.
+func dropPrivileges(userName, groupName string) error {
+	if userName == "" && groupName == "" {
+		return nil
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			u, err = user.LookupId(userName)
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot run as user %s: %v", userName, err)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot run as group %s: %v", groupName, err)
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	if uid == os.Getuid() && gid == os.Getgid() {
+		return nil
+	}
+
+	// The group has to change first, while the
+	// user still has the privileges to change it
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("Cannot run as group %d: %v", gid, err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("Cannot run as group %d: %v", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("Cannot run as user %d: %v", uid, err)
+	}
+	return nil
+}
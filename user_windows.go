@@ -0,0 +1,13 @@
+package main
+
+import "errors"
+
+// dropPrivileges returns an error if a user or group is
+// given, since processes can't change theirs on Windows;
+// running on with full privileges instead would be silent.
+func dropPrivileges(userName, groupName string) error {
+	if userName == "" && groupName == "" {
+		return nil
+	}
+	return errors.New("The user and group directives are not supported on Windows")
+}